@@ -7,6 +7,7 @@ require (
 	github.com/charmbracelet/bubbletea v0.25.0
 	github.com/charmbracelet/lipgloss v0.9.1
 	github.com/kkdai/youtube/v2 v2.10.4
+	golang.org/x/sys v0.32.0
 )
 
 require (
@@ -30,7 +31,6 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/sahilm/fuzzy v0.1.1-0.20230530133925-c48e322e2a8f // indirect
 	golang.org/x/sync v0.18.0 // indirect
-	golang.org/x/sys v0.32.0 // indirect
 	golang.org/x/term v0.6.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 )
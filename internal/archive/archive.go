@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AnyFormat is recorded for files whose format isn't known, such as
+// imported ones. It matches every itag of the video.
+const AnyFormat = 0
+
+// entry is one recorded download
+type entry struct {
+	videoID string
+	itag    int
+}
+
+// Archive is an append-only record of completed downloads. Each line holds
+// "youtube <video ID> <itag>". The file is locked while it's read or
+// written, so several processes can share one archive; entries added by
+// other processes are picked up on the next lookup.
+type Archive struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[entry]bool
+	offset  int64 // bytes of the file already read
+}
+
+// New returns the archive stored at path. The file is created on the first
+// Add.
+func New(path string) *Archive {
+	return &Archive{
+		path:    path,
+		entries: make(map[entry]bool),
+	}
+}
+
+// Path returns the location of the archive file
+func (a *Archive) Path() string {
+	return a.path
+}
+
+// Has reports whether the video has been downloaded in the given format,
+// or in any format if it was recorded with AnyFormat
+func (a *Archive) Has(videoID string, itag int) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if err := lockFile(file, false); err != nil {
+		return false, fmt.Errorf("failed to lock archive: %w", err)
+	}
+	defer unlockFile(file)
+
+	if err := a.readLocked(file); err != nil {
+		return false, err
+	}
+	return a.entries[entry{videoID, itag}] || a.entries[entry{videoID, AnyFormat}], nil
+}
+
+// Add records a completed download. Entries that are already in the
+// archive aren't written again.
+func (a *Archive) Add(videoID string, itag int) error {
+	_, err := a.AddAll([]string{videoID}, itag)
+	return err
+}
+
+// AddAll records several downloads in one write and returns how many of
+// them were new
+func (a *Archive) AddAll(videoIDs []string, itag int) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return 0, err
+	}
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := lockFile(file, true); err != nil {
+		return 0, fmt.Errorf("failed to lock archive: %w", err)
+	}
+	defer unlockFile(file)
+
+	// Catch up with other processes before deciding what's new
+	if err := a.readLocked(file); err != nil {
+		return 0, err
+	}
+
+	var b strings.Builder
+	added := 0
+	for _, id := range videoIDs {
+		e := entry{id, itag}
+		if a.entries[e] {
+			continue
+		}
+		a.entries[e] = true
+		fmt.Fprintf(&b, "youtube %s %d\n", id, itag)
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	data := b.String()
+	if info.Size() > a.offset {
+		// The last line has no newline, as in a file edited by hand or
+		// written by another tool; end it rather than write over it
+		data = "\n" + data
+	}
+	if _, err := file.WriteAt([]byte(data), info.Size()); err != nil {
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	// Read back the new lines, along with the one they ended
+	if err := a.readLocked(file); err != nil {
+		return 0, err
+	}
+	return added, file.Sync()
+}
+
+// readLocked reads the lines appended since the last read
+func (a *Archive) readLocked(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < a.offset {
+		// The file was replaced or truncated; start over
+		a.entries = make(map[entry]bool)
+		a.offset = 0
+	}
+	if info.Size() == a.offset {
+		return nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, a.offset, info.Size()-a.offset))
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Leave a partial last line for the next read
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		a.offset += int64(len(line))
+
+		if e, ok := parseLine(line); ok {
+			a.entries[e] = true
+		}
+	}
+}
+
+// parseLine parses an archive line, ignoring blank and malformed ones. Lines
+// without an itag, as written by other downloaders, match any format.
+func parseLine(line string) (entry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "youtube" {
+		return entry{}, false
+	}
+
+	e := entry{videoID: fields[1], itag: AnyFormat}
+	if len(fields) > 2 {
+		itag, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return entry{}, false
+		}
+		e.itag = itag
+	}
+	return e, true
+}
@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestArchiveAddAndHas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "archive.txt")
+	a := New(path)
+
+	if ok, err := a.Has("dQw4w9WgXcQ", 22); err != nil || ok {
+		t.Fatalf("Has() on a missing archive = %v, %v; want false, nil", ok, err)
+	}
+
+	if err := a.Add("dQw4w9WgXcQ", 22); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := a.Add("dQw4w9WgXcQ", 22); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if added, err := a.AddAll([]string{"jNQXAC9IVRw", "dQw4w9WgXcQ"}, AnyFormat); err != nil || added != 2 {
+		t.Fatalf("AddAll() = %d, %v; want 2, nil", added, err)
+	}
+
+	tests := []struct {
+		id   string
+		itag int
+		want bool
+	}{
+		{"dQw4w9WgXcQ", 22, true},
+		{"dQw4w9WgXcQ", 18, true}, // recorded with AnyFormat too
+		{"jNQXAC9IVRw", 140, true},
+		{"9bZkp7q19f0", 22, false},
+	}
+	for _, tt := range tests {
+		if got, err := a.Has(tt.id, tt.itag); err != nil || got != tt.want {
+			t.Errorf("Has(%s, %d) = %v, %v; want %v", tt.id, tt.itag, got, err, tt.want)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "youtube dQw4w9WgXcQ 22\nyoutube jNQXAC9IVRw 0\nyoutube dQw4w9WgXcQ 0\n"
+	if string(data) != want {
+		t.Errorf("archive file = %q, want %q", data, want)
+	}
+}
+
+func TestArchiveSeesOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.txt")
+	os.WriteFile(path, []byte("youtube dQw4w9WgXcQ\n# comment\n\nyoutube jNQXAC9IVRw 18\nyoutube 9bZkp7q"), 0644)
+
+	a, b := New(path), New(path)
+	if ok, _ := a.Has("dQw4w9WgXcQ", 22); !ok {
+		t.Error("entries without an itag should match any format")
+	}
+	if ok, _ := a.Has("9bZkp7q", 0); ok {
+		t.Error("a line without a newline should wait for one")
+	}
+
+	if err := b.Add("9bZkp7q19f0", 22); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if ok, _ := a.Has("9bZkp7q19f0", 22); !ok {
+		t.Error("Has() should see the entry added after the unterminated line")
+	}
+	if ok, _ := a.Has("jNQXAC9IVRw", 18); !ok {
+		t.Error("existing entries were lost")
+	}
+
+	if err := b.Add("kJQP7kiw5Fk", 137); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if ok, _ := a.Has("kJQP7kiw5Fk", 137); !ok {
+		t.Error("Has() should see entries added by another writer")
+	}
+}
+
+func TestArchiveWithoutTrailingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.txt")
+	os.WriteFile(path, []byte("youtube dQw4w9WgXcQ 22"), 0644)
+
+	a := New(path)
+	if err := a.Add("jNQXAC9IVRw", 18); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "youtube dQw4w9WgXcQ 22\nyoutube jNQXAC9IVRw 18\n"
+	if string(data) != want {
+		t.Errorf("archive file = %q, want %q", data, want)
+	}
+	if ok, _ := a.Has("dQw4w9WgXcQ", 22); !ok {
+		t.Error("the entry on the unterminated line was lost")
+	}
+	if ok, _ := New(path).Has("jNQXAC9IVRw", 18); !ok {
+		t.Error("the new entry can't be read back")
+	}
+}
+
+func TestArchiveConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.txt")
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			a := New(path)
+			for i := 0; i < 25; i++ {
+				if err := a.Add(fmt.Sprintf("video-%d-%02d", w, i), 18); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("archive has %d lines, want 100", len(lines))
+	}
+	for _, line := range lines {
+		if _, ok := parseLine(line); !ok {
+			t.Errorf("corrupt line %q", line)
+		}
+	}
+}
+
+func TestIDFromFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"Rick Astley - Never Gonna Give You Up [dQw4w9WgXcQ].mp4", "dQw4w9WgXcQ", true},
+		{"2009-10-25 - Title [dQw4w9WgXcQ] (1).mp4", "dQw4w9WgXcQ", true},
+		{"Never Gonna Give You Up-dQw4w9WgXcQ.webm", "dQw4w9WgXcQ", true},
+		{"Never Gonna Give You Up.mp4", "", false},
+		{"Holiday [2019].mp4", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := IDFromFilename(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("IDFromFilename() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "Channel"), 0755)
+	for _, name := range []string{
+		"Channel/First [dQw4w9WgXcQ].mp4",
+		"Second [jNQXAC9IVRw].m4a",
+		"Second [jNQXAC9IVRw].webm",
+		"Partial [9bZkp7q19f0].mp4.part",
+		"Partial [9bZkp7q19f0].mp4.part.state",
+		"Unmerged [kJQP7kiw5Fk].f137.mp4",
+		"notes.txt",
+	} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	ids, err := ScanDir(dir)
+	if err != nil {
+		t.Fatalf("ScanDir() error = %v", err)
+	}
+	if got := strings.Join(ids, " "); got != "dQw4w9WgXcQ jNQXAC9IVRw" {
+		t.Errorf("ScanDir() = %q, want %q", got, "dQw4w9WgXcQ jNQXAC9IVRw")
+	}
+}
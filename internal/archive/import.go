@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// filenameIDPatterns find a video ID in a file name: "Title [ID].ext", as
+// written by the suggested output templates, and "Title-ID.ext" as written
+// by older youtube-dl versions
+var filenameIDPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\[([A-Za-z0-9_-]{11})\]`),
+	regexp.MustCompile(`-([A-Za-z0-9_-]{11})\.[A-Za-z0-9]+$`),
+}
+
+// streamPattern matches the separate streams of a download that hasn't been
+// merged yet, e.g. "Title [ID].f137.mp4"
+var streamPattern = regexp.MustCompile(`\.f[0-9]+\.[A-Za-z0-9]+$`)
+
+// IDFromFilename returns the video ID in a file name
+func IDFromFilename(name string) (string, bool) {
+	for _, pattern := range filenameIDPatterns {
+		if m := pattern.FindStringSubmatch(name); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// ScanDir returns the video IDs found in the names of the files under dir.
+// Unfinished downloads are ignored.
+func ScanDir(dir string) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".part.state") || streamPattern.MatchString(name) {
+			return nil
+		}
+		if id, ok := IDFromFilename(name); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	return ids, err
+}
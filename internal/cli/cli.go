@@ -0,0 +1,468 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/phetzy/yt-downloader/internal/archive"
+	"github.com/phetzy/yt-downloader/internal/config"
+	"github.com/phetzy/yt-downloader/internal/media"
+	"github.com/phetzy/yt-downloader/internal/utils"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// errUsage reports a command line that doesn't make sense; usage is printed
+var errUsage = errors.New("invalid usage")
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// App runs the non-interactive subcommands
+type App struct {
+	Config *config.Config
+	Build  BuildInfo
+	Stdout io.Writer
+	Stderr io.Writer
+
+	client *youtube.Client
+}
+
+// New creates an App that writes to stdout and stderr
+func New(cfg *config.Config, build BuildInfo, stdout, stderr io.Writer) *App {
+	return &App{
+		Config: cfg,
+		Build:  build,
+		Stdout: stdout,
+		Stderr: stderr,
+	}
+}
+
+// Run executes the subcommand in args and returns the process exit code
+func (a *App) Run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		a.usage()
+		return ExitUsage
+	}
+
+	var err error
+	switch args[0] {
+	case "get":
+		err = a.get(ctx, args[1:])
+	case "info":
+		err = a.info(args[1:])
+	case "formats":
+		err = a.formats(args[1:])
+	case "import":
+		err = a.importFiles(args[1:])
+	case "version", "--version", "-v":
+		err = a.version()
+	case "help", "--help", "-h":
+		a.usage()
+		return ExitOK
+	default:
+		fmt.Fprintf(a.Stderr, "Unknown command %q\n\n", args[0])
+		a.usage()
+		return ExitUsage
+	}
+
+	switch {
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case err != nil:
+		fmt.Fprintf(a.Stderr, "Error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// usage prints the list of subcommands
+func (a *App) usage() {
+	fmt.Fprint(a.Stderr, `Usage:
+  yt-downloader                         Start the interactive TUI
+  yt-downloader get URL... [-f FORMAT] [-x AUDIO] [-o DIR] [-t TEMPLATE]
+                        [-exists POLICY] [-archive FILE] [-rate SPEED]
+                                        Download videos or playlists
+  yt-downloader info URL                Show information about a video
+  yt-downloader formats URL             List the formats of a video
+  yt-downloader import [-archive FILE] DIR...
+                                        Add the IDs in existing file names
+                                        to the download archive
+  yt-downloader version                 Print version information
+
+FORMAT is "best" (default), "audio", a maximum height such as "720p",
+an itag number from the formats command or a format selector such as
+"bestvideo[height<=1080][ext=mp4]+bestaudio/best". -x extracts the audio
+as AUDIO: mp3 (320k), mp3-v0, opus, flac or m4a, using ffmpeg unless the
+stream already is in that format. TEMPLATE names the files,
+e.g. "{author}/{upload_date} - {title} [{id}].{ext}". POLICY is what to do
+when the file already exists: rename, overwrite or skip. -archive FILE
+records downloads in FILE and skips videos already listed there. -rate
+caps the download speed, e.g. "2MB" per second, or "0" for no limit, in
+place of rate_limit and rate_schedule.
+`)
+}
+
+// yt returns the shared YouTube client
+func (a *App) yt() *youtube.Client {
+	if a.client == nil {
+		a.client = a.Config.NewClient()
+	}
+	return a.client
+}
+
+// flagSet reports whether the flag called name was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseFlags parses fs from args, allowing flags before and after the
+// positional arguments, which it returns
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// singleURL parses the arguments of a command that takes one URL
+func (a *App) singleURL(name string, args []string) (string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	urls, err := parseFlags(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(urls) != 1 {
+		fmt.Fprintf(a.Stderr, "Usage: yt-downloader %s URL\n", name)
+		return "", errUsage
+	}
+	return urls[0], nil
+}
+
+// get downloads every URL in args
+func (a *App) get(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	format := fs.String("f", youtube.RuleBest, `format: "best", "audio", a height like "720p", an itag or a selector`)
+	output := fs.String("o", "", "output directory (default: your Downloads folder)")
+	template := fs.String("t", a.Config.OutputTemplate, "output file name template")
+	exists := fs.String("exists", a.Config.CollisionPolicy, "when a file exists: rename, overwrite or skip")
+	archivePath := fs.String("archive", a.Config.DownloadArchive, "download archive file")
+	rate := fs.String("rate", "", `speed limit such as "2MB" (default: rate_limit and rate_schedule)`)
+	extract := fs.String("x", "", "extract the audio as mp3, mp3-v0, opus, flac or m4a")
+
+	urls, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(a.Stderr, "Usage: yt-downloader get URL... [-f FORMAT] [-x AUDIO] [-o DIR] [-t TEMPLATE] [-exists POLICY] [-archive FILE] [-rate SPEED]")
+		return errUsage
+	}
+
+	var audio media.AudioFormat
+	if *extract != "" {
+		if audio, err = media.ParseAudioFormat(*extract); err != nil {
+			fmt.Fprintf(a.Stderr, "-x: %v\n", err)
+			return errUsage
+		}
+		if !flagSet(fs, "f") {
+			// Start from the best audio rather than a whole video
+			*format = youtube.RuleAudio
+		}
+	}
+
+	selector, err := youtube.ParseRule(*format)
+	if err != nil {
+		fmt.Fprintf(a.Stderr, "-f: %v\n", err)
+		return errUsage
+	}
+
+	downloader := a.Config.NewDownloader(a.yt())
+	if downloader.Template, err = youtube.ParseTemplate(*template); err != nil {
+		return err
+	}
+	if downloader.Collision, err = youtube.ParseCollisionPolicy(*exists); err != nil {
+		fmt.Fprintf(a.Stderr, "-exists must be rename, overwrite or skip, not %q\n", *exists)
+		return errUsage
+	}
+	downloader.Archive = a.archive(*archivePath)
+	if downloader.Limiter, err = a.rateLimiter(*rate); err != nil {
+		fmt.Fprintf(a.Stderr, "-rate: %v\n", err)
+		return errUsage
+	}
+
+	dir := *output
+	if dir == "" {
+		if dir, err = utils.GetDefaultDownloadDir(); err != nil {
+			return err
+		}
+	}
+	if err := utils.EnsureDir(dir); err != nil {
+		return fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+
+	videos, err := a.expand(urls)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, v := range videos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(videos) > 1 {
+			fmt.Fprintf(a.Stdout, "[%d/%d] ", i+1, len(videos))
+		}
+		if err := a.download(ctx, downloader, v, selector, audio, dir); err != nil {
+			fmt.Fprintf(a.Stderr, "Error: %s: %v\n", v.url, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(videos))
+	}
+	return nil
+}
+
+// video is a video to download with its position in a playlist, if any
+type video struct {
+	url           string
+	playlistIndex int
+}
+
+// rateLimiter returns the limiter for a get run. A -rate of its own
+// replaces the configured limit and schedule for this run only; the shared
+// limiter is left as it is.
+func (a *App) rateLimiter(rate string) (*youtube.RateLimiter, error) {
+	if rate == "" {
+		return a.Config.RateLimiter(), nil
+	}
+	limit, err := youtube.ParseRate(rate)
+	if err != nil {
+		return nil, err
+	}
+	return youtube.NewRateLimiter(limit, nil), nil
+}
+
+// expand replaces playlist URLs with the videos in them
+func (a *App) expand(urls []string) ([]video, error) {
+	var videos []video
+	for _, u := range urls {
+		_, videoErr := youtube.ExtractVideoID(u)
+		if _, err := youtube.ExtractPlaylistID(u); err != nil || videoErr == nil {
+			// A single video, or a video that happens to be in a playlist
+			videos = append(videos, video{url: u})
+			continue
+		}
+
+		playlist, err := a.yt().GetPlaylistInfo(u)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(a.Stdout, "Playlist: %s (%d videos)\n", playlist.Title, len(playlist.Entries))
+		for _, entry := range playlist.Entries {
+			videos = append(videos, video{url: entry.URL(), playlistIndex: entry.Index})
+		}
+	}
+	return videos, nil
+}
+
+// download fetches one video in the format picked by selector, extracting
+// its audio as audio unless that's empty
+func (a *App) download(ctx context.Context, downloader *youtube.Downloader, v video, selector *youtube.Selector, audio media.AudioFormat, dir string) error {
+	info, err := a.yt().GetVideoInfo(v.url)
+	if err != nil {
+		return err
+	}
+
+	format, err := selector.Select(info.Formats)
+	if err != nil {
+		return err
+	}
+	if audio != "" {
+		format = format.WithAudioExtraction(audio)
+	}
+
+	fmt.Fprintf(a.Stdout, "%s (%s)\n", info.Title, describeFormat(format))
+
+	progress := newProgressPrinter(a.Stdout)
+	entry := youtube.PlaylistEntry{Index: v.playlistIndex, ID: info.ID}
+	file, err := downloader.DownloadEntry(ctx, entry, format, dir, progress.update)
+	progress.done()
+	if errors.Is(err, youtube.ErrSkipped) {
+		if file == "" {
+			fmt.Fprintln(a.Stdout, "Already downloaded (in the download archive)")
+		} else {
+			fmt.Fprintf(a.Stdout, "Already downloaded: %s\n", file)
+		}
+		return nil
+	}
+	var postErr *youtube.PostProcessError
+	if err != nil && !errors.As(err, &postErr) {
+		return err
+	}
+
+	fmt.Fprintf(a.Stdout, "Saved to %s\n", file)
+	if postErr != nil {
+		// The file is there; only steps run on it afterwards failed
+		for _, step := range postErr.Steps {
+			fmt.Fprintf(a.Stderr, "Warning: %v\n", step)
+		}
+	}
+	return nil
+}
+
+// archive returns the download archive at path, or nil for no archive
+func (a *App) archive(path string) *archive.Archive {
+	cfg := config.Config{DownloadArchive: path}
+	return cfg.Archive()
+}
+
+// importFiles adds the video IDs in the names of existing files to the
+// download archive, so they aren't downloaded again
+func (a *App) importFiles(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	archivePath := fs.String("archive", a.Config.DownloadArchive, "download archive file")
+
+	dirs, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		fmt.Fprintln(a.Stderr, "Usage: yt-downloader import [-archive FILE] DIR...")
+		return errUsage
+	}
+
+	if *archivePath == "" {
+		fmt.Fprintln(a.Stderr, "No download archive: set download_archive in the config file or pass -archive FILE")
+		return errUsage
+	}
+	arch := a.archive(*archivePath)
+
+	for _, dir := range dirs {
+		ids, err := archive.ScanDir(dir)
+		if err != nil {
+			return fmt.Errorf("cannot scan %s: %w", dir, err)
+		}
+		added, err := arch.AddAll(ids, archive.AnyFormat)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.Stdout, "%s: found %d videos, %d new\n", dir, len(ids), added)
+	}
+
+	fmt.Fprintf(a.Stdout, "Archive: %s\n", arch.Path())
+	return nil
+}
+
+// info prints information about a video
+func (a *App) info(args []string) error {
+	videoURL, err := a.singleURL("info", args)
+	if err != nil {
+		return err
+	}
+
+	info, err := a.yt().GetVideoInfo(videoURL)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Title:\t%s\n", info.Title)
+	fmt.Fprintf(w, "ID:\t%s\n", info.ID)
+	fmt.Fprintf(w, "Channel:\t%s\n", info.Author)
+	fmt.Fprintf(w, "Duration:\t%s\n", info.Duration)
+	fmt.Fprintf(w, "Views:\t%s\n", utils.FormatNumber(info.Views))
+	fmt.Fprintf(w, "Uploaded:\t%s\n", info.UploadDate)
+	fmt.Fprintf(w, "Formats:\t%d\n", len(info.Formats))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if info.Description != "" {
+		fmt.Fprintf(a.Stdout, "\n%s\n", strings.TrimSpace(info.Description))
+	}
+	return nil
+}
+
+// formats lists the formats of a video
+func (a *App) formats(args []string) error {
+	videoURL, err := a.singleURL("formats", args)
+	if err != nil {
+		return err
+	}
+
+	info, err := a.yt().GetVideoInfo(videoURL)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ITAG\tEXT\tQUALITY\tRESOLUTION\tSIZE\tCONTENT")
+	for _, f := range info.Formats {
+		resolution := f.Resolution
+		if resolution == "" {
+			resolution = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			f.ItagNo, f.Extension, f.Quality, resolution, utils.FormatBytes(f.TotalSize()), describeFormat(f))
+	}
+	return w.Flush()
+}
+
+// version prints the build information
+func (a *App) version() error {
+	_, err := fmt.Fprintf(a.Stdout, "yt-downloader %s (commit %s, built %s)\n",
+		a.Build.Version, a.Build.Commit, a.Build.Date)
+	return err
+}
+
+// describeFormat summarises what a format contains
+func describeFormat(f youtube.Format) string {
+	switch {
+	case f.ExtractAudio != "":
+		return "audio as " + f.ExtractAudio.Label()
+	case f.IsAudioOnly:
+		return "audio only"
+	case f.Audio != nil:
+		return fmt.Sprintf("%s video + %s audio", f.Quality, f.Audio.Extension)
+	case f.HasAudio:
+		return fmt.Sprintf("%s video + audio", f.Quality)
+	default:
+		return fmt.Sprintf("%s video only", f.Quality)
+	}
+}
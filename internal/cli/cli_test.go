@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phetzy/yt-downloader/internal/archive"
+	"github.com/phetzy/yt-downloader/internal/config"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+func newTestApp() (*App, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	build := BuildInfo{Version: "1.2.3", Commit: "abc123", Date: "2024-01-02"}
+	return New(config.Default(), build, &stdout, &stderr), &stdout, &stderr
+}
+
+func TestVersion(t *testing.T) {
+	app, stdout, _ := newTestApp()
+
+	if code := app.Run(context.Background(), []string{"version"}); code != ExitOK {
+		t.Fatalf("Run(version) = %d, want %d", code, ExitOK)
+	}
+
+	want := "yt-downloader 1.2.3 (commit abc123, built 2024-01-02)\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("version output = %q, want %q", got, want)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"No command", nil, ExitUsage},
+		{"Help", []string{"help"}, ExitOK},
+		{"Unknown command", []string{"fetch"}, ExitUsage},
+		{"Get without URL", []string{"get", "-f", "720p"}, ExitUsage},
+		{"Info without URL", []string{"info"}, ExitUsage},
+		{"Formats with two URLs", []string{"formats", "a", "b"}, ExitUsage},
+		{"Unknown flag", []string{"get", "-z", "url"}, ExitUsage},
+		{"Unknown audio format", []string{"get", "-x", "wav", "url"}, ExitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _, stderr := newTestApp()
+			if code := app.Run(context.Background(), tt.args); code != tt.want {
+				t.Errorf("Run(%v) = %d, want %d", tt.args, code, tt.want)
+			}
+			if stderr.Len() == 0 {
+				t.Errorf("Run(%v) printed no usage", tt.args)
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	format := fs.String("f", "best", "")
+	output := fs.String("o", "", "")
+
+	args := []string{"url1", "-f", "720p", "url2", "-o", "out", "url3"}
+	urls, err := parseFlags(fs, args)
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+
+	if got := strings.Join(urls, " "); got != "url1 url2 url3" {
+		t.Errorf("positional = %q, want %q", got, "url1 url2 url3")
+	}
+	if *format != "720p" || *output != "out" {
+		t.Errorf("flags = %q, %q, want %q, %q", *format, *output, "720p", "out")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	app, _, _ := newTestApp()
+	app.Config.RateLimit = "5MB"
+	app.Config.RateSchedule = []config.RateScheduleEntry{{From: "00:00", To: "23:59", Limit: "1MB"}}
+	shared := app.Config.RateLimiter()
+	want, _ := shared.Limit()
+
+	if l, _ := app.rateLimiter(""); l != shared {
+		t.Error("rateLimiter() without -rate should use the configured limiter")
+	}
+
+	// -rate replaces the schedule for this run without touching the shared
+	// limiter other downloads use
+	l, err := app.rateLimiter("2MB")
+	if err != nil {
+		t.Fatalf("rateLimiter() error = %v", err)
+	}
+	if limit, rule := l.Limit(); limit != 2<<20 || rule != nil {
+		t.Errorf("-rate 2MB limit = %d, %v; want %d and no schedule", limit, rule, 2<<20)
+	}
+	if limit, _ := shared.Limit(); limit != want || shared.Overridden() {
+		t.Errorf("shared limit = %d, overridden = %v; want the configured %d", limit, shared.Overridden(), want)
+	}
+
+	if _, err := app.rateLimiter("fast"); err == nil {
+		t.Error("rateLimiter() should reject invalid speeds")
+	}
+}
+
+func TestProgressPrinterPlain(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgressPrinter(&out)
+
+	for _, pct := range []float64{0, 3, 9, 10, 15, 34, 100} {
+		p.update(youtube.DownloadProgress{Percentage: pct, TotalBytes: 1024})
+	}
+	p.done()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("printed %d lines, want 4 (0%%, 10%%, 34%%, 100%%):\n%s", len(lines), out.String())
+	}
+	if strings.Contains(out.String(), "\r") {
+		t.Error("plain output should not contain carriage returns")
+	}
+	if !strings.HasPrefix(lines[3], "100.0% of 1.00 KB") {
+		t.Errorf("last line = %q", lines[3])
+	}
+}
+
+func TestFormatProgressReconnecting(t *testing.T) {
+	line := formatProgress(youtube.DownloadProgress{Percentage: 40, TotalBytes: 1024, ETA: 30, Attempt: 2, MaxAttempts: 5})
+	if !strings.HasSuffix(line, ", reconnecting (2/5)") {
+		t.Errorf("formatProgress() = %q, want the reconnect attempt instead of the ETA", line)
+	}
+}
+
+func TestProgressPrinterEvents(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgressPrinter(&out)
+
+	event := "stream throttled to 48.00 KB/s, refreshed the stream URL"
+	p.update(youtube.DownloadProgress{Percentage: 0, TotalBytes: 1024})
+	p.update(youtube.DownloadProgress{Percentage: 5, TotalBytes: 1024, Event: event})
+	p.update(youtube.DownloadProgress{Percentage: 6, TotalBytes: 1024, Event: event})
+
+	if got := strings.Count(out.String(), event); got != 1 {
+		t.Errorf("event printed %d times, want once:\n%s", got, out.String())
+	}
+}
+
+func TestProgressPrinterSteps(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgressPrinter(&out)
+
+	p.update(youtube.DownloadProgress{Percentage: 100, TotalBytes: 1024, Step: "merge", StepNumber: 1, Steps: 2})
+	p.update(youtube.DownloadProgress{Percentage: 100, TotalBytes: 1024, Step: "merge", StepNumber: 1, Steps: 2})
+	p.update(youtube.DownloadProgress{Percentage: 100, TotalBytes: 1024, Step: "tag", StepNumber: 2, Steps: 2})
+
+	want := "Post-processing: merge (1/2)\nPost-processing: tag (2/2)\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Video [dQw4w9WgXcQ].mp4"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "Other.mp4"), nil, 0644)
+	archivePath := filepath.Join(t.TempDir(), "archive.txt")
+
+	app, stdout, stderr := newTestApp()
+	if code := app.Run(context.Background(), []string{"import", dir, "-archive", archivePath}); code != ExitOK {
+		t.Fatalf("Run(import) = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if !strings.Contains(stdout.String(), "found 1 videos, 1 new") {
+		t.Errorf("import output = %q", stdout)
+	}
+	if ok, _ := archive.New(archivePath).Has("dQw4w9WgXcQ", 22); !ok {
+		t.Error("imported video should be in the archive")
+	}
+
+	// Without an archive there's nowhere to import to
+	app, _, _ = newTestApp()
+	if code := app.Run(context.Background(), []string{"import", dir}); code != ExitUsage {
+		t.Errorf("Run(import) without an archive = %d, want %d", code, ExitUsage)
+	}
+}
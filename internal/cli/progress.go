@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/phetzy/yt-downloader/internal/utils"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// progressStep is how often, in percent, plain progress lines are printed
+const progressStep = 10
+
+// progressPrinter reports download progress on the command line. On a
+// terminal it redraws a single status line; otherwise, e.g. when output is
+// piped to a file, it prints a plain line every progressStep percent.
+type progressPrinter struct {
+	w        io.Writer
+	terminal bool
+	next     float64 // percentage at which the next plain line is printed
+	width    int     // length of the last status line drawn on a terminal
+	event    string  // last event printed
+	step     string  // last post-processing step printed
+}
+
+// newProgressPrinter creates a progressPrinter writing to w
+func newProgressPrinter(w io.Writer) *progressPrinter {
+	return &progressPrinter{w: w, terminal: isTerminal(w)}
+}
+
+// update reports the latest progress
+func (p *progressPrinter) update(progress youtube.DownloadProgress) {
+	if progress.Event != p.event {
+		p.event = progress.Event
+		p.printLine(progress.Event)
+	}
+	if progress.Step != "" {
+		// The download is complete; report each step once
+		step := fmt.Sprintf("Post-processing: %s (%d/%d)", progress.Step, progress.StepNumber, progress.Steps)
+		if step != p.step {
+			p.step = step
+			p.printLine(step)
+		}
+		return
+	}
+	line := formatProgress(progress)
+
+	if p.terminal {
+		padding := ""
+		if len(line) < p.width {
+			padding = strings.Repeat(" ", p.width-len(line))
+		}
+		fmt.Fprintf(p.w, "\r%s%s", line, padding)
+		p.width = len(line)
+		return
+	}
+
+	if progress.Percentage < p.next {
+		return
+	}
+	fmt.Fprintln(p.w, line)
+	for p.next <= progress.Percentage {
+		p.next += progressStep
+	}
+}
+
+// printLine prints a message on its own line, above the status line on a
+// terminal
+func (p *progressPrinter) printLine(msg string) {
+	if p.terminal && p.width > 0 {
+		fmt.Fprintf(p.w, "\r%s\r", strings.Repeat(" ", p.width))
+		p.width = 0
+	}
+	fmt.Fprintln(p.w, msg)
+}
+
+// done finishes the status line on a terminal
+func (p *progressPrinter) done() {
+	if p.terminal && p.width > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// formatProgress renders progress as one line of text
+func formatProgress(progress youtube.DownloadProgress) string {
+	line := fmt.Sprintf("%5.1f%% of %s at %s",
+		progress.Percentage,
+		utils.FormatBytes(progress.TotalBytes),
+		utils.FormatSpeed(progress.Speed))
+	if progress.Attempt > 0 {
+		line += fmt.Sprintf(", reconnecting (%d/%d)", progress.Attempt, progress.MaxAttempts)
+	} else if progress.ETA > 0 {
+		line += ", ETA " + utils.FormatDuration(progress.ETA)
+	}
+	return line
+}
+
+// isTerminal reports whether w is an interactive terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
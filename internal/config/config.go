@@ -0,0 +1,367 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phetzy/yt-downloader/internal/archive"
+	"github.com/phetzy/yt-downloader/internal/utils"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// fileName is the name of the config file inside the config directory
+const fileName = "config.json"
+
+// Config holds the user's settings
+type Config struct {
+	// KeepPartialDownloads keeps the .part file of a cancelled download so
+	// it can be resumed later instead of deleting it
+	KeepPartialDownloads bool `json:"keep_partial_downloads"`
+
+	// Connections is the number of concurrent range requests per download
+	Connections int `json:"connections"`
+
+	// QueueWorkers is the number of queued jobs downloaded at the same time
+	QueueWorkers int `json:"queue_workers"`
+
+	// OutputTemplate names downloaded files, e.g.
+	// "{author}/{upload_date} - {title} [{id}].{ext}"
+	OutputTemplate string `json:"output_template"`
+
+	// CollisionPolicy decides what queued and command line downloads do
+	// when the file already exists: "rename", "overwrite" or "skip"
+	CollisionPolicy string `json:"collision_policy"`
+
+	// DownloadArchive is a file recording every completed download; videos
+	// listed in it aren't downloaded again. Empty disables the archive.
+	DownloadArchive string `json:"download_archive"`
+
+	// MetadataCacheTTL is how long video information is cached on disk, as
+	// a duration like "24h". "0" disables the cache.
+	MetadataCacheTTL string `json:"metadata_cache_ttl"`
+
+	// MetadataCacheSizeMB limits the size of the metadata cache; the least
+	// recently used videos are evicted first
+	MetadataCacheSizeMB int `json:"metadata_cache_size_mb"`
+
+	// DiskReserveMB is the free space, in megabytes, downloads leave on the
+	// disk. Downloads that would use it are refused and queued jobs wait.
+	DiskReserveMB int `json:"disk_reserve_mb"`
+
+	// RetryAttempts is how many times a dropped stream is requested before
+	// the download fails, including the first attempt
+	RetryAttempts int `json:"retry_attempts"`
+
+	// RateLimit caps the combined speed of all downloads, e.g. "5MB" per
+	// second. Empty or "0" is unlimited.
+	RateLimit string `json:"rate_limit"`
+
+	// RateSchedule sets other limits during parts of the day. The first
+	// entry covering the current time wins; RateLimit applies outside them.
+	RateSchedule []RateScheduleEntry `json:"rate_schedule"`
+
+	// SpeedEstimator is how the current speed and ETA are measured: "ewma"
+	// for an exponentially weighted average or "window" for a sliding one
+	SpeedEstimator string `json:"speed_estimator"`
+
+	// SpeedWindow is how far back the current speed looks, e.g. "5s"
+	SpeedWindow string `json:"speed_window"`
+
+	// ThrottleSpeed is the per-connection speed, e.g. "64K", below which a
+	// stream counts as throttled by YouTube and gets a fresh URL. "0"
+	// disables the check.
+	ThrottleSpeed string `json:"throttle_speed"`
+
+	// ThrottleWindow is how long a connection has to stay below
+	// ThrottleSpeed, e.g. "15s"
+	ThrottleWindow string `json:"throttle_window"`
+
+	// FFmpegPath is the ffmpeg binary used to merge streams and convert
+	// audio. Empty looks for ffmpeg on PATH.
+	FFmpegPath string `json:"ffmpeg_path"`
+
+	// PostProcessors are the steps run on every finished download, in
+	// order: "merge", "convert", "tag", "thumbnail", "move" and "hook".
+	// merge and convert produce the file and have to come first.
+	PostProcessors []string `json:"post_processors"`
+
+	// KeepOriginal keeps the downloaded streams after they've been merged
+	// or converted
+	KeepOriginal bool `json:"keep_original"`
+
+	// MoveTo is the directory the move step moves finished files to
+	MoveTo string `json:"move_to"`
+
+	// PostHook is the shell command the hook step runs on finished files
+	PostHook string `json:"post_hook"`
+
+	limiterOnce sync.Once
+	limiter     *youtube.RateLimiter
+}
+
+// RateScheduleEntry limits the download speed between two times of day
+type RateScheduleEntry struct {
+	From  string `json:"from"`  // e.g. "09:00"
+	To    string `json:"to"`    // e.g. "18:00"; earlier than From to span midnight
+	Limit string `json:"limit"` // e.g. "2MB", or "0" for unlimited
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		KeepPartialDownloads: true,
+		Connections:          4,
+		QueueWorkers:         2,
+		OutputTemplate:       youtube.DefaultTemplate,
+		CollisionPolicy:      string(youtube.CollisionRename),
+		MetadataCacheTTL:     "24h",
+		MetadataCacheSizeMB:  50,
+		DiskReserveMB:        500,
+		RetryAttempts:        youtube.DefaultRetryPolicy.MaxAttempts,
+		SpeedEstimator:       string(youtube.SpeedEWMA),
+		SpeedWindow:          youtube.DefaultSpeedWindow.String(),
+		ThrottleSpeed:        "64K",
+		ThrottleWindow:       youtube.DefaultThrottleWindow.String(),
+		PostProcessors: []string{
+			youtube.StepMerge,
+			youtube.StepConvert,
+			youtube.StepMove,
+			youtube.StepHook,
+		},
+	}
+}
+
+// NewClient creates a YouTube client using these settings
+func (c *Config) NewClient() *youtube.Client {
+	client := youtube.NewClient()
+	client.Cache = c.InfoCache()
+	return client
+}
+
+// InfoCache returns the metadata cache, or nil if it's disabled
+func (c *Config) InfoCache() *youtube.InfoCache {
+	ttl, err := time.ParseDuration(c.MetadataCacheTTL)
+	if err != nil || ttl <= 0 || c.MetadataCacheSizeMB <= 0 {
+		return nil
+	}
+	dir, err := utils.GetCacheDir()
+	if err != nil {
+		return nil
+	}
+	return youtube.NewInfoCache(filepath.Join(dir, "metadata"), ttl, int64(c.MetadataCacheSizeMB)<<20)
+}
+
+// NewDownloader creates a downloader using these settings
+func (c *Config) NewDownloader(client *youtube.Client) *youtube.Downloader {
+	d := youtube.NewDownloader(client)
+	d.KeepPartial = c.KeepPartialDownloads
+	d.Connections = c.Connections
+	if tmpl, err := youtube.ParseTemplate(c.OutputTemplate); err == nil {
+		d.Template = tmpl
+	}
+	if policy, err := youtube.ParseCollisionPolicy(c.CollisionPolicy); err == nil {
+		d.Collision = policy
+	}
+	d.Archive = c.Archive()
+	d.DiskReserve = c.DiskReserve()
+	d.Retry.MaxAttempts = c.RetryAttempts
+	d.Limiter = c.RateLimiter()
+	if estimator, err := youtube.ParseSpeedEstimator(c.SpeedEstimator); err == nil {
+		d.SpeedEstimator = estimator
+	}
+	if window, err := time.ParseDuration(c.SpeedWindow); err == nil {
+		d.SpeedWindow = window
+	}
+	if speed, err := youtube.ParseRate(c.ThrottleSpeed); err == nil {
+		d.ThrottleSpeed = speed
+	}
+	if window, err := time.ParseDuration(c.ThrottleWindow); err == nil {
+		d.ThrottleWindow = window
+	}
+	d.FFmpeg = c.FFmpeg()
+	if steps, err := c.postProcessors(); err == nil {
+		d.PostProcessors = steps
+	}
+	d.KeepOriginal = c.KeepOriginal
+	return d
+}
+
+// postProcessors builds the post-processing steps in the configured order
+func (c *Config) postProcessors() ([]youtube.PostProcessor, error) {
+	moveTo, err := utils.ExpandHomeDir(c.MoveTo)
+	if err != nil {
+		moveTo = c.MoveTo
+	}
+
+	var steps []youtube.PostProcessor
+	seen := make(map[string]bool)
+	finishing := false
+	for _, name := range c.PostProcessors {
+		if seen[name] {
+			return nil, fmt.Errorf("%q is listed twice", name)
+		}
+		seen[name] = true
+
+		var step youtube.PostProcessor
+		switch name {
+		case youtube.StepMerge:
+			step = youtube.MergeStep{}
+		case youtube.StepConvert:
+			step = youtube.ConvertStep{}
+		case youtube.StepTag:
+			step = youtube.TagStep{}
+		case youtube.StepThumbnail:
+			step = youtube.ThumbnailStep{}
+		case youtube.StepMove:
+			step = youtube.MoveStep{Dir: moveTo}
+		case youtube.StepHook:
+			step = youtube.HookStep{Command: c.PostHook}
+		default:
+			return nil, fmt.Errorf("unknown step %q", name)
+		}
+
+		// The other steps work on the file merge and convert write
+		if name == youtube.StepMerge || name == youtube.StepConvert {
+			if finishing {
+				return nil, fmt.Errorf("%q has to come before the other steps", name)
+			}
+		} else {
+			finishing = true
+		}
+		steps = append(steps, step)
+	}
+	if !seen[youtube.StepMerge] || !seen[youtube.StepConvert] {
+		return nil, fmt.Errorf("%q and %q are required", youtube.StepMerge, youtube.StepConvert)
+	}
+	return steps, nil
+}
+
+// FFmpeg returns the configured ffmpeg binary with ~ expanded, or "" to look
+// for it on PATH
+func (c *Config) FFmpeg() string {
+	if c.FFmpegPath == "" {
+		return ""
+	}
+	path, err := utils.ExpandHomeDir(c.FFmpegPath)
+	if err != nil {
+		return c.FFmpegPath
+	}
+	return path
+}
+
+// RateLimiter returns the limiter shared by every downloader created from
+// this config, so the limit covers all downloads together
+func (c *Config) RateLimiter() *youtube.RateLimiter {
+	c.limiterOnce.Do(func() {
+		// LoadFile has validated the settings
+		limit, schedule, _ := c.rateLimits()
+		c.limiter = youtube.NewRateLimiter(limit, schedule)
+	})
+	return c.limiter
+}
+
+// rateLimits parses RateLimit and RateSchedule
+func (c *Config) rateLimits() (int64, []youtube.RateRule, error) {
+	limit, err := youtube.ParseRate(c.RateLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+	var schedule []youtube.RateRule
+	for _, entry := range c.RateSchedule {
+		rule, err := youtube.ParseRateRule(entry.From, entry.To, entry.Limit)
+		if err != nil {
+			return 0, nil, err
+		}
+		schedule = append(schedule, rule)
+	}
+	return limit, schedule, nil
+}
+
+// DiskReserve returns the free space downloads leave, in bytes
+func (c *Config) DiskReserve() int64 {
+	if c.DiskReserveMB < 0 {
+		return 0
+	}
+	return int64(c.DiskReserveMB) << 20
+}
+
+// Archive returns the download archive, or nil if it's disabled
+func (c *Config) Archive() *archive.Archive {
+	if c.DownloadArchive == "" {
+		return nil
+	}
+	path, err := utils.ExpandHomeDir(c.DownloadArchive)
+	if err != nil {
+		path = c.DownloadArchive
+	}
+	return archive.New(path)
+}
+
+// Path returns the location of the config file
+func Path() (string, error) {
+	dir, err := utils.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+// Load reads the config file, falling back to defaults if it doesn't exist
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads the config from path. Settings missing from the file keep
+// their default values.
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := youtube.ParseTemplate(cfg.OutputTemplate); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := youtube.ParseCollisionPolicy(cfg.CollisionPolicy); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: collision_policy must be rename, overwrite or skip", path)
+	}
+	if ttl, err := time.ParseDuration(cfg.MetadataCacheTTL); err != nil || ttl < 0 {
+		return nil, fmt.Errorf("invalid config file %s: metadata_cache_ttl must be a duration like \"24h\" or \"0\" to disable the cache", path)
+	}
+	if _, _, err := cfg.rateLimits(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := youtube.ParseSpeedEstimator(cfg.SpeedEstimator); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: speed_estimator: %w", path, err)
+	}
+	if window, err := time.ParseDuration(cfg.SpeedWindow); err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid config file %s: speed_window must be a duration like \"5s\"", path)
+	}
+	if _, err := youtube.ParseRate(cfg.ThrottleSpeed); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: throttle_speed: %w", path, err)
+	}
+	if window, err := time.ParseDuration(cfg.ThrottleWindow); err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid config file %s: throttle_window must be a duration like \"15s\"", path)
+	}
+	if _, err := cfg.postProcessors(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: post_processors: %w", path, err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFileMissing(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("LoadFile() = %+v, want defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"keep_partial_downloads": false, "connections": 8}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if cfg.KeepPartialDownloads {
+		t.Error("KeepPartialDownloads = true, want false")
+	}
+	if cfg.Connections != 8 {
+		t.Errorf("Connections = %d, want 8", cfg.Connections)
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{not json`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile() should fail on invalid JSON")
+	}
+}
+
+func TestLoadFileInvalidTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"output_template": "{title}.{extension}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile() should fail on an unknown template field")
+	}
+}
+
+func TestInfoCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	cfg := Default()
+	if cfg.InfoCache() == nil {
+		t.Error("InfoCache() = nil, want the cache enabled by default")
+	}
+
+	cfg.MetadataCacheTTL = "0"
+	if cfg.InfoCache() != nil {
+		t.Error("InfoCache() should be nil with a zero TTL")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"metadata_cache_ttl": "a day"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("LoadFile() should fail on an invalid cache TTL")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"rate_limit": "5MB", "rate_schedule": [{"from": "09:00", "to": "18:00", "limit": "2MB"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	limiter := cfg.RateLimiter()
+	if cfg.NewDownloader(nil).Limiter != limiter || cfg.NewDownloader(nil).Limiter != limiter {
+		t.Error("downloaders should share one limiter")
+	}
+
+	tests := []struct {
+		data string
+	}{
+		{`{"rate_limit": "fast"}`},
+		{`{"rate_schedule": [{"from": "9am", "to": "18:00", "limit": "2MB"}]}`},
+		{`{"rate_schedule": [{"from": "09:00", "to": "18:00", "limit": "-1"}]}`},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) should fail", tt.data)
+		}
+	}
+}
+
+func TestLoadFileInvalidSpeedEstimator(t *testing.T) {
+	for _, data := range []string{`{"speed_estimator": "median"}`, `{"speed_window": "0s"}`} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) should fail", data)
+		}
+	}
+}
+
+func TestPostProcessors(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{data: `{}`, want: []string{"merge", "convert", "move", "hook"}},
+		{data: `{"post_processors": ["convert", "merge", "tag", "thumbnail"]}`, want: []string{"convert", "merge", "tag", "thumbnail"}},
+		{data: `{"post_processors": ["merge", "tag", "convert"]}`, wantErr: true},
+		{data: `{"post_processors": ["merge", "convert", "tag", "tag"]}`, wantErr: true},
+		{data: `{"post_processors": ["merge", "convert", "upload"]}`, wantErr: true},
+		{data: `{"post_processors": ["merge", "tag"]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFile(path)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("LoadFile(%s) error = %v, wantErr %v", tt.data, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		var got []string
+		for _, step := range cfg.NewDownloader(nil).PostProcessors {
+			got = append(got, step.Name())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LoadFile(%s) steps = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AudioFormat is a format audio can be extracted to
+type AudioFormat string
+
+const (
+	AudioMP3   AudioFormat = "mp3"    // MP3 at a constant 320 kbit/s
+	AudioMP3V0 AudioFormat = "mp3-v0" // MP3 at the highest variable bitrate
+	AudioOpus  AudioFormat = "opus"   // Opus in an Ogg container
+	AudioFLAC  AudioFormat = "flac"   // lossless FLAC
+	AudioM4A   AudioFormat = "m4a"    // AAC in an MP4 container
+)
+
+// AudioFormats lists the formats audio can be extracted to, in the order
+// they're offered
+var AudioFormats = []AudioFormat{AudioMP3, AudioMP3V0, AudioOpus, AudioFLAC, AudioM4A}
+
+// ParseAudioFormat validates an audio format name
+func ParseAudioFormat(s string) (AudioFormat, error) {
+	f := AudioFormat(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range AudioFormats {
+		if f == known {
+			return f, nil
+		}
+	}
+	names := make([]string, len(AudioFormats))
+	for i, known := range AudioFormats {
+		names[i] = string(known)
+	}
+	return "", fmt.Errorf("unknown audio format %q, use one of %s", s, strings.Join(names, ", "))
+}
+
+// Extension returns the file extension of the format, without a dot
+func (f AudioFormat) Extension() string {
+	if f == AudioMP3V0 {
+		return "mp3"
+	}
+	return string(f)
+}
+
+// Label describes the format for people, e.g. "MP3 320k"
+func (f AudioFormat) Label() string {
+	switch f {
+	case AudioMP3:
+		return "MP3 320k"
+	case AudioMP3V0:
+		return "MP3 V0"
+	case AudioOpus:
+		return "Opus"
+	case AudioFLAC:
+		return "FLAC"
+	case AudioM4A:
+		return "M4A"
+	}
+	return string(f)
+}
+
+// Passthrough reports whether audio encoded with codec, e.g. "opus" or
+// "mp4a.40.2", can be copied into the format without re-encoding
+func (f AudioFormat) Passthrough(codec string) bool {
+	codec = strings.ToLower(codec)
+	switch f {
+	case AudioOpus:
+		return codec == "opus"
+	case AudioFLAC:
+		return codec == "flac"
+	case AudioM4A:
+		return strings.HasPrefix(codec, "mp4a")
+	}
+	return false
+}
+
+// encoderArgs returns the ffmpeg options that encode audio in the format
+func (f AudioFormat) encoderArgs() []string {
+	switch f {
+	case AudioMP3:
+		return []string{"-c:a", "libmp3lame", "-b:a", "320k"}
+	case AudioMP3V0:
+		return []string{"-c:a", "libmp3lame", "-q:a", "0"}
+	case AudioOpus:
+		return []string{"-c:a", "libopus", "-b:a", "160k"}
+	case AudioFLAC:
+		return []string{"-c:a", "flac"}
+	default:
+		return []string{"-c:a", "aac", "-b:a", "256k"}
+	}
+}
+
+// extractArgs returns the ffmpeg arguments that extract the audio of
+// inputPath, encoded with codec, into the format
+func (f AudioFormat) extractArgs(inputPath, codec string) []string {
+	args := []string{"-i", inputPath, "-vn", "-map", "0:a:0"}
+	if f.Passthrough(codec) {
+		return append(args, "-c:a", "copy")
+	}
+	return append(args, f.encoderArgs()...)
+}
+
+// ExtractAudio writes the audio of inputPath, encoded with codec, to
+// outputPath in format using the ffmpeg binary at ffmpeg. Audio the format
+// can hold as is only gets a new container; anything else is re-encoded.
+func ExtractAudio(ctx context.Context, ffmpeg, inputPath, outputPath string, format AudioFormat, codec string) error {
+	if ffmpeg == "" {
+		return fmt.Errorf("%w to convert audio to %s", ErrFFmpegRequired, format.Label())
+	}
+	return runFFmpeg(ctx, ffmpeg, outputPath, format.extractArgs(inputPath, codec)...)
+}
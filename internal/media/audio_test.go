@@ -0,0 +1,74 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseAudioFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    AudioFormat
+		wantExt string
+		wantErr bool
+	}{
+		{in: "mp3", want: AudioMP3, wantExt: "mp3"},
+		{in: "MP3-V0", want: AudioMP3V0, wantExt: "mp3"},
+		{in: " opus ", want: AudioOpus, wantExt: "opus"},
+		{in: "flac", want: AudioFLAC, wantExt: "flac"},
+		{in: "m4a", want: AudioM4A, wantExt: "m4a"},
+		{in: "wav", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseAudioFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAudioFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAudioFormat(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if err == nil && got.Extension() != tt.wantExt {
+				t.Errorf("Extension() = %q, want %q", got.Extension(), tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestExtractArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		format AudioFormat
+		codec  string
+		want   []string
+	}{
+		{"AAC into M4A", AudioM4A, "mp4a.40.2", []string{"-c:a", "copy"}},
+		{"Opus into Opus", AudioOpus, "opus", []string{"-c:a", "copy"}},
+		{"Opus into M4A", AudioM4A, "opus", []string{"-c:a", "aac", "-b:a", "256k"}},
+		{"AAC into Opus", AudioOpus, "mp4a.40.2", []string{"-c:a", "libopus", "-b:a", "160k"}},
+		{"MP3 320k", AudioMP3, "opus", []string{"-c:a", "libmp3lame", "-b:a", "320k"}},
+		{"MP3 V0", AudioMP3V0, "mp4a.40.2", []string{"-c:a", "libmp3lame", "-q:a", "0"}},
+		{"FLAC", AudioFLAC, "opus", []string{"-c:a", "flac"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.format.extractArgs("in.webm", tt.codec)
+			want := append([]string{"-i", "in.webm", "-vn", "-map", "0:a:0"}, tt.want...)
+			if !slices.Equal(args, want) {
+				t.Errorf("extractArgs() = %q, want %q", args, want)
+			}
+		})
+	}
+}
+
+func TestExtractAudioWithoutFFmpeg(t *testing.T) {
+	err := ExtractAudio(context.Background(), "", "in.webm", "out.mp3", AudioMP3, "opus")
+	if !errors.Is(err, ErrFFmpegRequired) {
+		t.Errorf("ExtractAudio() error = %v, want ErrFFmpegRequired", err)
+	}
+}
@@ -0,0 +1,71 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrFFmpegRequired is returned when a file can only be processed with
+// ffmpeg and it isn't installed
+var ErrFFmpegRequired = errors.New("ffmpeg is required")
+
+// FindFFmpeg returns configured if it's set, otherwise the path of ffmpeg on
+// PATH, or "" if it isn't installed
+func FindFFmpeg(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// Merge muxes a video-only and an audio-only stream into outputPath without
+// re-encoding. The ffmpeg binary is used when it's given; otherwise MP4
+// streams are merged natively, which covers the usual mp4 + m4a pair.
+func Merge(ctx context.Context, ffmpeg, videoPath, audioPath, outputPath string) error {
+	if ffmpeg != "" {
+		return MergeFFmpeg(ctx, ffmpeg, videoPath, audioPath, outputPath)
+	}
+
+	err := MergeMP4(videoPath, audioPath, outputPath)
+	if errors.Is(err, errNotFragmented) || errors.Is(err, errTruncated) {
+		return fmt.Errorf("%w to merge these streams: %v", ErrFFmpegRequired, err)
+	}
+	return err
+}
+
+// MergeFFmpeg muxes the streams with the ffmpeg binary at ffmpeg
+func MergeFFmpeg(ctx context.Context, ffmpeg, videoPath, audioPath, outputPath string) error {
+	return runFFmpeg(ctx, ffmpeg, outputPath,
+		"-i", videoPath,
+		"-i", audioPath,
+		"-map", "0:v:0", "-map", "1:a:0",
+		"-c", "copy",
+	)
+}
+
+// runFFmpeg runs ffmpeg with args, writing outputPath. A failed run removes
+// whatever it wrote and returns ffmpeg's own error message.
+func runFFmpeg(ctx context.Context, ffmpeg, outputPath string, args ...string) error {
+	args = append([]string{"-y", "-v", "error"}, args...)
+	cmd := exec.CommandContext(ctx, ffmpeg, append(args, outputPath)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ffmpeg: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrThumbnailUnsupported is returned for containers cover art can't be
+// embedded in
+var ErrThumbnailUnsupported = errors.New("cannot embed a thumbnail")
+
+// thumbnailContainers are the extensions EmbedThumbnail can write
+var thumbnailContainers = []string{".mp4", ".m4a", ".mp3", ".flac"}
+
+// Tag writes outputPath as a copy of inputPath with the given metadata tags,
+// e.g. "title" and "artist". Streams are copied, not re-encoded.
+func Tag(ctx context.Context, ffmpeg, inputPath, outputPath string, tags map[string]string) error {
+	if ffmpeg == "" {
+		return fmt.Errorf("%w to tag files", ErrFFmpegRequired)
+	}
+	return runFFmpeg(ctx, ffmpeg, outputPath, tagArgs(inputPath, outputPath, tags)...)
+}
+
+// tagArgs returns the ffmpeg arguments that tag inputPath
+func tagArgs(inputPath, outputPath string, tags map[string]string) []string {
+	args := []string{"-i", inputPath, "-map", "0", "-c", "copy"}
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if tags[key] != "" {
+			args = append(args, "-metadata", key+"="+tags[key])
+		}
+	}
+	return append(args, containerArgs(outputPath)...)
+}
+
+// EmbedThumbnail writes outputPath as a copy of inputPath with the image at
+// imagePath attached as cover art. videoStreams is the number of video
+// streams in inputPath, so the image can be marked as the one after them.
+func EmbedThumbnail(ctx context.Context, ffmpeg, inputPath, imagePath, outputPath string, videoStreams int) error {
+	args, err := thumbnailArgs(inputPath, imagePath, outputPath, videoStreams)
+	if err != nil {
+		return err
+	}
+	if ffmpeg == "" {
+		return fmt.Errorf("%w to embed thumbnails", ErrFFmpegRequired)
+	}
+	return runFFmpeg(ctx, ffmpeg, outputPath, args...)
+}
+
+// thumbnailArgs returns the ffmpeg arguments that attach imagePath to
+// inputPath
+func thumbnailArgs(inputPath, imagePath, outputPath string, videoStreams int) ([]string, error) {
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	if !slices.Contains(thumbnailContainers, ext) {
+		return nil, fmt.Errorf("%w in %s files", ErrThumbnailUnsupported, ext)
+	}
+	args := []string{
+		"-i", inputPath,
+		"-i", imagePath,
+		"-map", "0", "-map", "1",
+		"-c", "copy",
+		fmt.Sprintf("-disposition:v:%d", videoStreams), "attached_pic",
+	}
+	return append(args, containerArgs(outputPath)...), nil
+}
+
+// containerArgs returns options the container of outputPath needs for tags
+// and cover art to be widely readable
+func containerArgs(outputPath string) []string {
+	if strings.EqualFold(filepath.Ext(outputPath), ".mp3") {
+		return []string{"-id3v2_version", "3"}
+	}
+	return nil
+}
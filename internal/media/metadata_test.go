@@ -0,0 +1,57 @@
+package media
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTagArgs(t *testing.T) {
+	tags := map[string]string{"title": "Song", "artist": "Band", "date": ""}
+
+	got := tagArgs("in.mp3", "out.mp3", tags)
+	want := []string{
+		"-i", "in.mp3", "-map", "0", "-c", "copy",
+		"-metadata", "artist=Band",
+		"-metadata", "title=Song",
+		"-id3v2_version", "3",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("tagArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestThumbnailArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       string
+		videoStreams int
+		wantDispose  string
+		wantErr      bool
+	}{
+		{name: "Video", output: "out.mp4", videoStreams: 1, wantDispose: "-disposition:v:1"},
+		{name: "Audio", output: "out.m4a", wantDispose: "-disposition:v:0"},
+		{name: "FLAC", output: "out.FLAC", wantDispose: "-disposition:v:0"},
+		{name: "Opus", output: "out.opus", wantErr: true},
+		{name: "WebM", output: "out.webm", videoStreams: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := thumbnailArgs("in", "cover.jpg", tt.output, tt.videoStreams)
+			if tt.wantErr {
+				if !errors.Is(err, ErrThumbnailUnsupported) {
+					t.Errorf("thumbnailArgs() error = %v, want ErrThumbnailUnsupported", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("thumbnailArgs() error = %v", err)
+			}
+			i := slices.Index(args, tt.wantDispose)
+			if i < 0 || i+1 >= len(args) || args[i+1] != "attached_pic" {
+				t.Errorf("thumbnailArgs() = %q, want %s attached_pic", args, tt.wantDispose)
+			}
+		})
+	}
+}
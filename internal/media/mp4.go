@@ -0,0 +1,498 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errNotFragmented is returned for MP4 files the native remuxer can't merge
+var errNotFragmented = errors.New("not a single-track fragmented MP4")
+
+// errTruncated is returned when a box runs past the end of its parent
+var errTruncated = errors.New("truncated MP4 box")
+
+// rawBox is the location of an MP4 box inside a byte slice
+type rawBox struct {
+	typ    string
+	start  int // offset of the box header
+	header int // length of the header
+	end    int // offset just past the box
+}
+
+// payload returns the contents of the box after its header
+func (b rawBox) payload(data []byte) []byte {
+	return data[b.start+b.header : b.end]
+}
+
+// bytes returns the whole box including its header
+func (b rawBox) bytes(data []byte) []byte {
+	return data[b.start:b.end]
+}
+
+// parseBoxes splits data into the boxes it contains
+func parseBoxes(data []byte) ([]rawBox, error) {
+	var boxes []rawBox
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 8 {
+			return nil, errTruncated
+		}
+
+		size := int64(binary.BigEndian.Uint32(data[pos:]))
+		header := 8
+		switch size {
+		case 0:
+			// The box runs to the end of its parent
+			size = int64(len(data) - pos)
+		case 1:
+			if len(data)-pos < 16 {
+				return nil, errTruncated
+			}
+			size = int64(binary.BigEndian.Uint64(data[pos+8:]))
+			header = 16
+		}
+		if size < int64(header) || size > int64(len(data)-pos) {
+			return nil, errTruncated
+		}
+
+		boxes = append(boxes, rawBox{
+			typ:    string(data[pos+4 : pos+8]),
+			start:  pos,
+			header: header,
+			end:    pos + int(size),
+		})
+		pos += int(size)
+	}
+	return boxes, nil
+}
+
+// findBox returns the payload of the first box of type typ in data
+func findBox(data []byte, typ string) ([]byte, bool) {
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		return nil, false
+	}
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.payload(data), true
+		}
+	}
+	return nil, false
+}
+
+// makeBox wraps payload in a box header of type typ
+func makeBox(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], typ)
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+	return box
+}
+
+// fileBox is the location of a top-level box in a file
+type fileBox struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// listFileBoxes reads the headers of the top-level boxes of a file
+func listFileBoxes(r io.ReaderAt, fileSize int64) ([]fileBox, error) {
+	var boxes []fileBox
+	header := make([]byte, 16)
+	for pos := int64(0); pos < fileSize; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil, errTruncated
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = fileSize - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return nil, errTruncated
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > fileSize {
+			return nil, errTruncated
+		}
+
+		boxes = append(boxes, fileBox{typ: string(header[4:8]), offset: pos, size: size})
+		pos += size
+	}
+	return boxes, nil
+}
+
+// readFileBox reads a whole box into memory
+func readFileBox(r io.ReaderAt, b fileBox) ([]byte, error) {
+	data := make([]byte, b.size)
+	if _, err := r.ReadAt(data, b.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fragment is a movie fragment: a moof box and the boxes up to and
+// including its mdat, which hold the samples it describes
+type fragment struct {
+	moof   []byte
+	offset int64 // position of the moof in its file
+	data   []fileBox
+	time   float64 // decode time of the first sample, in seconds
+}
+
+// fragmentedMP4 is a fragmented MP4 with a single track, as served for
+// YouTube's adaptive video-only and audio-only streams
+type fragmentedMP4 struct {
+	file      *os.File
+	mvhd      []byte // whole box
+	trak      []byte // whole box
+	mvex      []byte // payload
+	extra     [][]byte
+	trackID   uint32
+	timescale uint32
+	fragments []fragment
+}
+
+// openFragmentedMP4 reads the structure of a fragmented MP4 file
+func openFragmentedMP4(path string) (*fragmentedMP4, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := readFragmentedMP4(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// readFragmentedMP4 parses the moov box and indexes the fragments of file
+func readFragmentedMP4(file *os.File) (*fragmentedMP4, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	boxes, err := listFileBoxes(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &fragmentedMP4{file: file}
+	for i := 0; i < len(boxes); i++ {
+		switch boxes[i].typ {
+		case "moov":
+			moov, err := readFileBox(file, boxes[i])
+			if err != nil {
+				return nil, err
+			}
+			if err := m.parseMoov(moov); err != nil {
+				return nil, err
+			}
+
+		case "moof":
+			moof, err := readFileBox(file, boxes[i])
+			if err != nil {
+				return nil, err
+			}
+			frag := fragment{moof: moof, offset: boxes[i].offset}
+
+			// Keep the boxes between the moof and its mdat so sample
+			// offsets relative to the moof stay valid
+			for i+1 < len(boxes) && boxes[i+1].typ != "moof" {
+				i++
+				frag.data = append(frag.data, boxes[i])
+				if boxes[i].typ == "mdat" {
+					break
+				}
+			}
+			frag.time = m.decodeTime(moof)
+			m.fragments = append(m.fragments, frag)
+		}
+	}
+
+	if m.trak == nil || m.mvex == nil {
+		return nil, errNotFragmented
+	}
+	return m, nil
+}
+
+// parseMoov extracts the single track and fragment defaults from moov
+func (m *fragmentedMP4) parseMoov(moov []byte) error {
+	boxes, err := parseBoxes(moov)
+	if err != nil || len(boxes) != 1 {
+		return errTruncated
+	}
+	payload := boxes[0].payload(moov)
+
+	children, err := parseBoxes(payload)
+	if err != nil {
+		return err
+	}
+	for _, b := range children {
+		switch b.typ {
+		case "mvhd":
+			m.mvhd = b.bytes(payload)
+		case "trak":
+			if m.trak != nil {
+				return errNotFragmented
+			}
+			m.trak = b.bytes(payload)
+		case "mvex":
+			m.mvex = b.payload(payload)
+		default:
+			m.extra = append(m.extra, b.bytes(payload))
+		}
+	}
+	if m.mvhd == nil || m.trak == nil {
+		return errNotFragmented
+	}
+
+	trak, _ := findBox(m.trak, "trak")
+	tkhd, ok := findBox(trak, "tkhd")
+	if !ok {
+		return errNotFragmented
+	}
+	m.trackID = binary.BigEndian.Uint32(tkhd[trackIDOffset(tkhd):])
+
+	mdia, _ := findBox(trak, "mdia")
+	mdhd, ok := findBox(mdia, "mdhd")
+	if !ok || len(mdhd) < 24 {
+		return errNotFragmented
+	}
+	if mdhd[0] == 1 {
+		m.timescale = binary.BigEndian.Uint32(mdhd[20:])
+	} else {
+		m.timescale = binary.BigEndian.Uint32(mdhd[12:])
+	}
+	return nil
+}
+
+// decodeTime returns the start time of a fragment in seconds, or 0 if the
+// fragment doesn't say
+func (m *fragmentedMP4) decodeTime(moof []byte) float64 {
+	payload, _ := findBox(moof, "moof")
+	traf, _ := findBox(payload, "traf")
+	tfdt, ok := findBox(traf, "tfdt")
+	if !ok || len(tfdt) < 8 || m.timescale == 0 {
+		return 0
+	}
+
+	var t uint64
+	if tfdt[0] == 1 && len(tfdt) >= 12 {
+		t = binary.BigEndian.Uint64(tfdt[4:])
+	} else {
+		t = uint64(binary.BigEndian.Uint32(tfdt[4:]))
+	}
+	return float64(t) / float64(m.timescale)
+}
+
+// Close closes the underlying file
+func (m *fragmentedMP4) Close() error {
+	return m.file.Close()
+}
+
+// trackIDOffset returns where the track ID sits in a tkhd payload
+func trackIDOffset(tkhd []byte) int {
+	if tkhd[0] == 1 {
+		return 20
+	}
+	return 12
+}
+
+// MergeMP4 combines a video-only and an audio-only fragmented MP4 into a
+// single file without re-encoding. The audio track is renumbered after the
+// video track and the fragments of both are interleaved by time.
+func MergeMP4(videoPath, audioPath, outputPath string) error {
+	video, err := openFragmentedMP4(videoPath)
+	if err != nil {
+		return err
+	}
+	defer video.Close()
+
+	audio, err := openFragmentedMP4(audioPath)
+	if err != nil {
+		return err
+	}
+	defer audio.Close()
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	if err := writeMerged(out, video, audio); err != nil {
+		out.Close()
+		os.Remove(outputPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
+
+// writeMerged writes the merged movie to out
+func writeMerged(out io.Writer, video, audio *fragmentedMP4) error {
+	audioID := video.trackID + 1
+
+	// Header boxes
+	ftyp := makeBox("ftyp", []byte("isom"), []byte{0, 0, 2, 0}, []byte("isomiso6mp41"))
+	moov, err := mergedMoov(video, audio, audioID)
+	if err != nil {
+		return err
+	}
+
+	var written int64
+	for _, b := range [][]byte{ftyp, moov} {
+		n, err := out.Write(b)
+		written += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fragments of both tracks in time order
+	sequence := uint32(1)
+	v, a := 0, 0
+	for v < len(video.fragments) || a < len(audio.fragments) {
+		src, frag := video, fragment{}
+		if a < len(audio.fragments) && (v >= len(video.fragments) || audio.fragments[a].time < video.fragments[v].time) {
+			src, frag = audio, audio.fragments[a]
+			a++
+		} else {
+			frag = video.fragments[v]
+			v++
+		}
+
+		moof := append([]byte(nil), frag.moof...)
+		trackID := uint32(0)
+		if src == audio {
+			trackID = audioID
+		}
+		if err := patchMoof(moof, sequence, trackID, written-frag.offset); err != nil {
+			return err
+		}
+		sequence++
+
+		n, err := out.Write(moof)
+		written += int64(n)
+		if err != nil {
+			return err
+		}
+
+		for _, b := range frag.data {
+			n, err := io.Copy(out, io.NewSectionReader(src.file, b.offset, b.size))
+			written += n
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergedMoov builds a moov box holding the video track and the renumbered
+// audio track
+func mergedMoov(video, audio *fragmentedMP4, audioID uint32) ([]byte, error) {
+	mvhd := append([]byte(nil), video.mvhd...)
+	binary.BigEndian.PutUint32(mvhd[len(mvhd)-4:], audioID+1) // next_track_ID
+
+	audioTrak := append([]byte(nil), audio.trak...)
+	trak, _ := findBox(audioTrak, "trak")
+	tkhd, _ := findBox(trak, "tkhd")
+	binary.BigEndian.PutUint32(tkhd[trackIDOffset(tkhd):], audioID)
+
+	// Fragment defaults of both tracks
+	mvex := [][]byte{}
+	boxes, err := parseBoxes(video.mvex)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range boxes {
+		mvex = append(mvex, b.bytes(video.mvex))
+	}
+	boxes, err = parseBoxes(audio.mvex)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range boxes {
+		if b.typ != "trex" {
+			continue
+		}
+		trex := append([]byte(nil), b.bytes(audio.mvex)...)
+		if b.end-b.start < b.header+8 {
+			return nil, errTruncated
+		}
+		binary.BigEndian.PutUint32(trex[b.header+4:], audioID)
+		mvex = append(mvex, trex)
+	}
+
+	parts := [][]byte{mvhd, video.trak, audioTrak, makeBox("mvex", mvex...)}
+	parts = append(parts, video.extra...)
+	return makeBox("moov", parts...), nil
+}
+
+// patchMoof renumbers a moof in place: it sets the fragment sequence number,
+// the track ID when trackID isn't 0, and moves explicit base data offsets by
+// shift bytes
+func patchMoof(moof []byte, sequence, trackID uint32, shift int64) error {
+	boxes, err := parseBoxes(moof)
+	if err != nil || len(boxes) != 1 {
+		return errTruncated
+	}
+	payload := boxes[0].payload(moof)
+
+	children, err := parseBoxes(payload)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		switch child.typ {
+		case "mfhd":
+			mfhd := child.payload(payload)
+			if len(mfhd) < 8 {
+				return errTruncated
+			}
+			binary.BigEndian.PutUint32(mfhd[4:], sequence)
+
+		case "traf":
+			traf := child.payload(payload)
+			tfhd, ok := findBox(traf, "tfhd")
+			if !ok || len(tfhd) < 8 {
+				return errTruncated
+			}
+			if trackID != 0 {
+				binary.BigEndian.PutUint32(tfhd[4:], trackID)
+			}
+
+			// base-data-offset-present: the offset is absolute in the file
+			flags := binary.BigEndian.Uint32(tfhd) & 0xffffff
+			if flags&0x000001 != 0 {
+				if len(tfhd) < 16 {
+					return errTruncated
+				}
+				base := int64(binary.BigEndian.Uint64(tfhd[8:]))
+				binary.BigEndian.PutUint64(tfhd[8:], uint64(base+shift))
+			}
+		}
+	}
+	return nil
+}
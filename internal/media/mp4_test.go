@@ -0,0 +1,159 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// fullBox builds a box with a version/flags header
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	vf := u32(flags)
+	vf[0] = version
+	return makeBox(typ, append([][]byte{vf}, payload...)...)
+}
+
+// testStream builds a single-track fragmented MP4 with one fragment per
+// sample, starting at the given times. With absolute set, fragments use an
+// explicit base data offset pointing at their moof.
+func testStream(trackID, timescale uint32, times []uint64, samples []string, absolute bool) []byte {
+	mvhd := fullBox("mvhd", 0, 0, make([]byte, 92), u32(trackID+1))
+	tkhd := fullBox("tkhd", 0, 3, make([]byte, 8), u32(trackID), make([]byte, 68))
+	mdhd := fullBox("mdhd", 0, 0, make([]byte, 8), u32(timescale), make([]byte, 8))
+	trak := makeBox("trak", tkhd, makeBox("mdia", mdhd))
+	trex := fullBox("trex", 0, 0, u32(trackID), make([]byte, 16))
+	moov := makeBox("moov", mvhd, trak, makeBox("mvex", trex))
+
+	file := append(makeBox("ftyp", []byte("dash"), u32(0), []byte("iso6")), moov...)
+	file = append(file, fullBox("sidx", 0, 0, make([]byte, 24))...)
+
+	for i, sample := range samples {
+		var tfhd []byte
+		if absolute {
+			tfhd = fullBox("tfhd", 0, 1, u32(trackID), u64(uint64(len(file))))
+		} else {
+			tfhd = fullBox("tfhd", 0, 0x020000, u32(trackID))
+		}
+		traf := makeBox("traf", tfhd, fullBox("tfdt", 1, 0, u64(times[i])))
+		moof := makeBox("moof", fullBox("mfhd", 0, 0, u32(uint32(i+1))), traf)
+
+		file = append(file, moof...)
+		file = append(file, makeBox("mdat", []byte(sample))...)
+	}
+	return file
+}
+
+func TestMergeMP4(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "video.mp4")
+	audioPath := filepath.Join(dir, "audio.m4a")
+	outputPath := filepath.Join(dir, "merged.mp4")
+
+	// Video at 1000 ticks/s with fragments at 0s and 2s; audio at 48000
+	// ticks/s with fragments at 0s and 1s. Both streams use track ID 1.
+	os.WriteFile(videoPath, testStream(1, 1000, []uint64{0, 2000}, []string{"v0", "v2"}, false), 0644)
+	os.WriteFile(audioPath, testStream(1, 48000, []uint64{0, 48000}, []string{"a0", "a1"}, true), 0644)
+
+	if err := MergeMP4(videoPath, audioPath, outputPath); err != nil {
+		t.Fatalf("MergeMP4() error = %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes, err := parseBoxes(data)
+	if err != nil {
+		t.Fatalf("output is not valid MP4: %v", err)
+	}
+
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	want := "[ftyp moov moof mdat moof mdat moof mdat moof mdat]"
+	if got := fmt.Sprint(types); got != want {
+		t.Fatalf("boxes = %s, want %s", got, want)
+	}
+
+	// Both tracks are declared, with the audio renumbered
+	moov := boxes[1].payload(data)
+	mvhd, _ := findBox(moov, "mvhd")
+	if next := binary.BigEndian.Uint32(mvhd[len(mvhd)-4:]); next != 3 {
+		t.Errorf("next_track_ID = %d, want 3", next)
+	}
+	children, _ := parseBoxes(moov)
+	var trackIDs []uint32
+	for _, b := range children {
+		if b.typ == "trak" {
+			tkhd, _ := findBox(b.payload(moov), "tkhd")
+			trackIDs = append(trackIDs, binary.BigEndian.Uint32(tkhd[12:]))
+		}
+	}
+	if len(trackIDs) != 2 || trackIDs[0] != 1 || trackIDs[1] != 2 {
+		t.Errorf("track IDs = %v, want [1 2]", trackIDs)
+	}
+	mvex, _ := findBox(moov, "mvex")
+	trexes, _ := parseBoxes(mvex)
+	if len(trexes) != 2 || binary.BigEndian.Uint32(trexes[1].payload(mvex)[4:]) != 2 {
+		t.Errorf("mvex should hold a trex for each track")
+	}
+
+	// Fragments are interleaved by time and renumbered
+	wantTracks := []uint32{1, 2, 2, 1}
+	wantSamples := []string{"v0", "a0", "a1", "v2"}
+	for i := 0; i < 4; i++ {
+		moofBox, mdatBox := boxes[2+2*i], boxes[3+2*i]
+		moof := moofBox.payload(data)
+
+		mfhd, _ := findBox(moof, "mfhd")
+		if seq := binary.BigEndian.Uint32(mfhd[4:]); seq != uint32(i+1) {
+			t.Errorf("fragment %d sequence = %d, want %d", i, seq, i+1)
+		}
+
+		traf, _ := findBox(moof, "traf")
+		tfhd, _ := findBox(traf, "tfhd")
+		if id := binary.BigEndian.Uint32(tfhd[4:]); id != wantTracks[i] {
+			t.Errorf("fragment %d track = %d, want %d", i, id, wantTracks[i])
+		}
+		if tfhd[3]&1 != 0 {
+			// Explicit offsets must still point at the moof
+			if base := binary.BigEndian.Uint64(tfhd[8:]); base != uint64(moofBox.start) {
+				t.Errorf("fragment %d base offset = %d, want %d", i, base, moofBox.start)
+			}
+		}
+
+		if got := string(mdatBox.payload(data)); got != wantSamples[i] {
+			t.Errorf("fragment %d mdat = %q, want %q", i, got, wantSamples[i])
+		}
+	}
+}
+
+func TestMergeMP4RejectsUnfragmented(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "video.mp4")
+	audioPath := filepath.Join(dir, "audio.m4a")
+
+	os.WriteFile(videoPath, makeBox("ftyp", []byte("isom")), 0644)
+	os.WriteFile(audioPath, testStream(1, 48000, []uint64{0}, []string{"a0"}, false), 0644)
+
+	err := MergeMP4(videoPath, audioPath, filepath.Join(dir, "merged.mp4"))
+	if !errors.Is(err, errNotFragmented) {
+		t.Errorf("MergeMP4() error = %v, want %v", err, errNotFragmented)
+	}
+}
@@ -0,0 +1,652 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phetzy/yt-downloader/internal/utils"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// fileName is the name of the queue file inside the state directory
+const fileName = "queue.json"
+
+// spaceRecheckInterval is how often jobs waiting for disk space check again
+const spaceRecheckInterval = 30 * time.Second
+
+// ErrJobNotFound is returned when a job ID isn't in the queue
+var ErrJobNotFound = errors.New("job not found")
+
+// Status is the state of a job in the queue
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Job is a single download in the queue
+type Job struct {
+	ID            int            `json:"id"`
+	URL           string         `json:"url"`
+	VideoID       string         `json:"video_id"`
+	Title         string         `json:"title,omitempty"`
+	PlaylistIndex int            `json:"playlist_index,omitempty"`
+	Format        youtube.Format `json:"format"`
+	Rule          string         `json:"rule,omitempty"`
+	Destination   string         `json:"destination"`
+	File          string         `json:"file,omitempty"`
+	Status        Status         `json:"status"`
+	Error         string         `json:"error,omitempty"`
+	Skipped       bool           `json:"skipped,omitempty"`
+	Warning       string         `json:"warning,omitempty"` // post-processing steps that failed
+	AddedAt       time.Time      `json:"added_at"`
+
+	// Progress of a running job; not saved
+	Progress youtube.DownloadProgress `json:"-"`
+
+	// Waiting explains why a queued job isn't starting, e.g. because it
+	// doesn't fit on the disk yet; not saved
+	Waiting string `json:"-"`
+}
+
+// Downloader downloads a single job. *youtube.Downloader implements it.
+type Downloader interface {
+	DownloadEntry(ctx context.Context, entry youtube.PlaylistEntry, format youtube.Format, outputPath string, callback youtube.ProgressCallback) (string, error)
+}
+
+// Resolver picks the format of a job that was queued with a format rule
+// instead of a format. *youtube.Client implements it.
+type Resolver interface {
+	ResolveFormat(videoID, rule string) (youtube.Format, error)
+}
+
+// Options configures a Queue
+type Options struct {
+	// Path is the file the queue is saved to. Empty keeps it in memory.
+	Path string
+
+	// Workers is the number of jobs downloaded at the same time
+	Workers int
+
+	// Resolver picks the format of jobs added with a Rule. Their format is
+	// resolved when they start, so large playlists don't have to be fetched
+	// up front.
+	Resolver Resolver
+
+	// OnUpdate is called with a copy of a job whenever it changes,
+	// including progress updates. It must not block.
+	OnUpdate func(Job)
+
+	// DiskReserve is the free space, in bytes, jobs leave on the disk. Jobs
+	// that can't fit are refused when they're added, and jobs that don't
+	// fit next to the running ones wait until there's room.
+	DiskReserve int64
+
+	// FreeSpace returns the free space at a destination. nil uses
+	// utils.GetDiskSpace.
+	FreeSpace func(path string) (uint64, error)
+}
+
+// Queue holds download jobs and runs them on a pool of workers
+type Queue struct {
+	downloader Downloader
+	opts       Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    []*Job
+	cancels map[int]context.CancelFunc
+	active  map[int]bool // jobs a worker is on, until it has finished them
+	nextID  int
+	stop    context.CancelFunc
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// DefaultPath returns the location of the queue file in the state directory
+func DefaultPath() (string, error) {
+	dir, err := utils.GetStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+// New creates a queue, loading previously saved jobs from opts.Path
+func New(downloader Downloader, opts Options) (*Queue, error) {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+
+	q := &Queue{
+		downloader: downloader,
+		opts:       opts,
+		cancels:    make(map[int]context.CancelFunc),
+		active:     make(map[int]bool),
+		nextID:     1,
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Start launches the workers. They run until ctx is cancelled or Close is
+// called.
+func (q *Queue) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+
+	// Wake idle workers when the queue shuts down, and now and then so
+	// jobs waiting for disk space notice when some has been freed
+	go func() {
+		ticker := time.NewTicker(spaceRecheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				q.mu.Lock()
+				q.closed = true
+				q.cond.Broadcast()
+				q.mu.Unlock()
+				return
+			case <-ticker.C:
+				q.mu.Lock()
+				q.cond.Broadcast()
+				q.mu.Unlock()
+			}
+		}
+	}()
+
+	q.mu.Lock()
+	q.stop = cancel
+	q.mu.Unlock()
+}
+
+// Close stops the workers, waits for them to finish and saves the queue.
+// Jobs that were running are queued again so they resume on the next start.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if q.stop != nil {
+		q.stop()
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.saveLocked()
+}
+
+// Add queues a download. The job's URL, Destination and either Format or
+// Rule must be set; its ID, status and video ID are filled in.
+func (q *Queue) Add(job Job) (Job, error) {
+	if job.VideoID == "" {
+		videoID, err := youtube.ExtractVideoID(job.URL)
+		if err != nil {
+			return Job{}, err
+		}
+		job.VideoID = videoID
+	}
+	if job.Format.ItagNo == 0 && job.Rule != "" {
+		if _, err := youtube.ParseRule(job.Rule); err != nil {
+			return Job{}, err
+		}
+	}
+	if err := q.checkSpace(job.Destination, job.Format.TotalSize(), 0); err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job.ID = q.nextID
+	job.Status = StatusQueued
+	job.Error = ""
+	job.AddedAt = time.Now()
+	q.nextID++
+
+	added := &job
+	q.jobs = append(q.jobs, added)
+
+	q.changedLocked(added)
+	return job, q.saveLocked()
+}
+
+// Remove deletes a job from the queue, stopping it if it's running
+func (q *Queue) Remove(id int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return ErrJobNotFound
+	}
+
+	q.stopLocked(id)
+	q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+	return q.saveLocked()
+}
+
+// Move changes a job's position in the queue. Jobs nearer the front are
+// downloaded first.
+func (q *Queue) Move(id, position int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return ErrJobNotFound
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position > len(q.jobs)-1 {
+		position = len(q.jobs) - 1
+	}
+
+	job := q.jobs[i]
+	q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+	q.jobs = append(q.jobs[:position], append([]*Job{job}, q.jobs[position:]...)...)
+
+	q.cond.Broadcast()
+	return q.saveLocked()
+}
+
+// Pause holds a queued job, or stops a running one so it can be resumed
+// later from where it left off
+func (q *Queue) Pause(id int) error {
+	return q.transition(id, StatusPaused, func(job *Job) bool {
+		if job.Status == StatusRunning {
+			q.stopLocked(id)
+			return true
+		}
+		return job.Status == StatusQueued
+	})
+}
+
+// Resume queues a paused job again
+func (q *Queue) Resume(id int) error {
+	return q.transition(id, StatusQueued, func(job *Job) bool {
+		return job.Status == StatusPaused
+	})
+}
+
+// Retry queues a failed job again
+func (q *Queue) Retry(id int) error {
+	return q.transition(id, StatusQueued, func(job *Job) bool {
+		if job.Status != StatusFailed {
+			return false
+		}
+		job.Error = ""
+		return true
+	})
+}
+
+// Jobs returns a copy of every job in queue order
+func (q *Queue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// transition moves job id to status if allowed reports that it may
+func (q *Queue) transition(id int, status Status, allowed func(*Job) bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		return ErrJobNotFound
+	}
+
+	job := q.jobs[i]
+	if !allowed(job) {
+		return fmt.Errorf("cannot change a %s job to %s", job.Status, status)
+	}
+
+	job.Status = status
+	q.changedLocked(job)
+	return q.saveLocked()
+}
+
+// worker runs jobs until the queue shuts down
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		job, jobCtx := q.next(ctx)
+		if job == nil {
+			return
+		}
+
+		if job.Format.ItagNo == 0 && job.Rule != "" {
+			format, err := q.resolve(job)
+			if err != nil {
+				q.finish(ctx, job.ID, "", err)
+				continue
+			}
+			job.Format = format
+			if q.holdIfFull(job.ID) {
+				continue
+			}
+		}
+
+		entry := youtube.PlaylistEntry{Index: job.PlaylistIndex, ID: job.VideoID}
+		file, err := q.downloader.DownloadEntry(jobCtx, entry, job.Format, job.Destination, func(p youtube.DownloadProgress) {
+			q.progress(job.ID, p)
+		})
+		q.finish(ctx, job.ID, file, err)
+	}
+}
+
+// resolve picks the format of a job queued with a rule and records it, so
+// the job continues with the same format if it's interrupted
+func (q *Queue) resolve(job *Job) (youtube.Format, error) {
+	if q.opts.Resolver == nil {
+		return youtube.Format{}, fmt.Errorf("cannot choose a format for rule %q", job.Rule)
+	}
+
+	format, err := q.opts.Resolver.ResolveFormat(job.VideoID, job.Rule)
+	if err != nil {
+		return youtube.Format{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.indexLocked(job.ID); i >= 0 {
+		q.jobs[i].Format = format
+		q.notifyLocked(q.jobs[i])
+		q.saveLocked()
+	}
+	return format, nil
+}
+
+// next waits for the first queued job and marks it as running. A job that
+// was paused and resumed while its last run was still stopping waits until
+// that run has finished.
+func (q *Queue) next(ctx context.Context) (*Job, context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed || ctx.Err() != nil {
+			return nil, nil
+		}
+
+		for _, job := range q.jobs {
+			if job.Status != StatusQueued || q.active[job.ID] || !q.fitsLocked(job) {
+				continue
+			}
+			jobCtx, cancel := context.WithCancel(ctx)
+			q.cancels[job.ID] = cancel
+			q.active[job.ID] = true
+
+			job.Status = StatusRunning
+			job.Error = ""
+			job.Progress = youtube.DownloadProgress{}
+			q.changedLocked(job)
+			q.saveLocked()
+
+			copied := *job
+			return &copied, jobCtx
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// fitsLocked reports whether job fits on the disk next to the running jobs,
+// recording why it has to wait if it doesn't
+func (q *Queue) fitsLocked(job *Job) bool {
+	var committed int64
+	for _, other := range q.jobs {
+		if other.Status != StatusRunning || other.ID == job.ID {
+			continue
+		}
+		if p := other.Progress; p.TotalBytes > 0 {
+			committed += p.TotalBytes - p.BytesDownloaded
+		} else {
+			committed += other.Format.TotalSize()
+		}
+	}
+
+	waiting := ""
+	if err := q.checkSpace(job.Destination, job.Format.TotalSize(), committed); err != nil {
+		waiting = "waiting for disk space: " + err.Error()
+	}
+	if waiting != job.Waiting {
+		job.Waiting = waiting
+		q.notifyLocked(job)
+	}
+	return waiting == ""
+}
+
+// holdIfFull puts a running job back in the queue if it turned out not to
+// fit on the disk once its format was resolved
+func (q *Queue) holdIfFull(id int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexLocked(id)
+	if i < 0 || q.jobs[i].Status != StatusRunning || q.fitsLocked(q.jobs[i]) {
+		return false
+	}
+
+	q.stopLocked(id)
+	delete(q.active, id)
+	q.jobs[i].Status = StatusQueued
+	q.changedLocked(q.jobs[i])
+	q.saveLocked()
+	return true
+}
+
+// checkSpace returns an error wrapping utils.ErrDiskFull if need bytes don't
+// fit at dest next to committed bytes that running jobs are still to write
+func (q *Queue) checkSpace(dest string, need, committed int64) error {
+	if need <= 0 {
+		return nil
+	}
+
+	freeSpace := q.opts.FreeSpace
+	if freeSpace == nil {
+		freeSpace = utils.GetDiskSpace
+	}
+	free, err := freeSpace(dest)
+	if err != nil {
+		// Unknown; the download checks again when it starts
+		return nil
+	}
+
+	available := int64(free) - committed - q.opts.DiskReserve
+	if need > available {
+		return fmt.Errorf("%w: needs %s, %s available after other downloads and the reserve",
+			utils.ErrDiskFull, utils.FormatBytes(need), utils.FormatBytes(max(available, 0)))
+	}
+	return nil
+}
+
+// progress records a progress update for a running job
+func (q *Queue) progress(id int, p youtube.DownloadProgress) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.indexLocked(id); i >= 0 {
+		q.jobs[i].Progress = p
+		q.notifyLocked(q.jobs[i])
+	}
+}
+
+// finish records the outcome of a job a worker has stopped running and the
+// file it was saved to
+func (q *Queue) finish(ctx context.Context, id int, file string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// No other run of the job can have started, so the cancel func is
+	// still this run's
+	q.stopLocked(id)
+	delete(q.active, id)
+
+	i := q.indexLocked(id)
+	if i < 0 {
+		// Removed while it was running
+		return
+	}
+
+	job := q.jobs[i]
+	if job.Status != StatusRunning {
+		// Paused while it was running, and maybe resumed since; wake the
+		// workers to start it again
+		q.cond.Broadcast()
+		q.saveLocked()
+		return
+	}
+
+	job.File = file
+	job.Skipped = false
+	job.Warning = ""
+	var postErr *youtube.PostProcessError
+	switch {
+	case ctx.Err() != nil:
+		// The queue is shutting down; run it again next time
+		job.Status = StatusQueued
+	case errors.Is(err, youtube.ErrSkipped):
+		job.Status = StatusCompleted
+		job.Skipped = true
+	case errors.As(err, &postErr):
+		// The file was saved; only steps run on it afterwards failed
+		job.Status = StatusCompleted
+		job.Warning = err.Error()
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusCompleted
+	}
+
+	q.changedLocked(job)
+	q.saveLocked()
+}
+
+// stopLocked cancels job id if it's running
+func (q *Queue) stopLocked(id int) {
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+		delete(q.cancels, id)
+	}
+}
+
+// indexLocked returns the position of job id, or -1
+func (q *Queue) indexLocked(id int) int {
+	for i, job := range q.jobs {
+		if job.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// changedLocked wakes the workers and reports a status change
+func (q *Queue) changedLocked(job *Job) {
+	q.cond.Broadcast()
+	q.notifyLocked(job)
+}
+
+// notifyLocked reports a copy of job to the OnUpdate callback
+func (q *Queue) notifyLocked(job *Job) {
+	if q.opts.OnUpdate != nil {
+		q.opts.OnUpdate(*job)
+	}
+}
+
+// queueFile is the on-disk format of the queue
+type queueFile struct {
+	Jobs []*Job `json:"jobs"`
+}
+
+// load reads the saved queue. Jobs that were running when the app exited
+// are queued again.
+func (q *Queue) load() error {
+	if q.opts.Path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(q.opts.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var saved queueFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid queue file %s: %w", q.opts.Path, err)
+	}
+
+	for _, job := range saved.Jobs {
+		if job.Status == StatusRunning {
+			job.Status = StatusQueued
+		}
+		if job.ID >= q.nextID {
+			q.nextID = job.ID + 1
+		}
+	}
+	q.jobs = saved.Jobs
+	return nil
+}
+
+// saveLocked writes the pending, paused and failed jobs to disk. Completed
+// jobs are only kept for the current session.
+func (q *Queue) saveLocked() error {
+	if q.opts.Path == "" {
+		return nil
+	}
+
+	saved := queueFile{Jobs: []*Job{}}
+	for _, job := range q.jobs {
+		if job.Status != StatusCompleted {
+			saved.Jobs = append(saved.Jobs, job)
+		}
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := utils.EnsureDir(filepath.Dir(q.opts.Path)); err != nil {
+		return err
+	}
+
+	tmp := q.opts.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.opts.Path)
+}
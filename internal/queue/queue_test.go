@@ -0,0 +1,359 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phetzy/yt-downloader/internal/utils"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+const testURL = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+
+// fakeDownloader blocks each download until it's released with a result
+type fakeDownloader struct {
+	mu      sync.Mutex
+	started chan string
+	results map[string]chan error
+
+	// unwind, if set, holds cancelled downloads until it's closed, as
+	// a download cleaning up would
+	unwind chan struct{}
+}
+
+func newFakeDownloader() *fakeDownloader {
+	return &fakeDownloader{
+		started: make(chan string, 10),
+		results: make(map[string]chan error),
+	}
+}
+
+func (f *fakeDownloader) result(destination string) chan error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.results[destination]; !ok {
+		f.results[destination] = make(chan error, 1)
+	}
+	return f.results[destination]
+}
+
+func (f *fakeDownloader) DownloadEntry(ctx context.Context, entry youtube.PlaylistEntry, format youtube.Format, outputPath string, callback youtube.ProgressCallback) (string, error) {
+	f.started <- outputPath
+	callback(youtube.DownloadProgress{BytesDownloaded: 1, TotalBytes: 2})
+
+	select {
+	case err := <-f.result(outputPath):
+		return outputPath, err
+	case <-ctx.Done():
+		if f.unwind != nil {
+			<-f.unwind
+		}
+		return outputPath, ctx.Err()
+	}
+}
+
+// waitFor polls until the job reaches status
+func waitFor(t *testing.T, q *Queue, id int, status Status) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, job := range q.Jobs() {
+			if job.ID == id && job.Status == status {
+				return job
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %d never reached status %s: %+v", id, status, q.Jobs())
+	return Job{}
+}
+
+func TestQueueRunsJobs(t *testing.T) {
+	d := newFakeDownloader()
+	q, err := New(d, Options{Workers: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	q.Start(context.Background())
+	defer q.Close()
+
+	ok, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18}, Destination: "ok"})
+	bad, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18}, Destination: "bad"})
+
+	// Jobs run in queue order on the single worker
+	if got := <-d.started; got != "ok" {
+		t.Fatalf("first job started = %s, want ok", got)
+	}
+	d.result("ok") <- nil
+	waitFor(t, q, ok.ID, StatusCompleted)
+
+	<-d.started
+	d.result("bad") <- errors.New("boom")
+	failed := waitFor(t, q, bad.ID, StatusFailed)
+	if failed.Error != "boom" {
+		t.Errorf("Error = %q, want boom", failed.Error)
+	}
+
+	// Retrying runs the job again
+	if err := q.Retry(bad.ID); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	<-d.started
+	d.result("bad") <- nil
+	waitFor(t, q, bad.ID, StatusCompleted)
+}
+
+func TestQueueSkippedJob(t *testing.T) {
+	d := newFakeDownloader()
+	q, _ := New(d, Options{Workers: 1})
+	q.Start(context.Background())
+	defer q.Close()
+
+	job, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18}, Destination: "video"})
+	<-d.started
+	d.result("video") <- youtube.ErrSkipped
+
+	done := waitFor(t, q, job.ID, StatusCompleted)
+	if !done.Skipped || done.Error != "" || done.File != "video" {
+		t.Errorf("job = %+v, want a completed, skipped job with its file", done)
+	}
+}
+
+func TestQueuePostProcessingWarning(t *testing.T) {
+	d := newFakeDownloader()
+	q, _ := New(d, Options{Workers: 1})
+	q.Start(context.Background())
+	defer q.Close()
+
+	job, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18}, Destination: "video"})
+	<-d.started
+	d.result("video") <- &youtube.PostProcessError{Steps: []*youtube.StepError{{Step: "tag", Err: errors.New("boom")}}}
+
+	done := waitFor(t, q, job.ID, StatusCompleted)
+	if done.Warning != "post-processing failed: tag: boom" || done.Error != "" || done.File != "video" {
+		t.Errorf("job = %+v, want a completed job with a warning", done)
+	}
+}
+
+func TestQueuePauseAndResume(t *testing.T) {
+	d := newFakeDownloader()
+	q, _ := New(d, Options{Workers: 1})
+	q.Start(context.Background())
+	defer q.Close()
+
+	job, _ := q.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "video"})
+	<-d.started
+	waitFor(t, q, job.ID, StatusRunning)
+
+	if err := q.Pause(job.ID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	waitFor(t, q, job.ID, StatusPaused)
+
+	if err := q.Retry(job.ID); err == nil {
+		t.Error("Retry() should only accept failed jobs")
+	}
+
+	if err := q.Resume(job.ID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	<-d.started
+	d.result("video") <- nil
+	waitFor(t, q, job.ID, StatusCompleted)
+}
+
+func TestQueueResumeWhileStopping(t *testing.T) {
+	d := newFakeDownloader()
+	d.unwind = make(chan struct{})
+	q, _ := New(d, Options{Workers: 2})
+	q.Start(context.Background())
+	defer q.Close()
+	var unwound sync.Once
+	defer unwound.Do(func() { close(d.unwind) })
+
+	job, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18}, Destination: "video"})
+	<-d.started
+	waitFor(t, q, job.ID, StatusRunning)
+
+	// Resume before the paused download has stopped
+	if err := q.Pause(job.ID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if err := q.Resume(job.ID); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	select {
+	case <-d.started:
+		t.Fatal("job started again while its last run was still stopping")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once it has, the job runs again undisturbed
+	unwound.Do(func() { close(d.unwind) })
+	<-d.started
+	waitFor(t, q, job.ID, StatusRunning)
+	d.result("video") <- nil
+	if got := waitFor(t, q, job.ID, StatusCompleted); got.Error != "" {
+		t.Errorf("job error = %q, want none", got.Error)
+	}
+}
+
+func TestQueueMoveAndRemove(t *testing.T) {
+	q, _ := New(newFakeDownloader(), Options{})
+
+	a, _ := q.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "a"})
+	b, _ := q.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "b"})
+	c, _ := q.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "c"})
+
+	if err := q.Move(c.ID, 0); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if err := q.Remove(a.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	jobs := q.Jobs()
+	if len(jobs) != 2 || jobs[0].ID != c.ID || jobs[1].ID != b.ID {
+		t.Errorf("Jobs() = %+v, want c then b", jobs)
+	}
+
+	if err := q.Remove(a.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Remove() error = %v, want %v", err, ErrJobNotFound)
+	}
+}
+
+func TestQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	d := newFakeDownloader()
+
+	q, _ := New(d, Options{Path: path, Workers: 1})
+	q.Start(context.Background())
+
+	running, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 22}, Destination: "running"})
+	<-d.started
+	waitFor(t, q, running.ID, StatusRunning)
+	pending, _ := q.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "pending"})
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reloaded, err := New(d, Options{Path: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	jobs := reloaded.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("reloaded %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].ID != running.ID || jobs[0].Status != StatusQueued || jobs[0].Format.ItagNo != 22 {
+		t.Errorf("interrupted job = %+v, want it queued again", jobs[0])
+	}
+	if jobs[1].ID != pending.ID || jobs[1].Status != StatusQueued {
+		t.Errorf("pending job = %+v, want it queued", jobs[1])
+	}
+
+	// New jobs don't reuse saved IDs
+	added, _ := reloaded.Add(Job{URL: testURL, Format: youtube.Format{}, Destination: "new"})
+	if added.ID <= pending.ID {
+		t.Errorf("new job ID = %d, want > %d", added.ID, pending.ID)
+	}
+}
+
+// fakeResolver picks a fixed format for every rule
+type fakeResolver struct {
+	format youtube.Format
+}
+
+func (r fakeResolver) ResolveFormat(videoID, rule string) (youtube.Format, error) {
+	if rule != "720p" {
+		return youtube.Format{}, errors.New("unexpected rule")
+	}
+	return r.format, nil
+}
+
+func TestQueueResolvesRule(t *testing.T) {
+	d := newFakeDownloader()
+	q, _ := New(d, Options{Workers: 1, Resolver: fakeResolver{youtube.Format{ItagNo: 22}}})
+	q.Start(context.Background())
+	defer q.Close()
+
+	job, _ := q.Add(Job{URL: testURL, Rule: "720p", Destination: "video"})
+	<-d.started
+	running := waitFor(t, q, job.ID, StatusRunning)
+	if running.Format.ItagNo != 22 {
+		t.Errorf("Format.ItagNo = %d, want 22", running.Format.ItagNo)
+	}
+
+	bad, _ := q.Add(Job{URL: testURL, Rule: "best", Destination: "bad"})
+	d.result("video") <- nil
+	failed := waitFor(t, q, bad.ID, StatusFailed)
+	if failed.Error != "unexpected rule" {
+		t.Errorf("Error = %q, want unexpected rule", failed.Error)
+	}
+
+	// Rules that can't be parsed are refused when they're added
+	if _, err := q.Add(Job{URL: testURL, Rule: "best[fps>30]", Destination: "video"}); err == nil {
+		t.Error("Add() accepted an invalid rule")
+	}
+}
+
+func TestQueueDiskSpace(t *testing.T) {
+	var mu sync.Mutex
+	free := uint64(100)
+	setFree := func(n uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		free = n
+	}
+
+	d := newFakeDownloader()
+	q, _ := New(d, Options{Workers: 1, DiskReserve: 10, FreeSpace: func(string) (uint64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return free, nil
+	}})
+	q.Start(context.Background())
+	defer q.Close()
+
+	// Jobs that can never fit are refused
+	_, err := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18, FileSize: 95}, Destination: "huge"})
+	if !errors.Is(err, utils.ErrDiskFull) {
+		t.Fatalf("Add() error = %v, want ErrDiskFull", err)
+	}
+
+	first, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18, FileSize: 50}, Destination: "first"})
+	<-d.started
+	second, _ := q.Add(Job{URL: testURL, Format: youtube.Format{ItagNo: 18, FileSize: 50}, Destination: "second"})
+
+	// The first download used the space the second one needs
+	setFree(50)
+	d.result("first") <- nil
+	waitFor(t, q, first.ID, StatusCompleted)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job := waitFor(t, q, second.ID, StatusQueued)
+		if job.Waiting != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %+v, want it waiting for disk space", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Once there's room it starts with the next change to the queue
+	setFree(100)
+	q.Add(Job{URL: testURL, Rule: "best", Destination: "third"})
+	if started := <-d.started; started != "second" {
+		t.Errorf("started %q, want the waiting job", started)
+	}
+}
@@ -1,11 +1,17 @@
 package tui
 
 import (
+	"context"
+	"time"
+
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/config"
+	"github.com/phetzy/yt-downloader/internal/queue"
+	"github.com/phetzy/yt-downloader/internal/youtube"
 )
 
 // AppState represents the current state of the application
@@ -19,8 +25,20 @@ const (
 	StateDownloading
 	StateComplete
 	StateError
+	StateQueue
+	StatePlaylistSelect
+	StatePlaylistFormat
+	StateFileExists
 )
 
+// stallThreshold is how long a download may go without data before the
+// downloading screen reports it as stalled
+const stallThreshold = 3 * time.Second
+
+// sparklineWidth is how many seconds of speed history the downloading
+// screen draws
+const sparklineWidth = 60
+
 // Model is the main application model for Bubble Tea
 type Model struct {
 	// Application state
@@ -28,6 +46,11 @@ type Model struct {
 	err     error
 	width   int
 	height  int
+	config  *config.Config
+	
+	// client is shared by every screen and the queue, so a video fetched to
+	// list its formats is reused when it's downloaded
+	client *youtube.Client
 	
 	// Component states
 	urlInput    textinput.Model
@@ -41,24 +64,68 @@ type Model struct {
 	selectedFormat interface{}
 	downloadPath   string
 	
+	// Playlist state
+	playlist         *youtube.PlaylistInfo
+	playlistSelected []bool
+	playlistIdx      int
+	playlistRule     string
+	ruleIdx          int
+	rangeInput       textinput.Model
+	editingRange     bool
+	rangeErr         error
+	selectorInput    textinput.Model
+	editingSelector  bool
+	selectorErr      error
+	
 	// Directory picker state
 	currentDir     string
 	directories    []string
 	selectedDirIdx int
+	readOnlyDirs   map[string]bool // entries of directories that can't be written to
+	dirErr         error
 	
 	// Progress tracking
 	downloadProgress float64
-	downloadSpeed    float64 // bytes per second
+	downloadSpeed    float64   // bytes per second
+	averageSpeed     float64   // bytes per second since the download started
+	speedHistory     []float64 // speed sampled every second, for the sparkline
 	bytesDownloaded  int64
 	totalBytes       int64
 	downloadETA      int // seconds
+	reconnectAttempt int // attempt at reopening a dropped stream, 0 if none
+	reconnectMax     int
+	downloadEvent    string   // latest notable event, e.g. a refreshed stream URL
+	postStep         string   // post-processing step under way, e.g. "merge (1/2)"
+	postWarnings     []string // post-processing steps that failed
+	downloadUpdates  <-chan tea.Msg
+	lastProgressAt   time.Time
+	
+	// Cancellation of the running download
+	cancelDownload  context.CancelFunc
+	cancelling      bool
+	quitAfterCancel bool
+	
+	// Download queue
+	queue        *queue.Queue
+	queueUpdates <-chan struct{}
+	queueErr     error
+	jobs         []queue.Job
+	jobBars      map[int]progress.Model
+	selectedJob  int
+	queueMode    bool // new downloads are added to the queue
+	
+	// Existing file confirmation
+	collision    youtube.CollisionPolicy
+	existingFile string
+	existsIdx    int
+	skipped      bool // the file was already there and kept
 	
 	// Flags
 	quitting    bool
 }
 
 // NewApp creates and initializes a new application model
-func NewApp() *Model {
+func NewApp(cfg *config.Config) *Model {
 	// Initialize URL input
 	ti := textinput.New()
 	ti.Placeholder = "https://www.youtube.com/watch?v=..."
@@ -82,6 +149,8 @@ func NewApp() *Model {
 	
 	return &Model{
 		state:       StateURLInput,
+		config:      cfg,
+		client:      cfg.NewClient(),
 		urlInput:    ti,
 		spinner:     s,
 		qualityList: l,
@@ -91,7 +160,7 @@ func NewApp() *Model {
 
 // Init initializes the application
 func (m *Model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, openQueue(m.config, m.client))
 }
 
 // Update handles messages and updates the model
@@ -102,10 +171,33 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 		return m, nil
 		
+	case queueOpenedMsg:
+		m.queue = msg.queue
+		m.queueUpdates = msg.updates
+		m.queueErr = msg.err
+		m.refreshJobs()
+		return m, waitForQueue(m.queueUpdates)
+		
+	case queueUpdatedMsg:
+		// Jobs keep running whatever screen is showing
+		m.refreshJobs()
+		return m, waitForQueue(m.queueUpdates)
+		
+	case jobAddedMsg:
+		m.queueErr = nil
+		m.refreshJobs()
+		for i, job := range m.jobs {
+			if job.ID == msg.job.ID {
+				m.selectedJob = i
+			}
+		}
+		return m, nil
+		
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q":
-			if m.state == StateURLInput || m.state == StateComplete || m.state == StateError {
+			if m.state == StateURLInput || m.state == StateComplete || m.state == StateError || m.state == StateQueue ||
+				m.state == StateFileExists {
 				m.quitting = true
 				return m, tea.Quit
 			}
@@ -136,6 +228,14 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateComplete(msg)
 	case StateError:
 		return m.updateError(msg)
+	case StateQueue:
+		return m.updateQueue(msg)
+	case StatePlaylistSelect:
+		return m.updatePlaylistSelect(msg)
+	case StatePlaylistFormat:
+		return m.updatePlaylistFormat(msg)
+	case StateFileExists:
+		return m.updateFileExists(msg)
 	}
 	
 	return m, nil
@@ -163,6 +263,14 @@ func (m *Model) View() string {
 		return m.viewComplete()
 	case StateError:
 		return m.viewError()
+	case StateQueue:
+		return m.viewQueue()
+	case StatePlaylistSelect:
+		return m.viewPlaylistSelect()
+	case StatePlaylistFormat:
+		return m.viewPlaylistFormat()
+	case StateFileExists:
+		return m.viewFileExists()
 	}
 	
 	return ""
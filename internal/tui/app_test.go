@@ -1,13 +1,22 @@
 package tui
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/config"
+	"github.com/phetzy/yt-downloader/internal/queue"
+	"github.com/phetzy/yt-downloader/internal/media"
+	"github.com/phetzy/yt-downloader/internal/youtube"
 )
 
 func TestNewApp(t *testing.T) {
-	app := NewApp()
+	app := NewApp(config.Default())
 	
 	if app == nil {
 		t.Fatal("NewApp() returned nil")
@@ -29,7 +38,7 @@ func TestNewApp(t *testing.T) {
 }
 
 func TestStateTransitions(t *testing.T) {
-	app := NewApp()
+	app := NewApp(config.Default())
 	
 	tests := []struct {
 		name      string
@@ -78,6 +87,11 @@ func TestURLValidation(t *testing.T) {
 			url:   "https://youtu.be/dQw4w9WgXcQ",
 			valid: true,
 		},
+		{
+			name:  "Valid playlist URL",
+			url:   "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			valid: true,
+		},
 		{
 			name:  "Invalid URL",
 			url:   "https://example.com",
@@ -169,6 +183,83 @@ func TestQualityItemImplementation(t *testing.T) {
 	}
 }
 
+func TestQualityItemMergedFormat(t *testing.T) {
+	item := qualityItem{
+		format: FormatInfo{
+			Quality:     "1080p",
+			Resolution:  "1920x1080",
+			Format:      "mp4",
+			FileSize:    1024,
+			HasVideo:    true,
+			AudioFormat: "m4a",
+		},
+	}
+	
+	if got := item.Title(); got != "📹 1080p + best audio" {
+		t.Errorf("Title() = %q, want the paired audio", got)
+	}
+	if got := item.Description(); got != "1920x1080 - mp4 + m4a - 1.00 KB" {
+		t.Errorf("Description() = %q", got)
+	}
+}
+
+func TestToFormatInfosKeepsItags(t *testing.T) {
+	formats := []youtube.Format{
+		{ItagNo: 136, Quality: "720p", Extension: "mp4", HasVideo: true},
+		{ItagNo: 247, Quality: "720p", Extension: "webm", HasVideo: true},
+	}
+	
+	infos := toFormatInfos(formats)
+	for i, info := range infos {
+		if info.ItagNo != formats[i].ItagNo || info.Source.ItagNo != formats[i].ItagNo || info.ID != fmt.Sprint(formats[i].ItagNo) {
+			t.Errorf("format %d = %+v, want itag %d", i, info, formats[i].ItagNo)
+		}
+	}
+	if infos[0].ID == infos[1].ID {
+		t.Error("formats with the same quality label share an ID")
+	}
+}
+
+func TestAudioExtractionItems(t *testing.T) {
+	formats := []youtube.Format{
+		{ItagNo: 140, Quality: "Audio - High", Extension: "m4a", MimeType: `audio/mp4; codecs="mp4a.40.2"`, IsAudioOnly: true, HasAudio: true, Bitrate: 128000, FileSize: 1024},
+	}
+	
+	infos := toFormatInfos(withAudioExtractions(formats))
+	if len(infos) != 1+len(media.AudioFormats) {
+		t.Fatalf("got %d formats, want the stream and %d extractions", len(infos), len(media.AudioFormats))
+	}
+	ids := make(map[string]bool)
+	for _, info := range infos {
+		if ids[info.ID] {
+			t.Errorf("duplicate ID %q", info.ID)
+		}
+		ids[info.ID] = true
+	}
+	
+	item := qualityItem{format: infos[1]}
+	if got := item.Title(); got != "🎵 Extract audio → MP3 320k" {
+		t.Errorf("Title() = %q", got)
+	}
+	if got := item.Description(); got != "mp3 from the best audio - about 1.00 KB" {
+		t.Errorf("Description() = %q", got)
+	}
+	if infos[1].Source.ExtractAudio != media.AudioMP3 {
+		t.Errorf("Source = %+v, want it extracting mp3", infos[1].Source)
+	}
+}
+
+func TestQualityItemTooLarge(t *testing.T) {
+	item := qualityItem{format: FormatInfo{Quality: "2160p", Format: "webm", FileSize: 1024, HasVideo: true, TooLarge: true}}
+	
+	if got := item.Title(); !strings.Contains(got, "won't fit") {
+		t.Errorf("Title() = %q, want it marked as not fitting", got)
+	}
+	if got := item.Description(); !strings.Contains(got, "not enough disk space") {
+		t.Errorf("Description() = %q, want the reason", got)
+	}
+}
+
 func TestConvertFormatsToItems(t *testing.T) {
 	formats := []FormatInfo{
 		{
@@ -201,3 +292,481 @@ func TestConvertFormatsToItems(t *testing.T) {
 		}
 	}
 }
+
+func TestDownloadProgressUpdates(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateDownloading
+	
+	updates := make(chan tea.Msg, 1)
+	_, cmd := app.Update(downloadStartedMsg{updates: updates})
+	if cmd == nil {
+		t.Fatal("downloadStartedMsg should start listening for updates")
+	}
+	
+	_, cmd = app.Update(downloadProgressMsg{
+		BytesDownloaded: 50,
+		TotalBytes:      100,
+		Speed:           10,
+		ETA:             5,
+	})
+	if app.state != StateDownloading {
+		t.Errorf("state = %v, want %v", app.state, StateDownloading)
+	}
+	if app.downloadProgress != 0.5 {
+		t.Errorf("downloadProgress = %v, want 0.5", app.downloadProgress)
+	}
+	if cmd == nil {
+		t.Error("progress update should keep listening for more updates")
+	}
+	
+	// A dropped stream being reopened replaces the speed
+	_, _ = app.Update(downloadProgressMsg{BytesDownloaded: 50, TotalBytes: 100, Attempt: 2, MaxAttempts: 5})
+	if view := app.View(); !strings.Contains(view, "reconnecting (2/5)") {
+		t.Errorf("view should show the reconnect attempt:\n%s", view)
+	}
+	
+	_, _ = app.Update(downloadProgressMsg{BytesDownloaded: 60, TotalBytes: 100, Event: "stream URL expired, refreshed it"})
+	if view := app.View(); !strings.Contains(view, "stream URL expired, refreshed it") {
+		t.Errorf("view should show the latest event:\n%s", view)
+	}
+	
+	// A final progress update must not end the download before the
+	// completion message arrives with the file path
+	_, _ = app.Update(downloadProgressMsg{BytesDownloaded: 100, TotalBytes: 100})
+	if app.state != StateDownloading {
+		t.Errorf("state after 100%% = %v, want %v", app.state, StateDownloading)
+	}
+	
+	_, _ = app.Update(downloadProgressMsg{BytesDownloaded: 100, TotalBytes: 100, Step: "merge", StepNumber: 1, Steps: 2})
+	if view := app.View(); !strings.Contains(view, "Processing: merge (1/2)") {
+		t.Errorf("view should show the post-processing step:\n%s", view)
+	}
+	
+	_, _ = app.Update(downloadCompleteMsg{FilePath: "/tmp/video.mp4", Warnings: []string{"tag: ffmpeg is required to tag files"}})
+	if app.state != StateComplete {
+		t.Errorf("state = %v, want %v", app.state, StateComplete)
+	}
+	if app.downloadPath != "/tmp/video.mp4" {
+		t.Errorf("downloadPath = %v, want /tmp/video.mp4", app.downloadPath)
+	}
+	if view := app.View(); !strings.Contains(view, "tag: ffmpeg is required to tag files") {
+		t.Errorf("complete screen should list the failed steps:\n%s", view)
+	}
+}
+
+func TestErrorScreenFailedStep(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateError
+	app.err = fmt.Errorf("download failed: %w", &youtube.StepError{Step: "convert", Err: fmt.Errorf("%w to convert audio to MP3 320k", media.ErrFFmpegRequired)})
+	
+	view := app.View()
+	for _, want := range []string{"The convert step failed", "set ffmpeg_path"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("error screen should mention %q:\n%s", want, view)
+		}
+	}
+}
+
+func TestSpeedSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 1, 2, 4, 8}); got != "▁▂▃▅█" {
+		t.Errorf("sparkline() = %q, want %q", got, "▁▂▃▅█")
+	}
+	if got := sparkline([]float64{0, 0}); got != "▁▁" {
+		t.Errorf("sparkline() of no speed = %q, want %q", got, "▁▁")
+	}
+	
+	app := NewApp(config.Default())
+	app.state = StateDownloading
+	app.Update(downloadProgressMsg{BytesDownloaded: 10, TotalBytes: 100, Speed: 2048, AverageSpeed: 1024})
+	for i := 0; i < sparklineWidth+5; i++ {
+		app.Update(downloadTickMsg(time.Now()))
+	}
+	if len(app.speedHistory) != sparklineWidth {
+		t.Errorf("history holds %d samples, want %d", len(app.speedHistory), sparklineWidth)
+	}
+	
+	view := app.View()
+	if !strings.Contains(view, "2.00 KB/s (average 1.00 KB/s)") {
+		t.Errorf("view should show the current and average speed:\n%s", view)
+	}
+	if !strings.Contains(view, "History:    █") {
+		t.Errorf("view should draw the speed history:\n%s", view)
+	}
+}
+
+func TestSendLatestCoalescesUpdates(t *testing.T) {
+	updates := make(chan tea.Msg, 1)
+	
+	for i := int64(1); i <= 3; i++ {
+		sendLatest(updates, downloadProgressMsg{BytesDownloaded: i})
+	}
+	
+	msg := (<-updates).(downloadProgressMsg)
+	if msg.BytesDownloaded != 3 {
+		t.Errorf("BytesDownloaded = %v, want 3", msg.BytesDownloaded)
+	}
+}
+
+func TestCancelDownload(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateDownloading
+	app.videoInfo = videoInfoMsg{Title: "Test"}
+	
+	cancelled := false
+	app.cancelDownload = func() { cancelled = true }
+	
+	_, cmd := app.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	if !cancelled {
+		t.Error("cancel key should cancel the download context")
+	}
+	if cmd != nil {
+		t.Error("cancelling should not quit the app")
+	}
+	if app.state != StateDownloading {
+		t.Errorf("state = %v, want %v until the download stops", app.state, StateDownloading)
+	}
+	
+	_, _ = app.Update(downloadCancelledMsg{})
+	if app.state != StateQualitySelect {
+		t.Errorf("state = %v, want %v", app.state, StateQualitySelect)
+	}
+	if app.quitting {
+		t.Error("app should not quit after cancelling a download")
+	}
+}
+
+func TestQuitDuringDownload(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateDownloading
+	
+	cancelled := false
+	app.cancelDownload = func() { cancelled = true }
+	
+	_, _ = app.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if !cancelled {
+		t.Error("quitting should cancel the running download")
+	}
+	
+	// The app quits once the download has cleaned up
+	_, cmd := app.Update(downloadCancelledMsg{})
+	if !app.quitting || cmd == nil {
+		t.Error("app should quit after the cancelled download stops")
+	}
+}
+
+// newTestQueue returns an in-memory queue with no workers, so its jobs stay
+// where the test puts them
+func newTestQueue(t *testing.T, titles ...string) *queue.Queue {
+	t.Helper()
+	
+	q, err := queue.New(nil, queue.Options{})
+	if err != nil {
+		t.Fatalf("queue.New() error = %v", err)
+	}
+	for _, title := range titles {
+		if _, err := q.Add(queue.Job{URL: "https://youtu.be/dQw4w9WgXcQ", Title: title}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	return q
+}
+
+func key(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestQueueDashboardKeys(t *testing.T) {
+	app := NewApp(config.Default())
+	app.Update(queueOpenedMsg{queue: newTestQueue(t, "first", "second")})
+	app.state = StateQueue
+	
+	// Move the first job down and keep it selected
+	app.Update(key("J"))
+	if app.jobs[1].Title != "first" || app.selectedJob != 1 {
+		t.Fatalf("jobs = %+v, selected %d; want first moved down and selected", app.jobs, app.selectedJob)
+	}
+	
+	app.Update(key("p"))
+	if app.jobs[1].Status != queue.StatusPaused {
+		t.Errorf("status = %s, want %s", app.jobs[1].Status, queue.StatusPaused)
+	}
+	
+	app.Update(key("r"))
+	if app.jobs[1].Status != queue.StatusQueued {
+		t.Errorf("status = %s, want %s", app.jobs[1].Status, queue.StatusQueued)
+	}
+	
+	// Retrying a job that hasn't failed is reported on the dashboard
+	app.Update(key("R"))
+	if app.queueErr == nil {
+		t.Error("retrying a queued job should report an error")
+	}
+	
+	app.Update(key("x"))
+	if len(app.jobs) != 1 || app.jobs[0].Title != "second" {
+		t.Errorf("jobs = %+v, want only second", app.jobs)
+	}
+	if app.selectedJob != 0 {
+		t.Errorf("selectedJob = %d, want 0", app.selectedJob)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit = "2MB"
+	app := NewApp(cfg)
+	app.state = StateDownloading
+	limiter := cfg.RateLimiter()
+	
+	tests := []struct {
+		key  string
+		want int64
+	}{
+		{"[", 1 << 20},
+		{"[", 512 << 10},
+		{"]", 1 << 20},
+		{"]", 2 << 20},
+		{"]", 5 << 20},
+		{"=", 2 << 20},
+	}
+	for _, tt := range tests {
+		app.Update(key(tt.key))
+		if got, _ := limiter.Limit(); got != tt.want {
+			t.Errorf("limit after %q = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+	
+	if limiter.Overridden() {
+		t.Error("= should go back to the configured limit")
+	}
+	if view := app.View(); !strings.Contains(view, "Limit:      2.00 MB/s") {
+		t.Errorf("view should show the limit:\n%s", view)
+	}
+	
+	// Past the fastest step the limit is lifted
+	if got := fasterRate(50 << 20); got != 0 {
+		t.Errorf("fasterRate(50MB) = %d, want unlimited", got)
+	}
+	if got := slowerRate(0); got != 50<<20 {
+		t.Errorf("slowerRate(unlimited) = %d, want 50MB", got)
+	}
+}
+
+func TestQueueUpdatesRefreshOnAnyScreen(t *testing.T) {
+	app := NewApp(config.Default())
+	q := newTestQueue(t)
+	app.Update(queueOpenedMsg{queue: q})
+	app.state = StateDownloading
+	
+	q.Add(queue.Job{URL: "https://youtu.be/dQw4w9WgXcQ", Title: "added"})
+	app.Update(queueUpdatedMsg{})
+	
+	if len(app.jobs) != 1 {
+		t.Errorf("jobs = %+v, want the added job", app.jobs)
+	}
+	if app.state != StateDownloading {
+		t.Errorf("state = %v, want %v", app.state, StateDownloading)
+	}
+}
+
+func TestDownloadAnotherUsesQueue(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateComplete
+	
+	app.Update(key("n"))
+	if app.state != StateURLInput || !app.queueMode {
+		t.Fatalf("state = %v, queueMode = %v; want URL input in queue mode", app.state, app.queueMode)
+	}
+	
+	// Choosing a folder now adds to the queue instead of replacing the
+	// download; without a queue that is reported on the dashboard
+	app.currentDir = t.TempDir()
+	app.state = StateDirectoryPicker
+	app.Update(key(" "))
+	if app.state != StateQueue {
+		t.Errorf("state = %v, want %v", app.state, StateQueue)
+	}
+	if app.cancelDownload != nil {
+		t.Error("queue mode should not start a download directly")
+	}
+	if app.queueErr == nil {
+		t.Error("missing queue should be reported")
+	}
+}
+
+func TestParseIndexRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{name: "Single index", spec: "3", want: []int{2}},
+		{name: "Range and index", spec: "1-3, 5", want: []int{0, 1, 2, 4}},
+		{name: "Overlapping ranges", spec: "2-3,1-2", want: []int{0, 1, 2}},
+		{name: "Out of bounds", spec: "4-6", wantErr: true},
+		{name: "Backwards range", spec: "3-1", wantErr: true},
+		{name: "Not a number", spec: "one", wantErr: true},
+		{name: "Empty", spec: " , ", wantErr: true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIndexRanges(tt.spec, 5)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIndexRanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) && !tt.wantErr {
+				t.Errorf("parseIndexRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaylistSelection(t *testing.T) {
+	app := NewApp(config.Default())
+	app.Update(queueOpenedMsg{queue: newTestQueue(t)})
+	app.state = StateLoading
+	
+	info := &youtube.PlaylistInfo{Title: "Mix"}
+	for i, id := range []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"} {
+		info.Entries = append(info.Entries, youtube.PlaylistEntry{Index: i + 1, ID: id, Title: id})
+	}
+	
+	// A watch URL inside the playlist selects just that video
+	app.Update(playlistInfoMsg{info: info, current: "bbbbbbbbbbb"})
+	if app.state != StatePlaylistSelect || app.selectedCount() != 1 || !app.playlistSelected[1] {
+		t.Fatalf("state = %v, selected = %v; want only the current video", app.state, app.playlistSelected)
+	}
+	
+	app.Update(key("a"))
+	if app.selectedCount() != 3 {
+		t.Errorf("select all selected %d, want 3", app.selectedCount())
+	}
+	
+	// Ranges replace the selection
+	app.Update(key("/"))
+	for _, r := range "1,3" {
+		app.Update(key(string(r)))
+	}
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if app.editingRange || fmt.Sprint(app.playlistSelected) != "[true false true]" {
+		t.Fatalf("selected = %v, want entries 1 and 3", app.playlistSelected)
+	}
+	
+	// One rule for every entry, then a single folder
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	app.Update(key("j"))
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if app.state != StateDirectoryPicker || app.playlistRule != "1080p" {
+		t.Fatalf("state = %v, rule = %q; want directory picker with 1080p", app.state, app.playlistRule)
+	}
+	
+	app.currentDir = t.TempDir()
+	_, cmd := app.Update(key(" "))
+	if app.state != StateQueue || cmd == nil {
+		t.Fatalf("state = %v, want %v with a command to queue the entries", app.state, StateQueue)
+	}
+	app.Update(cmd())
+	
+	if len(app.jobs) != 2 {
+		t.Fatalf("queued %d jobs, want 2", len(app.jobs))
+	}
+	for _, job := range app.jobs {
+		if job.Rule != "1080p" || job.Destination != app.currentDir {
+			t.Errorf("job = %+v, want rule 1080p in %s", job, app.currentDir)
+		}
+	}
+}
+
+func TestPlaylistCustomSelector(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateLoading
+	info := &youtube.PlaylistInfo{Title: "Mix", Entries: []youtube.PlaylistEntry{{Index: 1, ID: "aaaaaaaaaaa"}}}
+	app.Update(playlistInfoMsg{info: info})
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	
+	for range playlistRules {
+		app.Update(key("j"))
+	}
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !app.editingSelector {
+		t.Fatal("choosing the custom selector didn't open the input")
+	}
+	
+	// Invalid selectors are reported without leaving the screen
+	app.selectorInput.SetValue("bestvideo[fps>30]")
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if app.state != StatePlaylistFormat || app.selectorErr == nil {
+		t.Fatalf("state = %v, err = %v; want an error on the format screen", app.state, app.selectorErr)
+	}
+	
+	app.selectorInput.SetValue("bv[height<=720]+ba/best")
+	app.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if app.state != StateDirectoryPicker || app.playlistRule != "bv[height<=720]+ba/best" {
+		t.Fatalf("state = %v, rule = %q; want the directory picker with the selector", app.state, app.playlistRule)
+	}
+}
+
+func TestDirectoryPickerRejectsUnwritableFolder(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateDirectoryPicker
+	app.currentDir = filepath.Join(t.TempDir(), "missing")
+	
+	app.Update(key(" "))
+	if app.state != StateDirectoryPicker || app.dirErr == nil || !errors.Is(app.dirErr, ErrPermissionDenied) {
+		t.Fatalf("state = %v, err = %v; want an inline error in the picker", app.state, app.dirErr)
+	}
+	if !strings.Contains(app.viewDirectoryPicker(), "choose another folder") {
+		t.Error("the picker doesn't show the error")
+	}
+	
+	// Moving on clears the error
+	app.Update(key("j"))
+	if app.dirErr != nil {
+		t.Errorf("dirErr = %v after navigating, want nil", app.dirErr)
+	}
+}
+
+func TestFileExistsDialog(t *testing.T) {
+	app := NewApp(config.Default())
+	app.state = StateDownloading
+	
+	app.Update(fileExistsMsg{path: "/downloads/video.mp4"})
+	if app.state != StateFileExists || app.existingFile != "/downloads/video.mp4" {
+		t.Fatalf("state = %v, file = %q; want the existing file dialog", app.state, app.existingFile)
+	}
+	
+	// Skipping keeps the file without downloading
+	app.Update(key("s"))
+	if app.state != StateComplete || !app.skipped || app.downloadPath != "/downloads/video.mp4" {
+		t.Errorf("state = %v, skipped = %v, path = %q; want the existing file kept", app.state, app.skipped, app.downloadPath)
+	}
+	if app.cancelDownload != nil {
+		t.Error("skipping should not start a download")
+	}
+	
+	// Overwriting downloads again with that policy
+	app.showFileExists("/downloads/video.mp4")
+	app.Update(key("o"))
+	if app.state != StateDownloading || app.collision != youtube.CollisionOverwrite {
+		t.Errorf("state = %v, collision = %q; want a download that overwrites", app.state, app.collision)
+	}
+	app.cancelDownload()
+	
+	// Escape goes back to choose another folder
+	app.showFileExists("/downloads/video.mp4")
+	app.Update(key("esc"))
+	if app.state != StateDirectoryPicker {
+		t.Errorf("state = %v, want %v", app.state, StateDirectoryPicker)
+	}
+	
+	// Both quit keys work in the dialog
+	for _, msg := range []tea.KeyMsg{key("q"), {Type: tea.KeyCtrlC}} {
+		app.showFileExists("/downloads/video.mp4")
+		app.quitting = false
+		if _, cmd := app.Update(msg); !app.quitting || cmd == nil {
+			t.Errorf("%s in the file exists dialog should quit", msg)
+		}
+	}
+}
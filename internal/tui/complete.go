@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -12,15 +13,13 @@ func (m *Model) updateComplete(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "enter", "n":
-			// Download another video
-			m.state = StateURLInput
-			m.err = nil
-			m.videoURL = ""
-			m.videoInfo = nil
-			m.selectedFormat = nil
-			m.downloadPath = ""
-			m.urlInput.SetValue("")
-			m.urlInput.Focus()
+			// Download another video; from now on downloads go to the queue
+			m.queueMode = true
+			m.showURLInput()
+			return m, nil
+		case "d":
+			// Show the download queue
+			m.state = StateQueue
 			return m, nil
 		case "o":
 			// Open folder (to be implemented)
@@ -36,22 +35,41 @@ func (m *Model) viewComplete() string {
 	var b strings.Builder
 	
 	b.WriteString("\n\n")
-	b.WriteString(RenderSuccess("✅ Download Complete!"))
+	if m.skipped {
+		b.WriteString(RenderSuccess("✅ Already Downloaded"))
+	} else {
+		b.WriteString(RenderSuccess("✅ Download Complete!"))
+	}
 	b.WriteString("\n\n")
 	
 	// Display download location
-	if m.downloadPath != "" {
+	if m.skipped && m.downloadPath == "" {
+		b.WriteString("This video is listed in your download archive.\n")
+	} else if m.skipped {
+		b.WriteString("Kept the existing file:\n")
+		b.WriteString(RenderBox(m.downloadPath, false))
+	} else if m.downloadPath != "" {
 		b.WriteString("File saved to:\n")
 		b.WriteString(RenderBox(m.downloadPath, false))
 	} else {
 		b.WriteString("File saved successfully!\n")
 	}
 	
+	if len(m.postWarnings) > 0 {
+		b.WriteString("\n")
+		b.WriteString(RenderError("⚠️  Some post-processing steps failed:"))
+		b.WriteString("\n")
+		for _, warning := range m.postWarnings {
+			b.WriteString(fmt.Sprintf("  • %s\n", warning))
+		}
+	}
+	
 	b.WriteString("\n\n")
 	
 	// Options
 	b.WriteString("What would you like to do?\n\n")
-	b.WriteString("  • Press Enter or N to download another video\n")
+	b.WriteString("  • Press Enter or N to queue another video\n")
+	b.WriteString("  • Press D to view the download queue\n")
 	b.WriteString("  • Press O to open download folder\n")
 	b.WriteString("  • Press Q or Ctrl+C to quit\n")
 	
@@ -0,0 +1,382 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/config"
+	"github.com/phetzy/yt-downloader/internal/queue"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// jobBarWidth is the width of the progress bar drawn for each active job
+const jobBarWidth = 40
+
+// updateQueue handles updates for the queue dashboard state
+func (m *Model) updateQueue(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case errMsg:
+		// Adding a job failed; show it on the dashboard
+		m.queueErr = msg.err
+		return m, nil
+		
+	case tea.KeyMsg:
+		if m.updateRateLimit(msg.String()) {
+			return m, nil
+		}
+		switch msg.String() {
+		case "up", "k":
+			if m.selectedJob > 0 {
+				m.selectedJob--
+			}
+			return m, nil
+			
+		case "down", "j":
+			if m.selectedJob < len(m.jobs)-1 {
+				m.selectedJob++
+			}
+			return m, nil
+			
+		case "a":
+			// Add another video to the queue
+			m.queueMode = true
+			m.showURLInput()
+			return m, nil
+			
+		case "esc":
+			m.showURLInput()
+			return m, nil
+			
+		case "p":
+			return m, m.updateJob(m.queue.Pause)
+			
+		case "r":
+			return m, m.updateJob(m.queue.Resume)
+			
+		case "R":
+			return m, m.updateJob(m.queue.Retry)
+			
+		case "x", "delete":
+			return m, m.updateJob(m.queue.Remove)
+			
+		case "K", "shift+up":
+			return m, m.moveJob(-1)
+			
+		case "J", "shift+down":
+			return m, m.moveJob(1)
+		}
+	}
+	
+	return m, nil
+}
+
+// showURLInput returns to the URL input screen for another video
+func (m *Model) showURLInput() {
+	m.state = StateURLInput
+	m.err = nil
+	m.videoURL = ""
+	m.videoInfo = nil
+	m.selectedFormat = nil
+	m.downloadPath = ""
+	m.playlist = nil
+	m.playlistSelected = nil
+	m.qualityList.SetItems(nil)
+	m.urlInput.SetValue("")
+	m.urlInput.Focus()
+}
+
+// selected returns the job under the cursor
+func (m *Model) selected() (queue.Job, bool) {
+	if m.queue == nil || m.selectedJob < 0 || m.selectedJob >= len(m.jobs) {
+		return queue.Job{}, false
+	}
+	return m.jobs[m.selectedJob], true
+}
+
+// updateJob applies action to the selected job and reports any error on the
+// dashboard
+func (m *Model) updateJob(action func(id int) error) tea.Cmd {
+	job, ok := m.selected()
+	if !ok {
+		return nil
+	}
+	
+	m.queueErr = action(job.ID)
+	m.refreshJobs()
+	return nil
+}
+
+// moveJob moves the selected job up or down the queue and keeps it selected
+func (m *Model) moveJob(delta int) tea.Cmd {
+	job, ok := m.selected()
+	if !ok {
+		return nil
+	}
+	
+	m.queueErr = m.queue.Move(job.ID, m.selectedJob+delta)
+	m.refreshJobs()
+	for i, j := range m.jobs {
+		if j.ID == job.ID {
+			m.selectedJob = i
+		}
+	}
+	return nil
+}
+
+// refreshJobs takes a fresh snapshot of the queue
+func (m *Model) refreshJobs() {
+	if m.queue == nil {
+		return
+	}
+	
+	m.jobs = m.queue.Jobs()
+	if m.selectedJob >= len(m.jobs) {
+		m.selectedJob = len(m.jobs) - 1
+	}
+	if m.selectedJob < 0 {
+		m.selectedJob = 0
+	}
+	
+	// Drop the bars of jobs that are no longer running
+	running := make(map[int]bool)
+	for _, job := range m.jobs {
+		if job.Status == queue.StatusRunning {
+			running[job.ID] = true
+		}
+	}
+	for id := range m.jobBars {
+		if !running[id] {
+			delete(m.jobBars, id)
+		}
+	}
+}
+
+// jobBar returns the progress bar of a running job, creating it on first use
+func (m *Model) jobBar(id int) progress.Model {
+	if m.jobBars == nil {
+		m.jobBars = make(map[int]progress.Model)
+	}
+	
+	bar, ok := m.jobBars[id]
+	if !ok {
+		bar = progress.New(progress.WithDefaultGradient(), progress.WithWidth(jobBarWidth))
+		m.jobBars[id] = bar
+	}
+	return bar
+}
+
+// Close stops the download queue and saves it so unfinished jobs continue
+// the next time the app starts
+func (m *Model) Close() error {
+	if m.queue == nil {
+		return nil
+	}
+	return m.queue.Close()
+}
+
+// openQueue loads the saved queue and starts its workers. The queue signals
+// changes on the returned channel; bursts of updates are coalesced into one.
+func openQueue(cfg *config.Config, client *youtube.Client) tea.Cmd {
+	return func() tea.Msg {
+		path, err := queue.DefaultPath()
+		if err != nil {
+			return queueOpenedMsg{err: err}
+		}
+		
+		updates := make(chan struct{}, 1)
+		q, err := queue.New(cfg.NewDownloader(client), queue.Options{
+			Path:        path,
+			Workers:     cfg.QueueWorkers,
+			Resolver:    client,
+			DiskReserve: cfg.DiskReserve(),
+			OnUpdate: func(queue.Job) {
+				select {
+				case updates <- struct{}{}:
+				default:
+				}
+			},
+		})
+		if err != nil {
+			return queueOpenedMsg{err: fmt.Errorf("failed to load download queue: %w", err)}
+		}
+		
+		q.Start(context.Background())
+		return queueOpenedMsg{queue: q, updates: updates}
+	}
+}
+
+// waitForQueue waits for the next change to the queue
+func waitForQueue(updates <-chan struct{}) tea.Cmd {
+	if updates == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		if _, ok := <-updates; !ok {
+			return nil
+		}
+		return queueUpdatedMsg{}
+	}
+}
+
+// enqueueDownload adds the chosen video and format to the queue and shows
+// the dashboard
+func (m *Model) enqueueDownload() tea.Cmd {
+	m.state = StateQueue
+	if m.queue == nil {
+		m.queueErr = fmt.Errorf("download queue is not available")
+		return nil
+	}
+	
+	q := m.queue
+	videoURL := m.videoURL
+	selectedFormat := m.selectedFormat
+	downloadPath := m.downloadPath
+	client := m.client
+	
+	return func() tea.Msg {
+		videoInfo, format, err := resolveFormat(client, videoURL, selectedFormat)
+		if err != nil {
+			return errMsg{err: err}
+		}
+		
+		job, err := q.Add(queue.Job{
+			URL:         videoURL,
+			VideoID:     videoInfo.ID,
+			Title:       videoInfo.Title,
+			Format:      format,
+			Destination: downloadPath,
+		})
+		if err != nil {
+			return errMsg{err: fmt.Errorf("failed to queue download: %w", err)}
+		}
+		return jobAddedMsg{job: job}
+	}
+}
+
+// viewQueue renders the queue dashboard
+func (m *Model) viewQueue() string {
+	var b strings.Builder
+	
+	b.WriteString("\n")
+	b.WriteString(RenderTitle("📋 Download Queue"))
+	b.WriteString("\n\n")
+	
+	// Summary of every job by status
+	counts := make(map[queue.Status]int)
+	for _, job := range m.jobs {
+		counts[job.Status]++
+	}
+	b.WriteString(fmt.Sprintf("%d active • %d queued • %d paused • %d completed • %d failed\n",
+		counts[queue.StatusRunning], counts[queue.StatusQueued], counts[queue.StatusPaused],
+		counts[queue.StatusCompleted], counts[queue.StatusFailed]))
+	b.WriteString(fmt.Sprintf("Speed limit: %s\n\n", m.viewRateLimit()))
+	
+	if len(m.jobs) == 0 {
+		b.WriteString("The queue is empty. Press A to add a video.\n")
+	}
+	
+	for i, job := range m.jobs {
+		status := string(job.Status)
+		switch {
+		case job.Skipped:
+			status = "already downloaded"
+		case job.Status == queue.StatusQueued && job.Waiting != "":
+			status = "waiting for disk space"
+		}
+		line := fmt.Sprintf("%s %s (%s) — %s", jobIcon(job.Status), jobTitle(job), job.Format.Quality, status)
+		if i == m.selectedJob {
+			b.WriteString(selectedItemStyle.Render(line))
+		} else {
+			b.WriteString(normalItemStyle.Render(line))
+		}
+		b.WriteString("\n")
+		
+		switch job.Status {
+		case queue.StatusRunning:
+			b.WriteString(normalItemStyle.Render(m.viewJobProgress(job)))
+			b.WriteString("\n")
+		case queue.StatusFailed:
+			b.WriteString(normalItemStyle.Render(RenderError(job.Error)))
+			b.WriteString("\n")
+		case queue.StatusCompleted:
+			if job.Warning != "" {
+				b.WriteString(normalItemStyle.Render(RenderHelp("⚠️  " + job.Warning)))
+				b.WriteString("\n")
+			}
+		case queue.StatusQueued:
+			if job.Waiting != "" {
+				b.WriteString(normalItemStyle.Render(RenderHelp(job.Waiting)))
+				b.WriteString("\n")
+			}
+		}
+	}
+	
+	if m.queueErr != nil {
+		b.WriteString("\n")
+		b.WriteString(RenderError(m.queueErr.Error()))
+		b.WriteString("\n")
+	}
+	
+	b.WriteString("\n")
+	helpText := "↑/↓ to select • P pause • R resume • Shift+R retry • X cancel • Shift+↑/↓ reorder • [/] speed limit • A add video • Esc back"
+	b.WriteString(RenderHelp(helpText))
+	
+	content := b.String()
+	if m.width > 0 {
+		content = Center(m.width, content)
+	}
+	
+	return containerStyle.Render(content)
+}
+
+// viewJobProgress renders the progress bar, speed and ETA of a running job
+func (m *Model) viewJobProgress(job queue.Job) string {
+	p := job.Progress
+	
+	var percent float64
+	if p.TotalBytes > 0 {
+		percent = float64(p.BytesDownloaded) / float64(p.TotalBytes)
+	}
+	
+	stats := "calculating..."
+	if p.Step != "" {
+		stats = "processing: " + stepStatus(p.Step, p.StepNumber, p.Steps)
+	} else if p.Attempt > 0 {
+		stats = reconnectStatus(p.Attempt, p.MaxAttempts)
+	} else if p.Speed > 0 {
+		stats = formatSpeed(p.Speed)
+		if p.ETA > 0 {
+			stats += " • ETA " + formatDuration(p.ETA)
+		}
+	}
+	
+	bar := m.jobBar(job.ID)
+	return fmt.Sprintf("%s %5.1f%%  %s", bar.ViewAs(percent), percent*100, stats)
+}
+
+// jobIcon returns the icon shown next to a job with the given status
+func jobIcon(status queue.Status) string {
+	switch status {
+	case queue.StatusRunning:
+		return "⬇️ "
+	case queue.StatusPaused:
+		return "⏸️ "
+	case queue.StatusCompleted:
+		return "✅"
+	case queue.StatusFailed:
+		return "❌"
+	default:
+		return "⏳"
+	}
+}
+
+// jobTitle returns the name shown for a job
+func jobTitle(job queue.Job) string {
+	if job.Title != "" {
+		return job.Title
+	}
+	return job.URL
+}
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -11,44 +12,111 @@ import (
 // updateDownloading handles updates for the downloading state
 func (m *Model) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case downloadStartedMsg:
+		// Start listening for updates from the download goroutine
+		m.downloadUpdates = msg.updates
+		m.lastProgressAt = time.Now()
+		return m, tea.Batch(waitForDownload(m.downloadUpdates), downloadTick())
+		
 	case downloadProgressMsg:
 		// Update progress tracking
 		m.bytesDownloaded = msg.BytesDownloaded
 		m.totalBytes = msg.TotalBytes
 		m.downloadSpeed = msg.Speed
+		m.averageSpeed = msg.AverageSpeed
 		m.downloadETA = msg.ETA
+		m.reconnectAttempt = msg.Attempt
+		m.reconnectMax = msg.MaxAttempts
+		m.downloadEvent = msg.Event
+		m.postStep = stepStatus(msg.Step, msg.StepNumber, msg.Steps)
+		m.lastProgressAt = time.Now()
 		
 		// Calculate progress percentage
 		if msg.TotalBytes > 0 {
 			m.downloadProgress = float64(msg.BytesDownloaded) / float64(msg.TotalBytes)
 		}
 		
-		// Check if download is complete
-		if msg.BytesDownloaded >= msg.TotalBytes {
-			m.state = StateComplete
-			return m, nil
-		}
+		// Keep listening; completion is signalled by downloadCompleteMsg
+		return m, waitForDownload(m.downloadUpdates)
 		
-		// Continue receiving progress updates
-		return m, nil
+	case downloadTickMsg:
+		// Keep ticking so the view can show a stalled transfer
+		m.sampleSpeed()
+		return m, downloadTick()
 		
 	case downloadCompleteMsg:
+		m.finishDownload()
+		if m.quitAfterCancel {
+			m.quitting = true
+			return m, tea.Quit
+		}
 		m.downloadPath = msg.FilePath
+		m.skipped = msg.Skipped
+		m.postWarnings = msg.Warnings
 		m.downloadProgress = 1.0
 		m.state = StateComplete
 		return m, nil
 		
+	case fileExistsMsg:
+		m.finishDownload()
+		if m.quitAfterCancel {
+			m.quitting = true
+			return m, tea.Quit
+		}
+		m.showFileExists(msg.path)
+		return m, nil
+		
+	case downloadCancelledMsg:
+		m.finishDownload()
+		if m.quitAfterCancel {
+			m.quitting = true
+			return m, tea.Quit
+		}
+		
+		// Go back to pick a different quality, or a new URL
+		m.resetProgress()
+		if m.videoInfo != nil {
+			m.state = StateQualitySelect
+		} else {
+			m.state = StateURLInput
+			m.urlInput.Focus()
+		}
+		return m, nil
+		
 	case errMsg:
+		m.finishDownload()
+		if m.quitAfterCancel {
+			m.quitting = true
+			return m, tea.Quit
+		}
 		m.err = msg.err
 		m.state = StateError
 		return m, nil
 		
 	case tea.KeyMsg:
+		if m.updateRateLimit(msg.String()) {
+			return m, nil
+		}
 		switch msg.String() {
-		case "ctrl+c":
-			// Cancel download
-			m.quitting = true
-			return m, tea.Quit
+		case "esc", "c":
+			// Cancel the download but keep the app running
+			if m.cancelDownload != nil && !m.cancelling {
+				m.cancelling = true
+				m.cancelDownload()
+			}
+			return m, nil
+			
+		case "ctrl+c", "q":
+			// Quit once the download has stopped and cleaned up,
+			// or straight away if asked a second time
+			if m.cancelDownload == nil || m.quitAfterCancel {
+				m.quitting = true
+				return m, tea.Quit
+			}
+			m.quitAfterCancel = true
+			m.cancelling = true
+			m.cancelDownload()
+			return m, nil
 		}
 		
 	case tea.WindowSizeMsg:
@@ -59,6 +127,87 @@ func (m *Model) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// beginDownload switches to the downloading screen and starts a download
+// that can be cancelled from there
+func (m *Model) beginDownload() tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelDownload = cancel
+	m.cancelling = false
+	m.quitAfterCancel = false
+	m.resetProgress()
+	m.state = StateDownloading
+	m.skipped = false
+	return startDownload(ctx, m.config, m.client, m.videoURL, m.selectedFormat, m.downloadPath, m.collision)
+}
+
+// finishDownload releases the resources of the download that just ended
+func (m *Model) finishDownload() {
+	if m.cancelDownload != nil {
+		m.cancelDownload()
+		m.cancelDownload = nil
+	}
+	m.downloadUpdates = nil
+	m.cancelling = false
+}
+
+// resetProgress clears the progress of the previous download
+func (m *Model) resetProgress() {
+	m.downloadProgress = 0
+	m.bytesDownloaded = 0
+	m.totalBytes = 0
+	m.downloadSpeed = 0
+	m.averageSpeed = 0
+	m.speedHistory = nil
+	m.downloadETA = 0
+	m.reconnectAttempt = 0
+	m.reconnectMax = 0
+	m.downloadEvent = ""
+	m.postStep = ""
+	m.lastProgressAt = time.Time{}
+}
+
+// waitForDownload waits for the next message from the download goroutine
+func waitForDownload(updates <-chan tea.Msg) tea.Cmd {
+	if updates == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-updates
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// downloadTick schedules the next stall check
+func downloadTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return downloadTickMsg(t)
+	})
+}
+
+// sampleSpeed records the current speed for the sparkline. A stalled or
+// reconnecting download counts as no speed at all.
+func (m *Model) sampleSpeed() {
+	speed := m.downloadSpeed
+	if m.isStalled() || m.reconnectAttempt > 0 {
+		speed = 0
+	}
+	m.speedHistory = append(m.speedHistory, speed)
+	if len(m.speedHistory) > sparklineWidth {
+		m.speedHistory = m.speedHistory[len(m.speedHistory)-sparklineWidth:]
+	}
+}
+
+// isStalled reports whether no data has arrived for a while
+func (m *Model) isStalled() bool {
+	if m.lastProgressAt.IsZero() || m.downloadProgress >= 1.0 {
+		return false
+	}
+	return time.Since(m.lastProgressAt) >= stallThreshold
+}
+
 // viewDownloading renders the download progress screen
 func (m *Model) viewDownloading() string {
 	var b strings.Builder
@@ -88,8 +237,16 @@ func (m *Model) viewDownloading() string {
 	}
 	
 	// Display speed using formatSpeed function
-	if m.downloadSpeed > 0 {
+	if m.reconnectAttempt > 0 {
+		b.WriteString(fmt.Sprintf("Speed:      %s\n", reconnectStatus(m.reconnectAttempt, m.reconnectMax)))
+	} else if m.isStalled() {
+		stalledFor := int(time.Since(m.lastProgressAt).Seconds())
+		b.WriteString(fmt.Sprintf("Speed:      stalled (no data for %s)\n", formatDuration(stalledFor)))
+	} else if m.downloadSpeed > 0 {
 		speedStr := formatSpeed(m.downloadSpeed)
+		if m.averageSpeed > 0 {
+			speedStr += fmt.Sprintf(" (average %s)", formatSpeed(m.averageSpeed))
+		}
 		b.WriteString(fmt.Sprintf("Speed:      %s\n", speedStr))
 	} else {
 		b.WriteString("Speed:      calculating...\n")
@@ -103,9 +260,24 @@ func (m *Model) viewDownloading() string {
 	} else {
 		b.WriteString("ETA:        --\n")
 	}
+	b.WriteString(fmt.Sprintf("Limit:      %s\n", m.viewRateLimit()))
+	if m.postStep != "" {
+		b.WriteString(fmt.Sprintf("Processing: %s\n", m.postStep))
+	}
+	if len(m.speedHistory) > 1 {
+		b.WriteString(fmt.Sprintf("History:    %s\n", sparkline(m.speedHistory)))
+	}
+	if m.downloadEvent != "" {
+		b.WriteString(RenderHelp(fmt.Sprintf("Note:       %s", m.downloadEvent)))
+		b.WriteString("\n")
+	}
+	
+	if m.cancelling {
+		b.WriteString("\nCancelling download...\n")
+	}
 	
 	b.WriteString("\n")
-	helpText := "Ctrl+C to cancel download"
+	helpText := "[/] speed limit • Esc or C to cancel download • Ctrl+C or Q to quit"
 	b.WriteString(RenderHelp(helpText))
 	
 	content := b.String()
@@ -116,6 +288,41 @@ func (m *Model) viewDownloading() string {
 	return containerStyle.Render(content)
 }
 
+// sparklineLevels are the bars a sparkline is drawn with, lowest first
+var sparklineLevels = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws values as a row of bars scaled to the largest one
+func sparkline(values []float64) string {
+	var peak float64
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if peak > 0 {
+			level = int(v / peak * float64(len(sparklineLevels)-1) + 0.5)
+		}
+		bars[i] = sparklineLevels[level]
+	}
+	return string(bars)
+}
+
+// reconnectStatus describes a dropped stream being reopened
+func reconnectStatus(attempt, maxAttempts int) string {
+	return fmt.Sprintf("reconnecting (%d/%d)", attempt, maxAttempts)
+}
+
+// stepStatus describes the post-processing step under way, or returns ""
+// while the download is still running
+func stepStatus(step string, number, steps int) string {
+	if step == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%d/%d)", step, number, steps)
+}
+
 // formatDuration formats a duration in seconds to human-readable format
 func formatDuration(seconds int) string {
 	duration := time.Duration(seconds) * time.Second
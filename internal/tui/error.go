@@ -1,9 +1,13 @@
 package tui
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/media"
+	"github.com/phetzy/yt-downloader/internal/youtube"
 )
 
 // updateError handles updates for the error state
@@ -35,6 +39,16 @@ func (m *Model) viewError() string {
 	// Display the error message
 	if m.err != nil {
 		b.WriteString(m.err.Error())
+		if errors.Is(m.err, ErrDiskFull) {
+			b.WriteString("\n\nFree up some space or choose another folder.")
+		}
+		var step *youtube.StepError
+		if errors.As(m.err, &step) {
+			b.WriteString(fmt.Sprintf("\n\nThe %s step failed, so the file wasn't saved.", step.Step))
+		}
+		if errors.Is(m.err, media.ErrFFmpegRequired) {
+			b.WriteString("\n\nInstall ffmpeg or set ffmpeg_path in the config file.")
+		}
 	} else {
 		b.WriteString("An unknown error occurred")
 	}
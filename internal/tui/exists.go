@@ -0,0 +1,117 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// existsChoice is an option of the existing file dialog
+type existsChoice struct {
+	key    string
+	label  string
+	policy youtube.CollisionPolicy
+}
+
+// existsChoices are the ways to deal with a file that's already there
+var existsChoices = []existsChoice{
+	{"r", "Keep both (save with a number added)", youtube.CollisionRename},
+	{"o", "Overwrite the existing file", youtube.CollisionOverwrite},
+	{"s", "Skip (keep the existing file)", youtube.CollisionSkip},
+}
+
+// showFileExists asks what to do about a download that would replace path
+func (m *Model) showFileExists(path string) {
+	m.existingFile = path
+	m.existsIdx = 0
+	m.resetProgress()
+	m.state = StateFileExists
+}
+
+// updateFileExists handles updates for the existing file dialog
+func (m *Model) updateFileExists(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	
+	switch keyMsg.String() {
+	case "up", "k":
+		if m.existsIdx > 0 {
+			m.existsIdx--
+		}
+		return m, nil
+		
+	case "down", "j":
+		if m.existsIdx < len(existsChoices)-1 {
+			m.existsIdx++
+		}
+		return m, nil
+		
+	case "enter":
+		return m, m.resolveFileExists(existsChoices[m.existsIdx].policy)
+		
+	case "esc":
+		// Pick another folder
+		m.state = StateDirectoryPicker
+		return m, nil
+	}
+	
+	for _, choice := range existsChoices {
+		if keyMsg.String() == choice.key {
+			return m, m.resolveFileExists(choice.policy)
+		}
+	}
+	return m, nil
+}
+
+// resolveFileExists carries out the user's choice for the existing file
+func (m *Model) resolveFileExists(policy youtube.CollisionPolicy) tea.Cmd {
+	if policy == youtube.CollisionSkip {
+		// The user has seen the file; keep it whatever its size
+		m.downloadPath = m.existingFile
+		m.skipped = true
+		m.state = StateComplete
+		return nil
+	}
+	
+	m.collision = policy
+	return m.beginDownload()
+}
+
+// viewFileExists renders the existing file dialog
+func (m *Model) viewFileExists() string {
+	var b strings.Builder
+	
+	b.WriteString("\n")
+	b.WriteString(RenderTitle("⚠️  File Already Exists"))
+	b.WriteString("\n\n")
+	
+	b.WriteString(fmt.Sprintf("%s is already in this folder:\n", filepath.Base(m.existingFile)))
+	b.WriteString(RenderBox(m.existingFile, false))
+	b.WriteString("\n\n")
+	
+	for i, choice := range existsChoices {
+		line := fmt.Sprintf("[%s] %s", strings.ToUpper(choice.key), choice.label)
+		if i == m.existsIdx {
+			b.WriteString(selectedItemStyle.Render("▶ " + line))
+		} else {
+			b.WriteString(normalItemStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+	
+	b.WriteString("\n")
+	helpText := "↑/↓ to navigate • Enter or R/O/S to choose • Esc to pick another folder • Ctrl+C or Q to quit"
+	b.WriteString(RenderHelp(helpText))
+	
+	content := b.String()
+	if m.width > 0 {
+		content = Center(m.width, content)
+	}
+	
+	return containerStyle.Render(content)
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/youtube"
 )
 
 // updateURLInput handles updates for the URL input state
@@ -19,15 +20,24 @@ func (m *Model) updateURLInput(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if isValidYouTubeURL(url) {
 				m.videoURL = url
 				m.state = StateLoading
+				fetch := fetchVideoInfo(m.client, url)
+				if _, err := youtube.ExtractPlaylistID(url); err == nil {
+					fetch = fetchPlaylistInfo(m.client, url)
+				}
 				return m, tea.Batch(
 					m.spinner.Tick,
-					fetchVideoInfo(url),
+					fetch,
 				)
 			} else if url != "" {
 				m.err = ErrInvalidURL
 				m.state = StateError
 				return m, nil
 			}
+		case "tab":
+			// Show the download queue
+			m.state = StateQueue
+			m.urlInput.Blur()
+			return m, nil
 		case "ctrl+u":
 			// Clear input
 			m.urlInput.SetValue("")
@@ -68,7 +78,7 @@ func (m *Model) viewURLInput() string {
 	b.WriteString("\n\n")
 	
 	// Help text
-	helpText := "Press Enter to continue • Ctrl+U to clear • Ctrl+C to quit"
+	helpText := "Press Enter to continue • Ctrl+U to clear • Tab for queue • Ctrl+C to quit"
 	b.WriteString(RenderHelp(helpText))
 	
 	// Center the content
@@ -86,5 +96,6 @@ func isValidYouTubeURL(url string) bool {
 	return strings.Contains(url, "youtube.com/watch") ||
 		strings.Contains(url, "youtu.be/") ||
 		strings.Contains(url, "youtube.com/v/") ||
-		strings.Contains(url, "youtube.com/embed/")
+		strings.Contains(url, "youtube.com/embed/") ||
+		strings.Contains(url, "youtube.com/playlist?list=")
 }
@@ -19,25 +19,45 @@ func (i qualityItem) FilterValue() string {
 
 // Title returns the title of the item
 func (i qualityItem) Title() string {
-	if i.format.IsAudioOnly {
-		return fmt.Sprintf("🎵 %s", i.format.Quality)
+	title := fmt.Sprintf("📹 %s", i.format.Quality)
+	if i.format.ExtractAudio != "" {
+		title = fmt.Sprintf("🎵 Extract audio → %s", i.format.ExtractAudio)
+	} else if i.format.IsAudioOnly {
+		title = fmt.Sprintf("🎵 %s", i.format.Quality)
+	} else if i.format.AudioFormat != "" {
+		title = fmt.Sprintf("📹 %s + best audio", i.format.Quality)
+	}
+	
+	if i.format.TooLarge {
+		title += " ⚠️  won't fit"
 	}
-	return fmt.Sprintf("📹 %s", i.format.Quality)
+	return title
 }
 
 // Description returns the description of the item
 func (i qualityItem) Description() string {
 	size := formatBytes(i.format.FileSize)
+	if i.format.TooLarge {
+		size += " (not enough disk space)"
+	}
+	container := i.format.Format
+	if i.format.AudioFormat != "" {
+		container = fmt.Sprintf("%s + %s", i.format.Format, i.format.AudioFormat)
+	}
 	
+	if i.format.ExtractAudio != "" {
+		// The size of the stream it's converted from
+		return fmt.Sprintf("%s from the best audio - about %s", i.format.Format, size)
+	}
 	if i.format.IsAudioOnly {
 		return fmt.Sprintf("%s - %s", i.format.Format, size)
 	}
 	
 	if i.format.Resolution != "" {
-		return fmt.Sprintf("%s - %s - %s", i.format.Resolution, i.format.Format, size)
+		return fmt.Sprintf("%s - %s - %s", i.format.Resolution, container, size)
 	}
 	
-	return fmt.Sprintf("%s - %s", i.format.Format, size)
+	return fmt.Sprintf("%s - %s", container, size)
 }
 
 // convertFormatsToItems converts FormatInfo slice to list items
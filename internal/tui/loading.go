@@ -11,10 +11,16 @@ func (m *Model) updateLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case videoInfoMsg:
 		// Video info fetched successfully
+		m.markFormatsTooLarge(msg.Formats)
 		m.videoInfo = msg
 		m.state = StateQualitySelect
 		return m, nil
 		
+	case playlistInfoMsg:
+		// Playlist fetched; choose which entries to download
+		m.showPlaylist(msg.info, msg.current)
+		return m, nil
+		
 	case errMsg:
 		// Error occurred while fetching video info
 		m.err = msg.err
@@ -3,8 +3,13 @@ package tui
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/media"
+	"github.com/phetzy/yt-downloader/internal/queue"
+	"github.com/phetzy/yt-downloader/internal/utils"
 	"github.com/phetzy/yt-downloader/internal/youtube"
 )
 
@@ -14,7 +19,7 @@ var (
 	ErrVideoNotFound        = errors.New("video not found or unavailable")
 	ErrNetworkError         = errors.New("network error occurred")
 	ErrPermissionDenied     = errors.New("permission denied")
-	ErrDiskFull             = errors.New("not enough disk space")
+	ErrDiskFull             = utils.ErrDiskFull
 	ErrAgeRestricted        = errors.New("video is age-restricted or requires sign-in")
 	ErrVideoUnavailable     = errors.New("video is unavailable in your region or requires authentication")
 )
@@ -33,14 +38,29 @@ type videoInfoMsg struct {
 
 // FormatInfo contains information about a video format
 type FormatInfo struct {
-	ID          string
-	Quality     string
-	Resolution  string
-	Format      string
-	FileSize    int64
-	IsAudioOnly bool
-	HasVideo    bool
-	HasAudio    bool
+	ID           string
+	ItagNo       int
+	Quality      string
+	Resolution   string
+	Format       string
+	FileSize     int64
+	IsAudioOnly  bool
+	HasVideo     bool
+	HasAudio     bool
+	AudioFormat  string // container of the paired audio, empty if none
+	ExtractAudio string // format the audio is converted to, empty if none
+	TooLarge     bool   // won't fit in the download folder
+	
+	// Source is the format as listed by the client, used to download
+	// exactly the stream that was picked
+	Source youtube.Format
+}
+
+// playlistInfoMsg contains the fetched playlist. Current is the video the
+// URL pointed at when it was a watch URL inside a playlist.
+type playlistInfoMsg struct {
+	info    *youtube.PlaylistInfo
+	current string
 }
 
 // errMsg wraps an error for Bubble Tea
@@ -53,54 +73,92 @@ type downloadProgressMsg struct {
 	BytesDownloaded int64
 	TotalBytes      int64
 	Speed           float64
+	AverageSpeed    float64
 	ETA             int
+	Attempt         int // reconnect attempt under way, 0 while data flows
+	MaxAttempts     int
+	Event           string
+	Step            string // post-processing step under way, empty while downloading
+	StepNumber      int
+	Steps           int
 }
 
 // downloadCompleteMsg indicates download completion
 type downloadCompleteMsg struct {
 	FilePath string
+	Skipped  bool     // the file was already downloaded
+	Warnings []string // post-processing steps that failed after it was saved
 }
 
-// getYouTubeClient creates a new YouTube client instance
-func getYouTubeClient() *youtube.Client {
-	return youtube.NewClient()
+// fileExistsMsg indicates the download would replace an existing file
+type fileExistsMsg struct {
+	path string
+}
+
+// downloadCancelledMsg indicates the download was cancelled by the user
+type downloadCancelledMsg struct{}
+
+// downloadStartedMsg carries the channel the download goroutine reports on
+type downloadStartedMsg struct {
+	updates <-chan tea.Msg
+}
+
+// downloadTickMsg is sent periodically while downloading to detect stalls
+type downloadTickMsg time.Time
+
+// queueOpenedMsg carries the download queue once it has been loaded
+type queueOpenedMsg struct {
+	queue   *queue.Queue
+	updates <-chan struct{}
+	err     error
+}
+
+// queueUpdatedMsg signals that a job in the queue changed
+type queueUpdatedMsg struct{}
+
+// jobAddedMsg indicates a download was added to the queue
+type jobAddedMsg struct {
+	job queue.Job
 }
 
 // fetchVideoInfo fetches video information from YouTube
-func fetchVideoInfo(url string) tea.Cmd {
+func fetchVideoInfo(client *youtube.Client, url string) tea.Cmd {
 	return func() tea.Msg {
-		// Import the youtube package at the top level
-		// This function will be called asynchronously
-		client := getYouTubeClient()
-		
 		videoInfo, err := client.GetVideoInfo(url)
 		if err != nil {
 			return errMsg{err: err}
 		}
 		
-		// Convert YouTube formats to TUI format
-		formats := make([]FormatInfo, len(videoInfo.Formats))
-		for i, f := range videoInfo.Formats {
-			formats[i] = FormatInfo{
-				ID:          f.Quality,
-				Quality:     f.Quality,
-				Resolution:  f.Resolution,
-				Format:      f.Extension,
-				FileSize:    f.FileSize,
-				IsAudioOnly: f.IsAudioOnly,
-				HasVideo:    f.HasVideo,
-				HasAudio:    f.HasAudio,
-			}
-		}
-		
 		return videoInfoMsg{
 			Title:      videoInfo.Title,
 			Author:     videoInfo.Author,
 			Duration:   videoInfo.Duration,
 			Views:      formatViews(videoInfo.Views),
 			UploadDate: videoInfo.UploadDate,
-			Formats:    formats,
+			Formats:    toFormatInfos(withAudioExtractions(videoInfo.Formats)),
+		}
+	}
+}
+
+// fetchPlaylistInfo fetches a playlist. A watch URL that is part of a
+// playlist falls back to the single video if the playlist can't be loaded,
+// as happens with mixes.
+func fetchPlaylistInfo(client *youtube.Client, url string) tea.Cmd {
+	return func() tea.Msg {
+		videoID, idErr := youtube.ExtractVideoID(url)
+		
+		info, err := client.GetPlaylistInfo(url)
+		if err != nil {
+			if idErr == nil {
+				return fetchVideoInfo(client, url)()
+			}
+			return errMsg{err: err}
 		}
+		if len(info.Entries) == 0 {
+			return errMsg{err: errors.New("playlist is empty")}
+		}
+		
+		return playlistInfoMsg{info: info, current: videoID}
 	}
 }
 
@@ -117,3 +175,39 @@ func formatViews(views uint64) string {
 	}
 	return fmt.Sprintf("%d", views)
 }
+
+// toFormatInfos converts the formats of a video for the quality list. Each
+// keeps its itag and source format so the pick resolves to that exact stream.
+func toFormatInfos(formats []youtube.Format) []FormatInfo {
+	infos := make([]FormatInfo, len(formats))
+	for i, f := range formats {
+		infos[i] = FormatInfo{
+			ID:          strconv.Itoa(f.ItagNo),
+			ItagNo:      f.ItagNo,
+			Quality:     f.Quality,
+			Resolution:  f.Resolution,
+			Format:      f.Extension,
+			FileSize:    f.TotalSize(),
+			IsAudioOnly: f.IsAudioOnly,
+			HasVideo:    f.HasVideo,
+			HasAudio:    f.HasAudio,
+			Source:      f,
+		}
+		if f.Audio != nil {
+			infos[i].AudioFormat = f.Audio.Extension
+		}
+		if f.ExtractAudio != "" {
+			infos[i].ID = fmt.Sprintf("%d-%s", f.ItagNo, f.ExtractAudio)
+			infos[i].ExtractAudio = f.ExtractAudio.Label()
+		}
+	}
+	return infos
+}
+
+// withAudioExtractions adds the ways the best audio can be extracted to the
+// formats of a video
+func withAudioExtractions(formats []youtube.Format) []youtube.Format {
+	all := make([]youtube.Format, 0, len(formats)+len(media.AudioFormats))
+	all = append(all, formats...)
+	return append(all, youtube.AudioExtractions(formats)...)
+}
@@ -2,10 +2,12 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/config"
 	"github.com/phetzy/yt-downloader/internal/utils"
 	"github.com/phetzy/yt-downloader/internal/youtube"
 )
@@ -26,6 +28,7 @@ func (m *Model) updateDirectoryPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 	
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		m.dirErr = nil
 		switch msg.String() {
 		case "enter":
 			// If a directory is selected, enter it
@@ -38,9 +41,7 @@ func (m *Model) updateDirectoryPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.loadDirectories()
 				} else if selectedDir == "[SELECT THIS DIRECTORY]" {
 					// User selected current directory, proceed to download
-					m.downloadPath = m.currentDir
-					m.state = StateDownloading
-					return m, startDownload(m.videoURL, m.selectedFormat, m.downloadPath)
+					return m, m.selectDirectory()
 				} else {
 					// Enter the selected subdirectory
 					m.currentDir = utils.JoinPath(m.currentDir, selectedDir)
@@ -52,9 +53,7 @@ func (m *Model) updateDirectoryPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 			
 		case " ":
 			// Space bar selects current directory
-			m.downloadPath = m.currentDir
-			m.state = StateDownloading
-			return m, startDownload(m.videoURL, m.selectedFormat, m.downloadPath)
+			return m, m.selectDirectory()
 			
 		case "up", "k":
 			// Move selection up
@@ -94,6 +93,34 @@ func (m *Model) updateDirectoryPicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// selectDirectory picks the current directory as the destination after
+// checking that files can be created in it
+func (m *Model) selectDirectory() tea.Cmd {
+	if !utils.IsWritable(m.currentDir) {
+		m.dirErr = fmt.Errorf("%w: files can't be saved in %s, choose another folder", ErrPermissionDenied, m.currentDir)
+		return nil
+	}
+	
+	m.downloadPath = m.currentDir
+	return m.chooseDestination()
+}
+
+// chooseDestination starts the download in the chosen directory, or adds it
+// to the queue once the user has moved on to downloading more than one video.
+// Playlists always go through the queue.
+func (m *Model) chooseDestination() tea.Cmd {
+	if m.playlist != nil {
+		return m.enqueuePlaylist()
+	}
+	if m.queueMode {
+		return m.enqueueDownload()
+	}
+	
+	// Ask before touching a file that's already there
+	m.collision = youtube.CollisionAsk
+	return m.beginDownload()
+}
+
 // loadDirectories loads the list of directories in the current directory
 func (m *Model) loadDirectories() {
 	dirs, err := utils.ListDirectories(m.currentDir)
@@ -117,6 +144,23 @@ func (m *Model) loadDirectories() {
 			m.directories = append(m.directories, dir)
 		}
 	}
+	
+	// Mark the ones that can't be saved to. Only permissions are checked
+	// here so browsing doesn't write into every folder.
+	m.readOnlyDirs = make(map[string]bool)
+	for _, dir := range m.directories {
+		path := m.currentDir
+		switch dir {
+		case "..":
+			continue
+		case "[SELECT THIS DIRECTORY]":
+		default:
+			path = utils.JoinPath(m.currentDir, dir)
+		}
+		if !utils.MayWrite(path) {
+			m.readOnlyDirs[dir] = true
+		}
+	}
 }
 
 // viewDirectoryPicker renders the directory picker screen
@@ -143,28 +187,33 @@ func (m *Model) viewDirectoryPicker() string {
 	
 	// Show directories with selection indicator
 	for i, dir := range m.directories {
+		var line string
+		if dir == "[SELECT THIS DIRECTORY]" {
+			line = fmt.Sprintf("✅ %s", dir)
+		} else if dir == ".." {
+			line = "⬆️  .."
+		} else {
+			line = fmt.Sprintf("📂 %s", dir)
+		}
+		if m.readOnlyDirs[dir] {
+			line += " 🔒 read-only"
+		}
+		
 		if i == m.selectedDirIdx {
 			// Highlight selected directory
-			if dir == "[SELECT THIS DIRECTORY]" {
-				b.WriteString(selectedItemStyle.Render(fmt.Sprintf("✅ %s", dir)))
-			} else if dir == ".." {
-				b.WriteString(selectedItemStyle.Render("⬆️  .."))
-			} else {
-				b.WriteString(selectedItemStyle.Render(fmt.Sprintf("📂 %s", dir)))
-			}
+			b.WriteString(selectedItemStyle.Render(line))
 		} else {
-			// Normal directory
-			if dir == "[SELECT THIS DIRECTORY]" {
-				b.WriteString(normalItemStyle.Render(fmt.Sprintf("✅ %s", dir)))
-			} else if dir == ".." {
-				b.WriteString(normalItemStyle.Render("⬆️  .."))
-			} else {
-				b.WriteString(normalItemStyle.Render(fmt.Sprintf("📂 %s", dir)))
-			}
+			b.WriteString(normalItemStyle.Render(line))
 		}
 		b.WriteString("\n")
 	}
 	
+	if m.dirErr != nil {
+		b.WriteString("\n")
+		b.WriteString(RenderError(m.dirErr.Error()))
+		b.WriteString("\n")
+	}
+	
 	b.WriteString("\n")
 	helpText := "↑/↓ or j/k to navigate • Enter to select/enter • Space to choose current • ←/h for parent • Esc to go back"
 	b.WriteString(RenderHelp(helpText))
@@ -177,54 +226,113 @@ func (m *Model) viewDirectoryPicker() string {
 	return containerStyle.Render(content)
 }
 
-// startDownload initiates the download process with actual YouTube download
-func startDownload(videoURL string, selectedFormat interface{}, downloadPath string) tea.Cmd {
+// startDownload initiates the download process with actual YouTube download.
+// The download runs in its own goroutine and reports back over a channel so
+// progress can be streamed into the Bubble Tea loop while it is running.
+func startDownload(ctx context.Context, cfg *config.Config, client *youtube.Client, videoURL string, selectedFormat interface{}, downloadPath string, collision youtube.CollisionPolicy) tea.Cmd {
 	return func() tea.Msg {
-		// Create YouTube client
-		client := youtube.NewClient()
-		
-		// Extract video ID from URL
-		videoInfo, err := client.GetVideoInfo(videoURL)
-		if err != nil {
-			return errMsg{err: fmt.Errorf("failed to get video info: %w", err)}
-		}
-		
-		// Get the selected format
-		var format youtube.Format
-		if selectedFormat != nil {
-			if formatInfo, ok := selectedFormat.(FormatInfo); ok {
-				// Find matching format in videoInfo
-				for _, f := range videoInfo.Formats {
-					if f.Quality == formatInfo.Quality {
-						format = f
-						break
-					}
-				}
-			}
-		}
-		
-		// If no format selected, use first available
-		if format.Quality == "" && len(videoInfo.Formats) > 0 {
-			format = videoInfo.Formats[0]
-		}
-		
-		// Create downloader
-		downloader := youtube.NewDownloader(client)
-		
-		// Download with progress tracking
-		ctx := context.Background()
-		err = downloader.Download(ctx, videoInfo.ID, format, downloadPath, func(progress youtube.DownloadProgress) {
-			// Progress updates would be sent here
-			// For now, we'll just let it download
+		updates := make(chan tea.Msg, 1)
+		go runDownload(ctx, cfg, client, videoURL, selectedFormat, downloadPath, collision, updates)
+		return downloadStartedMsg{updates: updates}
+	}
+}
+
+// runDownload performs the download and sends progress, then a final
+// completion, cancellation or error message, on updates before closing it
+func runDownload(ctx context.Context, cfg *config.Config, client *youtube.Client, videoURL string, selectedFormat interface{}, downloadPath string, collision youtube.CollisionPolicy, updates chan tea.Msg) {
+	defer close(updates)
+	
+	// The video was fetched to list its formats; the client reuses it
+	videoInfo, format, err := resolveFormat(client, videoURL, selectedFormat)
+	if err != nil {
+		updates <- errMsg{err: err}
+		return
+	}
+	
+	// Create downloader
+	downloader := cfg.NewDownloader(client)
+	downloader.Collision = collision
+	
+	// Download with progress tracking
+	file, err := downloader.Download(ctx, videoInfo.ID, format, downloadPath, func(progress youtube.DownloadProgress) {
+		sendLatest(updates, downloadProgressMsg{
+			BytesDownloaded: progress.BytesDownloaded,
+			TotalBytes:      progress.TotalBytes,
+			Speed:           progress.Speed,
+			AverageSpeed:    progress.AverageSpeed,
+			ETA:             progress.ETA,
+			Attempt:         progress.Attempt,
+			MaxAttempts:     progress.MaxAttempts,
+			Event:           progress.Event,
+			Step:            progress.Step,
+			StepNumber:      progress.StepNumber,
+			Steps:           progress.Steps,
 		})
-		
+	})
+	
+	var exists *youtube.FileExistsError
+	var postErr *youtube.PostProcessError
+	switch {
+	case ctx.Err() != nil:
+		// The user cancelled the download
+		updates <- downloadCancelledMsg{}
+	case errors.As(err, &exists):
+		updates <- fileExistsMsg{path: exists.Path}
+	case errors.Is(err, youtube.ErrSkipped):
+		updates <- downloadCompleteMsg{FilePath: file, Skipped: true}
+	case errors.As(err, &postErr):
+		updates <- downloadCompleteMsg{FilePath: file, Warnings: stepWarnings(postErr)}
+	case err != nil:
+		updates <- errMsg{err: fmt.Errorf("download failed: %w", err)}
+	default:
+		updates <- downloadCompleteMsg{FilePath: file}
+	}
+}
+
+// stepWarnings lists the post-processing steps that failed
+func stepWarnings(err *youtube.PostProcessError) []string {
+	warnings := make([]string, len(err.Steps))
+	for i, step := range err.Steps {
+		warnings[i] = step.Error()
+	}
+	return warnings
+}
+
+// resolveFormat fetches the video and finds the exact format the user
+// picked by its itag, falling back to the first available one only when
+// nothing was picked
+func resolveFormat(client *youtube.Client, videoURL string, selectedFormat interface{}) (*youtube.VideoInfo, youtube.Format, error) {
+	videoInfo, err := client.GetVideoInfo(videoURL)
+	if err != nil {
+		return nil, youtube.Format{}, fmt.Errorf("failed to get video info: %w", err)
+	}
+	
+	if formatInfo, ok := selectedFormat.(FormatInfo); ok {
+		format, err := youtube.FindFormat(videoInfo.Formats, formatInfo.Source)
 		if err != nil {
-			return errMsg{err: fmt.Errorf("download failed: %w", err)}
+			return nil, youtube.Format{}, fmt.Errorf("%w; go back and pick another quality", err)
 		}
-		
-		// Download complete
-		return downloadCompleteMsg{
-			FilePath: fmt.Sprintf("%s/%s.%s", downloadPath, videoInfo.Title, format.Extension),
+		return videoInfo, format, nil
+	}
+	
+	// If no format selected, use first available
+	if len(videoInfo.Formats) == 0 {
+		return nil, youtube.Format{}, fmt.Errorf("no formats available for %s", videoInfo.Title)
+	}
+	return videoInfo, videoInfo.Formats[0], nil
+}
+
+// sendLatest delivers msg without blocking the download. If the UI hasn't
+// consumed the previous update yet it is replaced, so bursts of progress are
+// coalesced and the screen always shows the most recent state.
+func sendLatest(updates chan tea.Msg, msg tea.Msg) {
+	select {
+	case updates <- msg:
+	default:
+		select {
+		case <-updates:
+		default:
 		}
+		updates <- msg
 	}
 }
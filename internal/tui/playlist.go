@@ -0,0 +1,452 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/queue"
+	"github.com/phetzy/yt-downloader/internal/youtube"
+)
+
+// playlistPageSize is the number of playlist entries shown at once
+const playlistPageSize = 15
+
+// formatRule is a choice on the playlist format screen
+type formatRule struct {
+	label string
+	rule  string
+}
+
+// playlistRules are the format choices offered for a playlist. Every
+// selected video is downloaded with the same rule.
+var playlistRules = []formatRule{
+	{"Best quality", youtube.RuleBest},
+	{"1080p or lower", "1080p"},
+	{"720p or lower", "720p"},
+	{"480p or lower", "480p"},
+	{"360p or lower", "360p"},
+	{"Audio only", youtube.RuleAudio},
+	{"Custom selector…", ""},
+}
+
+// showPlaylist switches to the playlist screen. Every entry is selected,
+// unless the URL pointed at one video in the playlist.
+func (m *Model) showPlaylist(info *youtube.PlaylistInfo, current string) {
+	m.playlist = info
+	m.playlistIdx = 0
+	m.playlistRule = ""
+	m.ruleIdx = 0
+	m.editingRange = false
+	m.rangeErr = nil
+	m.playlistSelected = make([]bool, len(info.Entries))
+	
+	found := false
+	for i, entry := range info.Entries {
+		if current != "" && entry.ID == current {
+			m.playlistSelected[i] = true
+			m.playlistIdx = i
+			found = true
+		}
+	}
+	if !found {
+		for i := range m.playlistSelected {
+			m.playlistSelected[i] = true
+		}
+	}
+	
+	ri := textinput.New()
+	ri.Placeholder = "1-10,15"
+	ri.CharLimit = 256
+	ri.Width = 30
+	m.rangeInput = ri
+	
+	si := textinput.New()
+	si.Placeholder = "bestvideo[height<=1080]+bestaudio/best"
+	si.CharLimit = 256
+	si.Width = 50
+	m.selectorInput = si
+	m.editingSelector = false
+	m.selectorErr = nil
+	
+	m.state = StatePlaylistSelect
+}
+
+// updatePlaylistSelect handles updates for the playlist entry selection state
+func (m *Model) updatePlaylistSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.editingRange {
+		return m.updateRangeInput(msg)
+	}
+	
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.playlistIdx > 0 {
+				m.playlistIdx--
+			}
+			return m, nil
+			
+		case "down", "j":
+			if m.playlistIdx < len(m.playlistSelected)-1 {
+				m.playlistIdx++
+			}
+			return m, nil
+			
+		case " ", "x":
+			// Toggle the entry under the cursor
+			m.playlistSelected[m.playlistIdx] = !m.playlistSelected[m.playlistIdx]
+			return m, nil
+			
+		case "a":
+			// Select all, or nothing if everything is selected
+			all := m.selectedCount() < len(m.playlistSelected)
+			for i := range m.playlistSelected {
+				m.playlistSelected[i] = all
+			}
+			return m, nil
+			
+		case "/", "r":
+			// Type the entries to download as index ranges
+			m.editingRange = true
+			m.rangeErr = nil
+			m.rangeInput.SetValue("")
+			return m, m.rangeInput.Focus()
+			
+		case "enter":
+			if m.selectedCount() > 0 {
+				m.state = StatePlaylistFormat
+			}
+			return m, nil
+			
+		case "esc":
+			m.showURLInput()
+			return m, nil
+		}
+	}
+	
+	return m, nil
+}
+
+// updateRangeInput handles keys while index ranges are being typed
+func (m *Model) updateRangeInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			indexes, err := parseIndexRanges(m.rangeInput.Value(), len(m.playlistSelected))
+			if err != nil {
+				m.rangeErr = err
+				return m, nil
+			}
+			
+			for i := range m.playlistSelected {
+				m.playlistSelected[i] = false
+			}
+			for _, i := range indexes {
+				m.playlistSelected[i] = true
+			}
+			m.editingRange = false
+			m.rangeErr = nil
+			m.rangeInput.Blur()
+			return m, nil
+			
+		case "esc":
+			m.editingRange = false
+			m.rangeErr = nil
+			m.rangeInput.Blur()
+			return m, nil
+		}
+	}
+	
+	var cmd tea.Cmd
+	m.rangeInput, cmd = m.rangeInput.Update(msg)
+	return m, cmd
+}
+
+// updatePlaylistFormat handles updates for the playlist format rule state
+func (m *Model) updatePlaylistFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.editingSelector {
+		return m.updateSelectorInput(msg)
+	}
+	
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.ruleIdx > 0 {
+				m.ruleIdx--
+			}
+			return m, nil
+			
+		case "down", "j":
+			if m.ruleIdx < len(playlistRules)-1 {
+				m.ruleIdx++
+			}
+			return m, nil
+			
+		case "enter":
+			rule := playlistRules[m.ruleIdx].rule
+			if rule == "" {
+				// Type a format selector
+				m.editingSelector = true
+				m.selectorErr = nil
+				return m, m.selectorInput.Focus()
+			}
+			m.playlistRule = rule
+			m.state = StateDirectoryPicker
+			return m, nil
+			
+		case "esc":
+			m.state = StatePlaylistSelect
+			return m, nil
+		}
+	}
+	
+	return m, nil
+}
+
+// updateSelectorInput handles keys while a format selector is being typed
+func (m *Model) updateSelectorInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			rule := strings.TrimSpace(m.selectorInput.Value())
+			if _, err := youtube.ParseRule(rule); err != nil {
+				m.selectorErr = err
+				return m, nil
+			}
+			
+			m.playlistRule = rule
+			m.editingSelector = false
+			m.selectorErr = nil
+			m.selectorInput.Blur()
+			m.state = StateDirectoryPicker
+			return m, nil
+			
+		case "esc":
+			m.editingSelector = false
+			m.selectorErr = nil
+			m.selectorInput.Blur()
+			return m, nil
+		}
+	}
+	
+	var cmd tea.Cmd
+	m.selectorInput, cmd = m.selectorInput.Update(msg)
+	return m, cmd
+}
+
+// selectedCount returns how many playlist entries are selected
+func (m *Model) selectedCount() int {
+	count := 0
+	for _, selected := range m.playlistSelected {
+		if selected {
+			count++
+		}
+	}
+	return count
+}
+
+// enqueuePlaylist adds every selected playlist entry to the queue with the
+// chosen format rule and shows the dashboard
+func (m *Model) enqueuePlaylist() tea.Cmd {
+	m.state = StateQueue
+	m.queueMode = true
+	if m.queue == nil {
+		m.queueErr = fmt.Errorf("download queue is not available")
+		return nil
+	}
+	
+	var jobs []queue.Job
+	for i, entry := range m.playlist.Entries {
+		if !m.playlistSelected[i] {
+			continue
+		}
+		jobs = append(jobs, queue.Job{
+			URL:           entry.URL(),
+			VideoID:       entry.ID,
+			Title:         entry.Title,
+			PlaylistIndex: entry.Index,
+			Rule:          m.playlistRule,
+			Destination:   m.downloadPath,
+		})
+	}
+	
+	q := m.queue
+	return func() tea.Msg {
+		var first queue.Job
+		for i, job := range jobs {
+			added, err := q.Add(job)
+			if err != nil {
+				return errMsg{err: fmt.Errorf("failed to queue %s: %w", job.Title, err)}
+			}
+			if i == 0 {
+				first = added
+			}
+		}
+		return jobAddedMsg{job: first}
+	}
+}
+
+// parseIndexRanges parses 1-based positions and ranges such as "1-10,15"
+// into sorted 0-based indexes of a list of count items
+func parseIndexRanges(spec string, count int) ([]int, error) {
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid index %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(endStr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		
+		if start < 1 || end > count || start > end {
+			return nil, fmt.Errorf("%q is outside 1-%d", part, count)
+		}
+		for i := start; i <= end; i++ {
+			seen[i-1] = true
+		}
+	}
+	
+	if len(seen) == 0 {
+		return nil, errors.New("no entries given")
+	}
+	
+	indexes := make([]int, 0, len(seen))
+	for i := range seen {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// viewPlaylistSelect renders the playlist entry selection screen
+func (m *Model) viewPlaylistSelect() string {
+	var b strings.Builder
+	
+	b.WriteString("\n")
+	b.WriteString(RenderTitle("📃 Select Videos"))
+	b.WriteString("\n\n")
+	
+	b.WriteString(RenderBox(fmt.Sprintf(
+		"Playlist: %s\n"+
+			"Channel:  %s\n"+
+			"Selected: %d of %d",
+		m.playlist.Title,
+		m.playlist.Author,
+		m.selectedCount(),
+		len(m.playlist.Entries),
+	), false))
+	b.WriteString("\n")
+	
+	// Show a page of entries around the cursor
+	start := m.playlistIdx - playlistPageSize/2
+	if start > len(m.playlist.Entries)-playlistPageSize {
+		start = len(m.playlist.Entries) - playlistPageSize
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + playlistPageSize
+	if end > len(m.playlist.Entries) {
+		end = len(m.playlist.Entries)
+	}
+	
+	for i := start; i < end; i++ {
+		entry := m.playlist.Entries[i]
+		check := "[ ]"
+		if m.playlistSelected[i] {
+			check = "[x]"
+		}
+		line := fmt.Sprintf("%s %3d. %s (%s)", check, entry.Index, entry.Title, entry.Duration)
+		if i == m.playlistIdx {
+			b.WriteString(selectedItemStyle.Render(line))
+		} else {
+			b.WriteString(normalItemStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+	
+	if m.editingRange {
+		b.WriteString("\nEntries to download:\n")
+		b.WriteString(m.rangeInput.View())
+		b.WriteString("\n")
+		if m.rangeErr != nil {
+			b.WriteString(RenderError(m.rangeErr.Error()))
+			b.WriteString("\n")
+		}
+	}
+	
+	b.WriteString("\n")
+	helpText := "↑/↓ to navigate • Space to toggle • A to select all/none • / to enter ranges (1-10,15) • Enter to continue • Esc to go back"
+	if m.editingRange {
+		helpText = "Enter to apply • Esc to cancel"
+	}
+	b.WriteString(RenderHelp(helpText))
+	
+	content := b.String()
+	if m.width > 0 {
+		content = Center(m.width, content)
+	}
+	
+	return containerStyle.Render(content)
+}
+
+// viewPlaylistFormat renders the format rule screen for a playlist
+func (m *Model) viewPlaylistFormat() string {
+	var b strings.Builder
+	
+	b.WriteString("\n")
+	b.WriteString(RenderTitle("🎬 Select Quality"))
+	b.WriteString("\n\n")
+	
+	b.WriteString(fmt.Sprintf("Applies to all %d selected videos:\n\n", m.selectedCount()))
+	
+	for i, rule := range playlistRules {
+		if i == m.ruleIdx {
+			b.WriteString(selectedItemStyle.Render("▶ " + rule.label))
+		} else {
+			b.WriteString(normalItemStyle.Render(rule.label))
+		}
+		b.WriteString("\n")
+	}
+	
+	if m.editingSelector {
+		b.WriteString("\nFormat selector:\n")
+		b.WriteString(m.selectorInput.View())
+		b.WriteString("\n")
+		if m.selectorErr != nil {
+			b.WriteString(RenderError(m.selectorErr.Error()))
+			b.WriteString("\n")
+		}
+	}
+	
+	b.WriteString("\n")
+	helpText := "↑/↓ to navigate • Enter to select • Esc to go back"
+	if m.editingSelector {
+		helpText = "Enter to apply • Esc to cancel"
+	}
+	b.WriteString(RenderHelp(helpText))
+	
+	content := b.String()
+	if m.width > 0 {
+		content = Center(m.width, content)
+	}
+	
+	return containerStyle.Render(content)
+}
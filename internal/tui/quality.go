@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/utils"
 )
 
 // updateQualitySelect handles updates for the quality selection state
@@ -33,6 +34,32 @@ func (m *Model) updateQualitySelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// markFormatsTooLarge flags the formats that won't fit in the download
+// folder while keeping the configured reserve free
+func (m *Model) markFormatsTooLarge(formats []FormatInfo) {
+	dir := m.currentDir
+	if dir == "" {
+		var err error
+		if dir, err = utils.GetDefaultDownloadDir(); err != nil {
+			return
+		}
+	}
+	free, err := utils.GetDiskSpace(dir)
+	if err != nil {
+		return
+	}
+	
+	available := int64(free) - m.config.DiskReserve()
+	for i, f := range formats {
+		need := f.FileSize
+		if f.AudioFormat != "" || f.ExtractAudio != "" {
+			// The streams stay on disk until they're merged or converted
+			need *= 2
+		}
+		formats[i].TooLarge = need > available
+	}
+}
+
 // viewQualitySelect renders the quality selection screen
 func (m *Model) viewQualitySelect() string {
 	var b strings.Builder
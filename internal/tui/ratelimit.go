@@ -0,0 +1,81 @@
+package tui
+
+import (
+	"fmt"
+)
+
+// rateSteps are the speed limits, in bytes per second, that [ and ] step
+// through. 0, unlimited, comes after the fastest.
+var rateSteps = []int64{
+	256 << 10,
+	512 << 10,
+	1 << 20,
+	2 << 20,
+	5 << 20,
+	10 << 20,
+	20 << 20,
+	50 << 20,
+}
+
+// updateRateLimit handles the keys that change the speed limit of every
+// download. It reports whether key was one of them.
+func (m *Model) updateRateLimit(key string) bool {
+	limiter := m.config.RateLimiter()
+	current, _ := limiter.Limit()
+	
+	switch key {
+	case "[":
+		limiter.SetLimit(slowerRate(current))
+	case "]":
+		limiter.SetLimit(fasterRate(current))
+	case "=":
+		limiter.ClearLimit()
+	default:
+		return false
+	}
+	return true
+}
+
+// slowerRate returns the next limit below current
+func slowerRate(current int64) int64 {
+	if current <= 0 {
+		return rateSteps[len(rateSteps)-1]
+	}
+	for i := len(rateSteps) - 1; i >= 0; i-- {
+		if rateSteps[i] < current {
+			return rateSteps[i]
+		}
+	}
+	return rateSteps[0]
+}
+
+// fasterRate returns the next limit above current, or unlimited
+func fasterRate(current int64) int64 {
+	if current <= 0 {
+		return 0
+	}
+	for _, step := range rateSteps {
+		if step > current {
+			return step
+		}
+	}
+	return 0
+}
+
+// viewRateLimit describes the speed limit in effect
+func (m *Model) viewRateLimit() string {
+	limiter := m.config.RateLimiter()
+	limit, rule := limiter.Limit()
+	
+	text := "unlimited"
+	if limit > 0 {
+		text = formatSpeed(float64(limit))
+	}
+	switch {
+	case limiter.Overridden():
+		text += " (set here, = to reset)"
+	case rule != nil:
+		text += fmt.Sprintf(" (scheduled %s)", rule)
+	}
+	return text
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+// MayWrite reports whether the permissions of the directory path allow
+// creating files in it. Permissions can't be checked cheaply here, so it
+// assumes they do; use IsWritable to be sure.
+func MayWrite(path string) bool {
+	return true
+}
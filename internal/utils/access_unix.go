@@ -0,0 +1,11 @@
+//go:build unix
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// MayWrite reports whether the permissions of the directory path allow
+// creating files in it, without writing anything. Use IsWritable to be sure.
+func MayWrite(path string) bool {
+	return unix.Access(path, unix.W_OK) == nil
+}
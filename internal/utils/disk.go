@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrDiskFull is returned when a download won't fit on the disk
+var ErrDiskFull = errors.New("not enough disk space")
+
+// errDiskSpaceUnknown is returned where free space can't be queried
+var errDiskSpaceUnknown = errors.New("free disk space is not available on this platform")
+
+// GetDiskSpace returns the disk space available to the user, in bytes, on
+// the filesystem holding path. Paths that don't exist yet are measured at
+// their nearest existing parent.
+func GetDiskSpace(path string) (uint64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if !info.IsDir() {
+				path = filepath.Dir(path)
+			}
+			return freeSpace(path)
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return 0, err
+		}
+		path = parent
+	}
+}
+
+// CheckDiskSpace returns an error wrapping ErrDiskFull if writing need bytes
+// to path would leave less than reserve bytes free. It passes when the free
+// space can't be determined.
+func CheckDiskSpace(path string, need, reserve int64) error {
+	free, err := GetDiskSpace(path)
+	if err != nil || need <= 0 {
+		return nil
+	}
+
+	if need+reserve > int64(free) {
+		if reserve > 0 {
+			return fmt.Errorf("%w: needs %s but %s is free (keeping %s in reserve)",
+				ErrDiskFull, FormatBytes(need), FormatBytes(int64(free)), FormatBytes(reserve))
+		}
+		return fmt.Errorf("%w: needs %s but %s is free", ErrDiskFull, FormatBytes(need), FormatBytes(int64(free)))
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package utils
+
+// freeSpace can't query free space on this platform
+func freeSpace(dir string) (uint64, error) {
+	return 0, errDiskSpaceUnknown
+}
@@ -8,6 +8,9 @@ import (
 	"strings"
 )
 
+// appName is the directory name used for config, state and cache files
+const appName = "yt-downloader"
+
 // ExpandHomeDir expands ~ to the user's home directory
 func ExpandHomeDir(path string) (string, error) {
 	if !strings.HasPrefix(path, "~") {
@@ -59,6 +62,45 @@ func GetDefaultDownloadDir() (string, error) {
 	return downloadDir, nil
 }
 
+// GetConfigDir returns the directory for the application's config file
+func GetConfigDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, appName), nil
+}
+
+// GetStateDir returns the directory for persistent application state such
+// as the download queue. It follows the XDG base directory spec on Linux.
+func GetStateDir() (string, error) {
+	if xdgState := os.Getenv("XDG_STATE_HOME"); xdgState != "" {
+		return filepath.Join(xdgState, appName), nil
+	}
+
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		// No separate state location; keep it with the config
+		return GetConfigDir()
+	default:
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(homeDir, ".local", "state", appName), nil
+	}
+}
+
+// GetCacheDir returns the directory for cached data that can be deleted at
+// any time, such as video metadata. It honours XDG_CACHE_HOME on Linux.
+func GetCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, appName), nil
+}
+
 // EnsureDir ensures a directory exists, creating it if necessary
 func EnsureDir(path string) error {
 	info, err := os.Stat(path)
@@ -76,35 +118,17 @@ func EnsureDir(path string) error {
 	return nil
 }
 
-// IsWritable checks if a directory is writable
+// IsWritable reports whether files can be created in the directory path.
+// It creates and removes a uniquely named file, so it never touches an
+// existing file and several checks can run at once.
 func IsWritable(path string) bool {
-	// Try to create a temporary file
-	testFile := filepath.Join(path, ".write_test")
-	file, err := os.Create(testFile)
+	file, err := os.CreateTemp(path, ".yt-downloader-write-test-*")
 	if err != nil {
 		return false
 	}
+	name := file.Name()
 	file.Close()
-	os.Remove(testFile)
-	return true
-}
-
-// GetDiskSpace returns available disk space in bytes
-func GetDiskSpace(path string) (uint64, error) {
-	// This is a simplified version
-	// For production, you'd want to use syscall for accurate disk space
-	info, err := os.Stat(path)
-	if err != nil {
-		return 0, err
-	}
-
-	if !info.IsDir() {
-		path = filepath.Dir(path)
-	}
-
-	// Platform-specific disk space checking would go here
-	// For now, return a large number as placeholder
-	return 100 * 1024 * 1024 * 1024, nil // 100 GB
+	return os.Remove(name) == nil
 }
 
 // ListDirectories returns a list of directories in the given path
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -110,6 +111,90 @@ func TestGetDefaultDownloadDir(t *testing.T) {
 	}
 }
 
+func TestGetStateDir(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	dir, err := GetStateDir()
+	if err != nil {
+		t.Fatalf("GetStateDir() error = %v", err)
+	}
+
+	want := filepath.Join(stateHome, "yt-downloader")
+	if dir != want {
+		t.Errorf("GetStateDir() = %v, want %v", dir, want)
+	}
+}
+
+func TestGetCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG_CACHE_HOME is only used on Unix")
+	}
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+
+	dir, err := GetCacheDir()
+	if err != nil {
+		t.Fatalf("GetCacheDir() error = %v", err)
+	}
+
+	want := filepath.Join(cacheHome, "yt-downloader")
+	if dir != want {
+		t.Errorf("GetCacheDir() = %v, want %v", dir, want)
+	}
+}
+
+func TestGetDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	free, err := GetDiskSpace(dir)
+	if errors.Is(err, errDiskSpaceUnknown) {
+		t.Skip(err)
+	}
+	if err != nil || free == 0 {
+		t.Fatalf("GetDiskSpace() = %d, %v; want the free space", free, err)
+	}
+
+	// Folders that don't exist yet are measured at their parent
+	if _, err := GetDiskSpace(filepath.Join(dir, "new", "folder")); err != nil {
+		t.Errorf("GetDiskSpace() of a missing folder error = %v", err)
+	}
+
+	if err := CheckDiskSpace(dir, 1, 0); err != nil {
+		t.Errorf("CheckDiskSpace() of 1 byte error = %v", err)
+	}
+	if err := CheckDiskSpace(dir, int64(free), 1<<20); !errors.Is(err, ErrDiskFull) {
+		t.Errorf("CheckDiskSpace() into the reserve error = %v, want ErrDiskFull", err)
+	}
+}
+
+func TestIsWritable(t *testing.T) {
+	dir := t.TempDir()
+	if !IsWritable(dir) || !MayWrite(dir) {
+		t.Errorf("IsWritable(%s) = false, want true", dir)
+	}
+	if IsWritable(filepath.Join(dir, "missing")) {
+		t.Error("IsWritable() of a missing directory = true")
+	}
+
+	// The probe leaves nothing behind
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("directory holds %d entries after the check, want 0", len(entries))
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	readOnly := filepath.Join(dir, "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if IsWritable(readOnly) || MayWrite(readOnly) {
+		t.Error("a read-only directory is reported as writable")
+	}
+}
+
 func TestJoinPath(t *testing.T) {
 	tests := []struct {
 		name     string
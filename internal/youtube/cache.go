@@ -0,0 +1,180 @@
+package youtube
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheSuffix is the extension of cache entries
+const cacheSuffix = ".json"
+
+// cacheKeyPattern matches the video IDs that are safe to use as file names
+var cacheKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// cachedInfo is the file stored for each video
+type cachedInfo struct {
+	Fetched time.Time  `json:"fetched"`
+	Info    *VideoInfo `json:"info"`
+}
+
+// InfoCache keeps video information on disk between runs, one file per
+// video ID, so recently looked-up videos are shown instantly and offline.
+// Entries expire after a TTL, and the least recently used ones are evicted
+// when the cache grows beyond its size limit.
+type InfoCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// NewInfoCache creates a cache in dir keeping entries for ttl and using at
+// most maxSize bytes
+func NewInfoCache(dir string, ttl time.Duration, maxSize int64) *InfoCache {
+	return &InfoCache{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached information of a video if it hasn't expired
+func (c *InfoCache) Get(videoID string) (*VideoInfo, bool) {
+	path, ok := c.path(videoID)
+	if !ok {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedInfo
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Info == nil || c.now().Sub(entry.Fetched) >= c.ttl {
+		os.Remove(path)
+		return nil, false
+	}
+
+	// The modification time records the last use for eviction
+	now := c.now()
+	os.Chtimes(path, now, now)
+	return entry.Info, true
+}
+
+// Put stores the information of a video, then evicts the least recently
+// used entries if the cache is over its size limit
+func (c *InfoCache) Put(info *VideoInfo) error {
+	path, ok := c.path(info.ID)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(cachedInfo{Fetched: c.now(), Info: info})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so other processes never read a
+	// partial entry
+	tmp, err := os.CreateTemp(c.dir, info.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return c.evictLocked()
+}
+
+// Delete removes the entry of a video, e.g. because its formats turned out
+// to be out of date
+func (c *InfoCache) Delete(videoID string) {
+	if path, ok := c.path(videoID); ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		os.Remove(path)
+	}
+}
+
+// path returns the file of a video's entry, or false if the ID can't be
+// used as a file name
+func (c *InfoCache) path(videoID string) (string, bool) {
+	if !cacheKeyPattern.MatchString(videoID) {
+		return "", false
+	}
+	return filepath.Join(c.dir, videoID+cacheSuffix), true
+}
+
+// evictLocked removes the least recently used entries until the cache fits
+// in its size limit
+func (c *InfoCache) evictLocked() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+	var files []cacheFile
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), cacheSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{filepath.Join(c.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	if total <= c.maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].lastUse.Before(files[j].lastUse)
+	})
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
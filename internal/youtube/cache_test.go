@@ -0,0 +1,80 @@
+package youtube
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInfoCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewInfoCache(dir, time.Hour, 1<<20)
+	cache.now = func() time.Time { return now }
+
+	info := &VideoInfo{ID: "dQw4w9WgXcQ", Title: "Video", Formats: []Format{
+		{ItagNo: 137, Extension: "mp4", HasVideo: true, Audio: &Format{ItagNo: 140, Extension: "m4a"}},
+	}}
+	if err := cache.Put(info); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok := cache.Get(info.ID)
+	if !ok || got.Title != "Video" || len(got.Formats) != 1 || got.Formats[0].Audio.ItagNo != 140 {
+		t.Fatalf("Get() = %+v, %v; want the stored info with its formats", got, ok)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := cache.Get(info.ID); ok {
+		t.Error("Get() returned an expired entry")
+	}
+	if _, err := os.Stat(filepath.Join(dir, info.ID+".json")); !os.IsNotExist(err) {
+		t.Error("expired entry was not removed")
+	}
+
+	// IDs that aren't safe file names are never cached
+	if err := cache.Put(&VideoInfo{ID: "../escape"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, ok := cache.Get("../escape"); ok {
+		t.Error("Get() returned an entry for an unsafe ID")
+	}
+}
+
+func TestInfoCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewInfoCache(dir, time.Hour, 1<<20)
+	// A fixed clock gives every entry the same size
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ids := []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"}
+
+	for i, id := range ids[:2] {
+		if err := cache.Put(&VideoInfo{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+		old := now.Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(filepath.Join(dir, id+".json"), old, old)
+	}
+	info, err := os.Stat(filepath.Join(dir, ids[0]+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave room for two entries
+	cache.maxSize = 2 * info.Size()
+
+	// Using the oldest entry makes the other one the least recently used
+	if _, ok := cache.Get(ids[0]); !ok {
+		t.Fatal("Get() missed a stored entry")
+	}
+	if err := cache.Put(&VideoInfo{ID: ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]bool{ids[0]: true, ids[1]: false, ids[2]: true} {
+		if _, ok := cache.Get(id); ok != want {
+			t.Errorf("Get(%s) found = %v, want %v", id, ok, want)
+		}
+	}
+}
@@ -3,21 +3,39 @@ package youtube
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/kkdai/youtube/v2"
+	"github.com/phetzy/yt-downloader/internal/media"
 )
 
-// Client wraps the YouTube client
+// Client wraps the YouTube client. Videos it fetches are kept for
+// DefaultVideoTTL and shared by everything using the same Client.
 type Client struct {
-	client youtube.Client
+	// Cache keeps video information on disk between runs; nil disables it
+	Cache *InfoCache
+
+	client    youtube.Client
+	transport *headerTransport
+	videos    *videoStore
+
+	// fetchVideo fetches a video from YouTube; replaced in tests
+	fetchVideo func(videoID string) (*youtube.Video, error)
 }
 
 // NewClient creates a new YouTube client
 func NewClient() *Client {
-	return &Client{
-		client: youtube.Client{},
+	transport := &headerTransport{base: http.DefaultTransport}
+	c := &Client{
+		client: youtube.Client{
+			HTTPClient: &http.Client{Transport: transport},
+		},
+		transport: transport,
+		videos:    newVideoStore(DefaultVideoTTL),
 	}
+	c.fetchVideo = c.client.GetVideo
+	return c
 }
 
 // VideoInfo contains information about a YouTube video
@@ -44,18 +62,43 @@ type Format struct {
 	HasVideo    bool
 	HasAudio    bool
 	Extension   string
+
+	// Audio is the audio stream downloaded alongside a video-only format
+	// and merged with it into one file. Nil for formats that are used as is.
+	Audio *Format
+
+	// ExtractAudio is the format the audio of the stream is converted to
+	// once it's downloaded; Extension is then that format's. Empty keeps
+	// the stream as it is.
+	ExtractAudio media.AudioFormat
+}
+
+// TotalSize returns the size of the format including its paired audio
+func (f Format) TotalSize() int64 {
+	if f.Audio != nil {
+		return f.FileSize + f.Audio.FileSize
+	}
+	return f.FileSize
 }
 
 // GetVideoInfo fetches information about a YouTube video
 func (c *Client) GetVideoInfo(url string) (*VideoInfo, error) {
 	// Extract video ID from URL
-	videoID, err := extractVideoID(url)
+	videoID, err := ExtractVideoID(url)
 	if err != nil {
 		return nil, err
 	}
 
-	// Fetch video information
-	video, err := c.client.GetVideo(videoID)
+	// Videos looked up recently are served from the metadata cache, unless
+	// they're already in memory for this session
+	if _, live := c.videos.get(videoID); !live && c.Cache != nil {
+		if info, ok := c.Cache.Get(videoID); ok {
+			return info, nil
+		}
+	}
+
+	// Fetch video information, or reuse it from earlier in the session
+	video, err := c.video(videoID)
 	if err != nil {
 		// Check for common error patterns
 		errMsg := err.Error()
@@ -74,6 +117,16 @@ func (c *Client) GetVideoInfo(url string) (*VideoInfo, error) {
 		return nil, fmt.Errorf("failed to fetch video info: %w. This may be due to regional restrictions, age restrictions, or the video requiring sign-in", err)
 	}
 
+	info := c.videoInfo(video)
+	if c.Cache != nil {
+		// A cache that can't be written only costs a fetch next time
+		_ = c.Cache.Put(info)
+	}
+	return info, nil
+}
+
+// videoInfo converts a fetched video to a VideoInfo
+func (c *Client) videoInfo(video *youtube.Video) *VideoInfo {
 	// Parse formats
 	formats := c.parseFormats(video.Formats)
 
@@ -89,7 +142,7 @@ func (c *Client) GetVideoInfo(url string) (*VideoInfo, error) {
 		UploadDate:  video.PublishDate.Format("2006-01-02"),
 		Description: video.Description,
 		Formats:     formats,
-	}, nil
+	}
 }
 
 // parseFormats converts youtube.Format to our Format type
@@ -138,6 +191,10 @@ func (c *Client) parseFormats(ytFormats youtube.FormatList) []Format {
 		}
 	}
 
+	// Give video-only formats the best audio in the same container so
+	// they aren't downloaded silent
+	pairAudio(formats)
+
 	// Sort formats to prioritize MP4/M4A over WebM for compatibility
 	// MP4/M4A first, then WebM, then others
 	sortFormatsByCompatibility(formats)
@@ -145,6 +202,34 @@ func (c *Client) parseFormats(ytFormats youtube.FormatList) []Format {
 	return formats
 }
 
+// pairAudio attaches the highest bitrate audio-only stream with a matching
+// container (m4a for mp4, webm/opus for webm) to every video-only format
+func pairAudio(formats []Format) {
+	best := make(map[string]*Format)
+	for i, f := range formats {
+		if !f.IsAudioOnly {
+			continue
+		}
+		container := "mp4"
+		if f.Extension == "webm" {
+			container = "webm"
+		}
+		if b, ok := best[container]; !ok || f.Bitrate > b.Bitrate {
+			best[container] = &formats[i]
+		}
+	}
+
+	for i, f := range formats {
+		if !f.HasVideo || f.HasAudio {
+			continue
+		}
+		if audio, ok := best[f.Extension]; ok {
+			paired := *audio
+			formats[i].Audio = &paired
+		}
+	}
+}
+
 // sortFormatsByCompatibility sorts formats to prioritize more compatible formats
 func sortFormatsByCompatibility(formats []Format) {
 	// Sort in place - MP4/M4A formats first, then WebM, then others
@@ -164,8 +249,8 @@ func sortFormatsByCompatibility(formats []Format) {
 	}
 }
 
-// extractVideoID extracts the video ID from various YouTube URL formats
-func extractVideoID(url string) (string, error) {
+// ExtractVideoID extracts the video ID from various YouTube URL formats
+func ExtractVideoID(url string) (string, error) {
 	url = strings.TrimSpace(url)
 
 	// Handle different URL formats
@@ -217,6 +302,9 @@ func extractVideoID(url string) (string, error) {
 func getExtensionFromMimeType(mimeType string) string {
 	mimeType = strings.ToLower(mimeType)
 
+	if strings.HasPrefix(mimeType, "audio/mp4") {
+		return "m4a"
+	}
 	if strings.Contains(mimeType, "mp4") {
 		return "mp4"
 	}
@@ -1,7 +1,12 @@
 package youtube
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/phetzy/yt-downloader/internal/media"
 )
 
 func TestExtractVideoID(t *testing.T) {
@@ -63,13 +68,13 @@ func TestExtractVideoID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := extractVideoID(tt.url)
+			got, err := ExtractVideoID(tt.url)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("extractVideoID() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ExtractVideoID() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != tt.want {
-				t.Errorf("extractVideoID() = %v, want %v", got, tt.want)
+				t.Errorf("ExtractVideoID() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -101,9 +106,14 @@ func TestGetExtensionFromMimeType(t *testing.T) {
 			mimeType: "audio/mp4; codecs=\"mp4a.40.2\"",
 			want:     "m4a",
 		},
+		{
+			name:     "WebM audio",
+			mimeType: "audio/webm; codecs=\"opus\"",
+			want:     "webm",
+		},
 		{
 			name:     "Generic audio",
-			mimeType: "audio/webm",
+			mimeType: "audio/aac",
 			want:     "m4a",
 		},
 		{
@@ -168,3 +178,247 @@ func TestFormatDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractPlaylistID(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Playlist URL",
+			url:  "https://www.youtube.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			want: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+		},
+		{
+			name: "Watch URL in a playlist",
+			url:  "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf&index=3",
+			want: "PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+		},
+		{
+			name:    "Watch URL without a playlist",
+			url:     "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			wantErr: true,
+		},
+		{
+			name:    "Other site",
+			url:     "https://example.com/playlist?list=PLrAXtmErZgOeiKm4sgNOknGvNjby9efdf",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid playlist ID",
+			url:     "https://www.youtube.com/playlist?list=bad!",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractPlaylistID(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExtractPlaylistID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ExtractPlaylistID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectFormat(t *testing.T) {
+	formats := []Format{
+		{ItagNo: 18, Resolution: "640x360", HasVideo: true, HasAudio: true, Bitrate: 500},
+		{ItagNo: 136, Resolution: "1280x720", HasVideo: true, Bitrate: 2000},
+		{ItagNo: 137, Resolution: "1920x1080", HasVideo: true, Bitrate: 4000},
+		{ItagNo: 140, IsAudioOnly: true, HasAudio: true, Bitrate: 128000},
+		{ItagNo: 139, IsAudioOnly: true, HasAudio: true, Bitrate: 48000},
+	}
+	videoOnly := []Format{formats[1], formats[2]}
+
+	tests := []struct {
+		name    string
+		formats []Format
+		rule    string
+		want    int
+		wantErr bool
+	}{
+		{name: "Best prefers audio", formats: formats, rule: "best", want: 18},
+		{name: "Best without combined streams", formats: videoOnly, rule: "best", want: 137},
+		{name: "Height limit", formats: videoOnly, rule: "720p", want: 136},
+		{name: "Audio only", formats: formats, rule: "audio", want: 140},
+		{name: "Itag", formats: formats, rule: "139", want: 139},
+		{name: "Missing itag", formats: formats, rule: "22", wantErr: true},
+		{name: "Nothing small enough", formats: videoOnly, rule: "144p", wantErr: true},
+		{name: "Unknown rule", formats: formats, rule: "huge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SelectFormat(tt.formats, tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.ItagNo != tt.want {
+				t.Errorf("SelectFormat() itag = %d, want %d", got.ItagNo, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFormat(t *testing.T) {
+	audio := Format{ItagNo: 140, Extension: "m4a", IsAudioOnly: true}
+	formats := []Format{
+		{ItagNo: 22, Quality: "720p", Extension: "mp4", HasVideo: true, HasAudio: true},
+		{ItagNo: 247, Quality: "720p", Extension: "webm", HasVideo: true, Audio: &audio},
+		{ItagNo: 136, Quality: "720p", Extension: "mp4", HasVideo: true, Audio: &audio},
+		audio,
+	}
+
+	tests := []struct {
+		name      string
+		chosen    Format
+		want      int
+		wantAudio int
+		wantErr   bool
+	}{
+		{name: "Same label, different itag", chosen: Format{ItagNo: 136, Quality: "720p", Audio: &audio}, want: 136, wantAudio: 140},
+		{name: "Without paired audio", chosen: Format{ItagNo: 247, Quality: "720p"}, want: 247},
+		{name: "Muxed", chosen: Format{ItagNo: 22}, want: 22},
+		{name: "Itag gone", chosen: Format{ItagNo: 137, Quality: "1080p"}, wantErr: true},
+		{name: "Audio gone", chosen: Format{ItagNo: 136, Audio: &Format{ItagNo: 251}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindFormat(formats, tt.chosen)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrFormatUnavailable) {
+				t.Errorf("FindFormat() error = %v, want ErrFormatUnavailable", err)
+			}
+			if got.ItagNo != tt.want {
+				t.Errorf("FindFormat() itag = %d, want %d", got.ItagNo, tt.want)
+			}
+			audioItag := 0
+			if got.Audio != nil {
+				audioItag = got.Audio.ItagNo
+			}
+			if audioItag != tt.wantAudio {
+				t.Errorf("FindFormat() audio itag = %d, want %d", audioItag, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestAudioExtractions(t *testing.T) {
+	aac := Format{ItagNo: 140, Extension: "m4a", MimeType: `audio/mp4; codecs="mp4a.40.2"`, IsAudioOnly: true, HasAudio: true, Bitrate: 128000}
+	opus := Format{ItagNo: 251, Extension: "webm", MimeType: `audio/webm; codecs="opus"`, IsAudioOnly: true, HasAudio: true, Bitrate: 160000}
+	formats := []Format{
+		{ItagNo: 137, Quality: "1080p", Extension: "mp4", HasVideo: true, Audio: &aac},
+		aac,
+		opus,
+	}
+
+	extractions := AudioExtractions(formats)
+	if len(extractions) != len(media.AudioFormats) {
+		t.Fatalf("AudioExtractions() returned %d formats, want %d", len(extractions), len(media.AudioFormats))
+	}
+	for i, f := range extractions {
+		if f.ItagNo != opus.ItagNo || f.ExtractAudio != media.AudioFormats[i] || f.Extension != media.AudioFormats[i].Extension() {
+			t.Errorf("extraction %d = %+v, want the best audio as %s", i, f, media.AudioFormats[i])
+		}
+	}
+
+	// Picking a video-only format keeps just its audio
+	mp3 := formats[0].WithAudioExtraction(media.AudioMP3)
+	if mp3.ItagNo != aac.ItagNo || mp3.Audio != nil || mp3.Extension != "mp3" {
+		t.Errorf("WithAudioExtraction() = %+v, want itag 140 as mp3", mp3)
+	}
+
+	// The choice survives looking the format up again
+	got, err := FindFormat(formats, mp3)
+	if err != nil {
+		t.Fatalf("FindFormat() error = %v", err)
+	}
+	if got.ExtractAudio != media.AudioMP3 || got.Extension != "mp3" {
+		t.Errorf("FindFormat() = %+v, want it still extracting mp3", got)
+	}
+
+	tests := []struct {
+		name   string
+		format Format
+		want   bool
+	}{
+		{"AAC to M4A", aac.WithAudioExtraction(media.AudioM4A), false},
+		{"AAC to MP3", aac.WithAudioExtraction(media.AudioMP3), true},
+		{"Opus in WebM to Opus", opus.WithAudioExtraction(media.AudioOpus), true},
+	}
+	for _, tt := range tests {
+		if got := needsConversion(tt.format); got != tt.want {
+			t.Errorf("%s: needsConversion() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPairAudio(t *testing.T) {
+	formats := []Format{
+		{ItagNo: 137, HasVideo: true, Extension: "mp4", FileSize: 1000},
+		{ItagNo: 248, HasVideo: true, Extension: "webm"},
+		{ItagNo: 18, HasVideo: true, HasAudio: true, Extension: "mp4"},
+		{ItagNo: 139, IsAudioOnly: true, HasAudio: true, Extension: "m4a", Bitrate: 48000},
+		{ItagNo: 140, IsAudioOnly: true, HasAudio: true, Extension: "m4a", Bitrate: 128000, FileSize: 200},
+		{ItagNo: 251, IsAudioOnly: true, HasAudio: true, Extension: "webm", Bitrate: 160000},
+	}
+
+	pairAudio(formats)
+
+	want := map[int]int{137: 140, 248: 251}
+	for _, f := range formats {
+		wantAudio, paired := want[f.ItagNo]
+		switch {
+		case paired && (f.Audio == nil || f.Audio.ItagNo != wantAudio):
+			t.Errorf("format %d paired with %+v, want itag %d", f.ItagNo, f.Audio, wantAudio)
+		case !paired && f.Audio != nil:
+			t.Errorf("format %d should not be paired, got itag %d", f.ItagNo, f.Audio.ItagNo)
+		}
+	}
+
+	if got := formats[0].TotalSize(); got != 1200 {
+		t.Errorf("TotalSize() = %d, want 1200", got)
+	}
+}
+
+func TestVideoStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newVideoStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	video := &youtube.Video{ID: "dQw4w9WgXcQ"}
+	store.put(video)
+	if got, ok := store.get(video.ID); !ok || got != video {
+		t.Fatalf("get() = %v, %v; want the stored video", got, ok)
+	}
+
+	// Expired videos are fetched again so their stream URLs are fresh
+	now = now.Add(time.Hour)
+	if _, ok := store.get(video.ID); ok {
+		t.Error("get() returned a video past its TTL")
+	}
+
+	store.put(video)
+	store.forget(video.ID)
+	if _, ok := store.get(video.ID); ok {
+		t.Error("get() returned a forgotten video")
+	}
+
+	// Storing a video drops the ones that expired
+	store.put(&youtube.Video{ID: "aaaaaaaaaaa"})
+	now = now.Add(2 * time.Hour)
+	store.put(video)
+	if len(store.videos) != 1 {
+		t.Errorf("store holds %d videos, want 1", len(store.videos))
+	}
+}
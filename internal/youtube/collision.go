@@ -0,0 +1,183 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CollisionPolicy decides what happens when the output file already exists
+type CollisionPolicy string
+
+const (
+	// CollisionRename saves the download as "name (1).ext", "name (2).ext", ...
+	CollisionRename CollisionPolicy = "rename"
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite CollisionPolicy = "overwrite"
+	// CollisionSkip keeps the existing file if it has the expected size and
+	// downloads it again otherwise
+	CollisionSkip CollisionPolicy = "skip"
+	// CollisionAsk fails with a *FileExistsError so the caller can ask the
+	// user what to do
+	CollisionAsk CollisionPolicy = "ask"
+)
+
+// ErrSkipped is returned when a download is skipped because the file has
+// already been downloaded
+var ErrSkipped = errors.New("already downloaded")
+
+// FileExistsError is returned under CollisionAsk when the output file exists
+type FileExistsError struct {
+	Path string
+}
+
+func (e *FileExistsError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Path)
+}
+
+// ParseCollisionPolicy parses a policy from the config file or command line.
+// CollisionAsk needs someone to answer, so only the TUI sets it.
+func ParseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch p := CollisionPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case CollisionRename, CollisionOverwrite, CollisionSkip:
+		return p, nil
+	case "":
+		return CollisionRename, nil
+	default:
+		return "", fmt.Errorf("unknown collision policy %q (want rename, overwrite or skip)", s)
+	}
+}
+
+// resolveCollision returns the file a download should be written to under
+// policy. size is the expected size of the file, or 0 if it isn't known, in
+// which case any existing file counts as downloaded for CollisionSkip.
+// Names inUse reports as belonging to another download are never shared,
+// whatever the policy; nil treats only existing files as taken.
+func resolveCollision(path string, size int64, policy CollisionPolicy, inUse func(string) bool) (string, error) {
+	if inUse != nil && inUse(path) {
+		return nextFreeName(path, inUse), nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	switch policy {
+	case CollisionOverwrite:
+		return path, nil
+	case CollisionSkip:
+		if size <= 0 || info.Size() == size {
+			return path, ErrSkipped
+		}
+		// Probably an incomplete or different file; replace it
+		return path, nil
+	case CollisionAsk:
+		return path, &FileExistsError{Path: path}
+	default:
+		return nextFreeName(path, inUse), nil
+	}
+}
+
+// nextFreeName returns the first "name (n).ext" next to path that isn't taken
+func nextFreeName(path string, inUse func(string) bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) && (inUse == nil || !inUse(candidate)) {
+			return candidate
+		}
+	}
+}
+
+// claimedFiles are the output files of the downloads running in this
+// process, so concurrent downloads never write to the same .part file
+type claimedFiles struct {
+	mu    sync.Mutex
+	files map[string]bool
+}
+
+// claimed is shared by every Downloader: the TUI creates one per download,
+// and those run side by side with the queue's
+var claimed claimedFiles
+
+// claimOutput resolves the collision policy for the file of videoID and
+// reserves the name it returns until release is called. Names claimed by
+// another running download, or with partial files next to them that belong
+// to another video or are locked by another process, count as taken:
+// opening those .part files would wipe them or fail.
+func (d *Downloader) claimOutput(outputFile, videoID string, size int64) (file string, release func(), err error) {
+	claimed.mu.Lock()
+	defer claimed.mu.Unlock()
+
+	inUse := func(path string) bool {
+		return claimed.files[path] || hasForeignParts(path, videoID)
+	}
+	if file, err = resolveCollision(outputFile, size, d.Collision, inUse); err != nil {
+		return file, nil, err
+	}
+
+	if claimed.files == nil {
+		claimed.files = make(map[string]bool)
+	}
+	claimed.files[file] = true
+	release = func() {
+		claimed.mu.Lock()
+		delete(claimed.files, file)
+		claimed.mu.Unlock()
+	}
+	return file, release, nil
+}
+
+// hasForeignParts reports whether path has .part files that don't belong to
+// a download of videoID: its own, or those of the streams merged or
+// converted into it. A .part without readable resume state counts as
+// foreign, since there's no telling whose it is, and so does one another
+// process is writing.
+func hasForeignParts(path, videoID string) bool {
+	dir, name := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		part := entry.Name()
+		if !strings.HasSuffix(part, partSuffix) || !isPartOf(strings.TrimSuffix(part, partSuffix), name) {
+			continue
+		}
+		partPath := filepath.Join(dir, part)
+		state, err := loadPartState(partPath + stateSuffix)
+		if err != nil || state.VideoID != videoID || partLocked(partPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPartOf reports whether file is name itself or one of its streams,
+// "base.f<itag>.ext" (see streamFiles and sourceFile)
+func isPartOf(file, name string) bool {
+	if file == name {
+		return true
+	}
+	rest, ok := strings.CutPrefix(file, strings.TrimSuffix(name, filepath.Ext(name))+".f")
+	if !ok {
+		return false
+	}
+	itag, ext, ok := strings.Cut(rest, ".")
+	if !ok || itag == "" || ext == "" {
+		return false
+	}
+	return strings.Trim(itag, "0123456789") == ""
+}
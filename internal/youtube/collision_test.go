@@ -0,0 +1,208 @@
+package youtube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveCollision(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "video.mp4")
+	os.WriteFile(existing, []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(dir, "video (1).mp4"), nil, 0644)
+	missing := filepath.Join(dir, "other.mp4")
+
+	tests := []struct {
+		name    string
+		path    string
+		size    int64
+		policy  CollisionPolicy
+		want    string
+		wantErr error
+	}{
+		{"New file", missing, 5, CollisionRename, missing, nil},
+		{"Rename", existing, 5, CollisionRename, filepath.Join(dir, "video (2).mp4"), nil},
+		{"Overwrite", existing, 5, CollisionOverwrite, existing, nil},
+		{"Skip same size", existing, 5, CollisionSkip, existing, ErrSkipped},
+		{"Skip unknown size", existing, 0, CollisionSkip, existing, ErrSkipped},
+		{"Replace different size", existing, 9, CollisionSkip, existing, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveCollision(tt.path, tt.size, tt.policy, nil)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("resolveCollision() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ParseCollisionPolicy("ask"); err == nil {
+		t.Error("ParseCollisionPolicy() should leave ask to the TUI")
+	}
+
+	var exists *FileExistsError
+	if _, err := resolveCollision(existing, 5, CollisionAsk, nil); !errors.As(err, &exists) || exists.Path != existing {
+		t.Errorf("CollisionAsk error = %v, want a FileExistsError for %s", err, existing)
+	}
+}
+
+func TestClaimOutput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "video.mp4")
+	renamed := filepath.Join(dir, "video (1).mp4")
+
+	tests := []struct {
+		name    string
+		part    string // output the .part of video "abc" is left for
+		videoID string
+		policy  CollisionPolicy
+		want    string
+	}{
+		{"No partial files", "", "abc", CollisionRename, output},
+		{"Own .part is resumed", output, "abc", CollisionRename, output},
+		{"Other video's .part", output, "xyz", CollisionRename, renamed},
+		{"Other video's stream", filepath.Join(dir, "video.f137.mp4"), "xyz", CollisionOverwrite, renamed},
+		{"Unrelated file", filepath.Join(dir, "video.final.mp4"), "xyz", CollisionRename, output},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.part != "" {
+				writePart(t, tt.part, 18, 10, "01234")
+				defer os.Remove(tt.part + partSuffix)
+				defer os.Remove(tt.part + partSuffix + stateSuffix)
+			}
+
+			d := &Downloader{Collision: tt.policy}
+			got, release, err := d.claimOutput(output, tt.videoID, 10)
+			if err != nil {
+				t.Fatalf("claimOutput() error = %v", err)
+			}
+			release()
+			if got != tt.want {
+				t.Errorf("claimOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartLocked(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "video.mp4")
+	part, err := openPart(output, "abc", 18, 10)
+	if err != nil {
+		t.Fatalf("openPart() error = %v", err)
+	}
+	defer part.file.Close()
+
+	// A download of the same video in another process neither shares the
+	// .part file nor has it swept away
+	if _, err := openPart(output, "abc", 18, 10); !errors.Is(err, errPartLocked) {
+		t.Errorf("openPart() of a locked file error = %v, want %v", err, errPartLocked)
+	}
+	d := &Downloader{Collision: CollisionRename}
+	got, release, err := d.claimOutput(output, "abc", 10)
+	if err != nil {
+		t.Fatalf("claimOutput() error = %v", err)
+	}
+	release()
+	if want := filepath.Join(dir, "video (1).mp4"); got != want {
+		t.Errorf("claimOutput() = %q, want %q", got, want)
+	}
+	old := time.Now().Add(-2 * StaleTempAge)
+	os.Chtimes(output+partSuffix, old, old)
+	os.Chtimes(part.statePath, old, old)
+	SweepTempFiles(dir, false)
+	if _, err := os.Stat(output + partSuffix); err != nil {
+		t.Errorf("locked .part was swept: %v", err)
+	}
+
+	if err := part.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got, release, _ := d.claimOutput(output, "abc", 10); got != output {
+		t.Errorf("claimOutput() after Close = %q, want %q", got, output)
+	} else {
+		release()
+	}
+}
+
+func TestConcurrentDownloadsToSameName(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  [2]string
+	}{
+		{"Same title", [2]string{"abc", "xyz"}},
+		{"Same video queued twice", [2]string{"abc", "abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "video.mp4")
+
+			// Claim both names before either download writes, as two queue
+			// workers starting together would. Each has its own Downloader,
+			// as the TUI's downloads do.
+			var claimed, wg sync.WaitGroup
+			claimed.Add(2)
+			data := make([][]byte, 2)
+			files := make([]string, 2)
+			errs := make([]error, 2)
+			for i, id := range tt.ids {
+				data[i] = bytes.Repeat([]byte{byte('a' + i)}, 2*minRangeSize)
+				server := newRangeServer(t, data[i])
+
+				wg.Add(1)
+				go func(i int, id string) {
+					defer wg.Done()
+					d := NewDownloader(NewClient())
+					d.Connections = 2
+					size := int64(len(data[i]))
+					file, release, err := d.claimOutput(output, id, size)
+					claimed.Done()
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					defer release()
+					claimed.Wait()
+
+					part, err := openPart(file, id, 18, size)
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					tracker := newProgressTracker(0, size, nil)
+					err = d.fetchRanges(context.Background(), newStreamSource(server.URL, nil), part, part.plan(d.Connections), tracker)
+					if closeErr := part.Close(); err == nil {
+						err = closeErr
+					}
+					if err == nil {
+						err = part.finish(file, size)
+					}
+					files[i], errs[i] = file, err
+				}(i, id)
+			}
+			wg.Wait()
+
+			if files[0] == files[1] {
+				t.Fatalf("both downloads were saved to %s", files[0])
+			}
+			for i := range files {
+				if errs[i] != nil {
+					t.Fatalf("download %d error = %v", i, errs[i])
+				}
+				if got, _ := os.ReadFile(files[i]); !bytes.Equal(got, data[i]) {
+					t.Errorf("%s doesn't hold download %d", files[i], i)
+				}
+			}
+		})
+	}
+}
@@ -2,24 +2,100 @@ package youtube
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kkdai/youtube/v2"
+	"github.com/phetzy/yt-downloader/internal/archive"
+	"github.com/phetzy/yt-downloader/internal/media"
+	"github.com/phetzy/yt-downloader/internal/utils"
 )
 
 // Downloader handles downloading YouTube videos
 type Downloader struct {
 	client *Client
+
+	// KeepPartial keeps the .part file of a failed or cancelled download so
+	// it can be resumed later. When false, failed downloads are cleaned up.
+	KeepPartial bool
+
+	// SweepTemp removes the temporary files crashed downloads left in an
+	// output directory before the first download into it; see
+	// SweepTempFiles. Resumable .part files are kept when KeepPartial is.
+	SweepTemp bool
+
+	// Connections is the number of concurrent range requests used to fetch
+	// a stream. YouTube throttles single streams, so splitting the file
+	// across several connections is usually much faster. 0 or 1 downloads
+	// over a single connection.
+	Connections int
+
+	// Template names downloaded files relative to the output directory. nil
+	// uses DefaultTemplate.
+	Template *Template
+
+	// Collision decides what happens when the output file already exists
+	Collision CollisionPolicy
+
+	// Archive records completed downloads; videos already in it are
+	// skipped. nil disables the archive.
+	Archive *archive.Archive
+
+	// DiskReserve is the number of bytes to leave free. A download that
+	// would leave less fails with utils.ErrDiskFull before it starts.
+	DiskReserve int64
+
+	// Retry decides how dropped streams are reopened; each connection
+	// continues from the last byte it wrote
+	Retry RetryPolicy
+
+	// Limiter caps the download speed. Downloaders sharing a limiter share
+	// its limit. nil is unlimited.
+	Limiter *RateLimiter
+
+	// SpeedEstimator and SpeedWindow decide how the current speed in
+	// DownloadProgress is measured. The zero values use an exponentially
+	// weighted average over DefaultSpeedWindow.
+	SpeedEstimator SpeedEstimator
+	SpeedWindow    time.Duration
+
+	// ThrottleSpeed is the speed in bytes per second below which a
+	// connection counts as throttled once it has stayed there for
+	// ThrottleWindow; its stream URL is then resolved again. 0 disables
+	// the check.
+	ThrottleSpeed  int64
+	ThrottleWindow time.Duration
+
+	// FFmpeg is the ffmpeg binary used to merge streams and convert audio.
+	// Empty looks for ffmpeg on PATH.
+	FFmpeg string
+
+	// PostProcessors run in order on every finished download. nil runs
+	// DefaultPostProcessors.
+	PostProcessors []PostProcessor
+
+	// KeepOriginal keeps the downloaded streams once they've been merged
+	// or converted into the final file
+	KeepOriginal bool
 }
 
 // NewDownloader creates a new Downloader instance
 func NewDownloader(client *Client) *Downloader {
 	return &Downloader{
-		client: client,
+		client:      client,
+		KeepPartial: true,
+		SweepTemp:   true,
+		Collision:   CollisionRename,
+		Retry:       DefaultRetryPolicy,
+
+		ThrottleSpeed:  DefaultThrottleSpeed,
+		ThrottleWindow: DefaultThrottleWindow,
 	}
 }
 
@@ -28,60 +104,503 @@ type DownloadProgress struct {
 	BytesDownloaded int64
 	TotalBytes      int64
 	Percentage      float64
-	Speed           float64 // bytes per second
-	ETA             int     // seconds remaining
+	Speed           float64 // current bytes per second, see Downloader.SpeedEstimator
+	AverageSpeed    float64 // bytes per second since the download started
+	ETA             int     // seconds remaining at the current speed
 	StartTime       time.Time
+
+	// Attempt is the reconnect attempt under way after a dropped stream,
+	// out of MaxAttempts. It's 0 while data is flowing.
+	Attempt     int
+	MaxAttempts int
+
+	// Event describes the latest notable thing that happened during the
+	// download, such as a refreshed stream URL. Later reports repeat it so
+	// it isn't lost when updates are dropped.
+	Event string
+
+	// Step is the post-processing step under way once every byte is
+	// downloaded, number StepNumber of Steps. Empty while downloading.
+	Step       string
+	StepNumber int
+	Steps      int
 }
 
 // ProgressCallback is called periodically during download
 type ProgressCallback func(progress DownloadProgress)
 
-// Download downloads a video in the specified format to the given path
-func (d *Downloader) Download(ctx context.Context, videoID string, format Format, outputPath string, callback ProgressCallback) error {
-	// Get video information
-	video, err := d.client.client.GetVideo(videoID)
+// Download downloads a video in the specified format to the given path and
+// returns the file it was saved to. The file then goes through the
+// post-processors; formats with a paired audio stream are downloaded as two
+// streams and merged into one file by them. If the file was already
+// downloaded, its path is returned with ErrSkipped. If only post-processing
+// steps that run on the finished file failed, its path is returned with a
+// *PostProcessError.
+func (d *Downloader) Download(ctx context.Context, videoID string, format Format, outputPath string, callback ProgressCallback) (string, error) {
+	return d.DownloadEntry(ctx, PlaylistEntry{ID: videoID}, format, outputPath, callback)
+}
+
+// DownloadEntry downloads a playlist entry like Download, making its index
+// available to the output template
+func (d *Downloader) DownloadEntry(ctx context.Context, entry PlaylistEntry, format Format, outputPath string, callback ProgressCallback) (string, error) {
+	if d.Archive == nil {
+		return d.download(ctx, entry, format, outputPath, callback)
+	}
+
+	done, err := d.Archive.Has(entry.ID, format.ItagNo)
 	if err != nil {
-		return fmt.Errorf("failed to get video: %w", err)
+		return "", fmt.Errorf("failed to check download archive: %w", err)
+	}
+	if done {
+		return "", fmt.Errorf("%w: %s is in the download archive", ErrSkipped, entry.ID)
+	}
+
+	file, err := d.download(ctx, entry, format, outputPath, callback)
+	var postErr *PostProcessError
+	if err != nil && !errors.As(err, &postErr) {
+		return file, err
+	}
+	if err := d.Archive.Add(entry.ID, format.ItagNo); err != nil {
+		return file, fmt.Errorf("saved %s but failed to update the download archive: %w", file, err)
 	}
+	return file, err
+}
 
-	// Find the matching format
-	var selectedFormat *youtube.Format
-	for _, f := range video.Formats {
-		if f.ItagNo == format.ItagNo {
-			selectedFormat = &f
-			break
+// download fetches the video of entry into outputPath
+func (d *Downloader) download(ctx context.Context, entry PlaylistEntry, format Format, outputPath string, callback ProgressCallback) (string, error) {
+	video, selectedFormat, err := d.resolveFormat(entry.ID, format)
+	if err != nil {
+		return "", err
+	}
+
+	outputFile, err := d.outputFile(video, format, entry.Index, outputPath)
+	if err != nil {
+		return "", err
+	}
+	converting := format.ExtractAudio != "" && needsConversion(format)
+
+	// Clear out what crashed downloads left there before writing to it
+	d.sweepOnce(outputPath)
+
+	// The size of a merged or converted file isn't known until it's written
+	var size int64
+	if format.Audio == nil && !converting {
+		size = selectedFormat.ContentLength
+	}
+	outputFile, release, err := d.claimOutput(outputFile, entry.ID, size)
+	if err != nil {
+		return outputFile, err
+	}
+	defer release()
+	if err := utils.CheckDiskSpace(filepath.Dir(outputFile), d.spaceNeeded(video, selectedFormat, format, outputFile), d.DiskReserve); err != nil {
+		return outputFile, err
+	}
+
+	file := &PostFile{
+		Path:   outputFile,
+		Dir:    outputPath,
+		Video:  d.client.videoInfo(video),
+		Format: format,
+		FFmpeg: media.FindFFmpeg(d.FFmpeg),
+	}
+	tracker := d.newProgressTracker(selectedFormat.ContentLength, callback)
+	switch {
+	case format.Audio != nil:
+		file.Sources, err = d.downloadMerged(ctx, video, selectedFormat, *format.Audio, outputFile, tracker)
+	case converting:
+		file.Sources, err = d.downloadSource(ctx, video, selectedFormat, format, outputFile, tracker)
+	default:
+		err = d.fetchStream(ctx, video, selectedFormat, outputFile, tracker)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			// The stream URLs may have expired; fetch the video again next time
+			d.client.videos.forget(entry.ID)
 		}
+		return outputFile, err
 	}
+	tracker.complete()
+
+	err = d.postProcess(ctx, file, tracker)
+	return file.Path, err
+}
 
-	if selectedFormat == nil {
-		return fmt.Errorf("format not found")
+// resolveFormat returns the video with the given ID and its stream for
+// format. The video the format was picked from, fetched earlier this
+// session, is used when there is one. A format picked from cached
+// information that's out of date may name streams the video no longer has;
+// the video is then fetched again once and the cache entry refreshed.
+func (d *Downloader) resolveFormat(videoID string, format Format) (*youtube.Video, *youtube.Format, error) {
+	video, err := d.client.video(videoID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get video: %w", err)
+	}
+	stream, err := findStreams(video, format)
+	if !errors.Is(err, ErrFormatUnavailable) {
+		return video, stream, err
 	}
 
-	// Create output file
-	outputFile := filepath.Join(outputPath, sanitizeFilename(video.Title)+"."+format.Extension)
-	file, err := os.Create(outputFile)
+	d.client.videos.forget(videoID)
+	if video, err = d.client.video(videoID); err != nil {
+		return nil, nil, fmt.Errorf("failed to get video: %w", err)
+	}
+	if d.client.Cache != nil {
+		// A cache that can't be written only costs a fetch next time
+		_ = d.client.Cache.Put(d.client.videoInfo(video))
+	}
+	if stream, err = findStreams(video, format); err != nil {
+		return nil, nil, err
+	}
+	return video, stream, nil
+}
+
+// findStreams returns the stream of video for format, checking that its
+// paired audio stream is there too
+func findStreams(video *youtube.Video, format Format) (*youtube.Format, error) {
+	stream, err := findFormat(video, format.ItagNo)
+	if err != nil {
+		return nil, err
+	}
+	if format.Audio != nil {
+		if _, err := findFormat(video, format.Audio.ItagNo); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+// outputFile returns where video is saved inside outputPath, creating the
+// subdirectories named by the template
+func (d *Downloader) outputFile(video *youtube.Video, format Format, playlistIndex int, outputPath string) (string, error) {
+	tmpl := d.Template
+	if tmpl == nil {
+		tmpl, _ = ParseTemplate(DefaultTemplate)
+	}
+
+	name, err := tmpl.Execute(TemplateData{
+		ID:            video.ID,
+		Title:         video.Title,
+		Author:        video.Author,
+		UploadDate:    video.PublishDate,
+		Duration:      video.Duration,
+		Views:         video.Views,
+		Format:        format,
+		PlaylistIndex: playlistIndex,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %q is outside the download directory", ErrInvalidTemplate, name)
+	}
+
+	outputFile := filepath.Join(outputPath, name)
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	return outputFile, nil
+}
+
+// downloadMerged downloads a video-only stream and its paired audio stream
+// at the same time, for the merge step to mux, and returns their files
+func (d *Downloader) downloadMerged(ctx context.Context, video *youtube.Video, videoFormat *youtube.Format, audio Format, outputFile string, tracker *progressTracker) ([]string, error) {
+	audioFormat, err := findFormat(video, audio.ItagNo)
+	if err != nil {
+		return nil, err
+	}
+
+	videoFile, audioFile := streamFiles(outputFile, videoFormat.ItagNo, audioFormat.ItagNo, audio.Extension)
+	tracker.expect(audioFormat.ContentLength)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	streams := []struct {
+		format *youtube.Format
+		file   string
+	}{
+		{videoFormat, videoFile},
+		{audioFormat, audioFile},
+	}
+	errs := make(chan error, len(streams))
+	for _, s := range streams {
+		go func(format *youtube.Format, file string) {
+			if streamComplete(file, format.ContentLength) {
+				// Already fetched by an attempt that failed to merge
+				tracker.resume(format.ContentLength)
+				errs <- nil
+				return
+			}
+			errs <- d.fetchStream(ctx, video, format, file, tracker)
+		}(s.format, s.file)
+	}
+
+	var firstErr error
+	for range streams {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	if firstErr != nil {
+		d.cleanupStreams(videoFile, audioFile)
+		return nil, firstErr
+	}
+	return []string{videoFile, audioFile}, nil
+}
+
+// cleanupStreams removes the finished streams of a download that failed
+// before they were merged or converted. They are kept when partial
+// downloads are, so a retry can use them without downloading them again.
+func (d *Downloader) cleanupStreams(files ...string) {
+	if !d.KeepPartial {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+}
+
+// streamFiles returns the files the two streams of a merged download are
+// fetched to: next to the output, named after their itags
+func streamFiles(outputFile string, videoItag, audioItag int, audioExt string) (string, string) {
+	base := strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	videoFile := fmt.Sprintf("%s.f%d%s", base, videoItag, filepath.Ext(outputFile))
+	audioFile := fmt.Sprintf("%s.f%d.%s", base, audioItag, audioExt)
+	return videoFile, audioFile
+}
+
+// spaceNeeded returns the bytes a download still has to write to disk.
+// Data fetched by an earlier attempt is subtracted, and a merged or
+// converted download also needs room for the file it writes while the
+// streams are still on disk.
+func (d *Downloader) spaceNeeded(video *youtube.Video, videoFormat *youtube.Format, format Format, outputFile string) int64 {
+	audio := format.Audio
+	if audio == nil {
+		if format.ExtractAudio != "" && needsConversion(format) {
+			// Converted audio is rarely larger than its source, FLAC aside
+			return pendingBytes(sourceFile(outputFile, format), video.ID, videoFormat) + videoFormat.ContentLength
+		}
+		return pendingBytes(outputFile, video.ID, videoFormat)
+	}
+
+	audioFormat, err := findFormat(video, audio.ItagNo)
+	if err != nil {
+		// Reported when the download starts
+		return 0
+	}
+	videoFile, audioFile := streamFiles(outputFile, videoFormat.ItagNo, audioFormat.ItagNo, audio.Extension)
+	return pendingBytes(videoFile, video.ID, videoFormat) + pendingBytes(audioFile, video.ID, audioFormat) +
+		videoFormat.ContentLength + audioFormat.ContentLength
+}
+
+// fetchStream downloads one stream of video to outputFile through a .part
+// file, continuing a previous attempt if there is one
+func (d *Downloader) fetchStream(ctx context.Context, video *youtube.Video, format *youtube.Format, outputFile string, tracker *progressTracker) error {
+	part, err := openPart(outputFile, video.ID, format.ItagNo, format.ContentLength)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
+	pending := part.plan(d.connections())
 
-	// Get the stream
-	stream, _, err := d.client.client.GetStream(video, selectedFormat)
+	// Get the stream URL; every connection requests its own range of it
+	streamURL, err := d.client.streamURL(ctx, video, format)
 	if err != nil {
+		part.Close()
+		d.cleanupFailed(part)
 		return fmt.Errorf("failed to get stream: %w", err)
 	}
-	defer stream.Close()
 
 	// Download with progress tracking
-	return d.downloadWithProgress(ctx, stream, file, selectedFormat.ContentLength, callback)
+	src := newStreamSource(streamURL, func(ctx context.Context) (string, error) {
+		return d.client.refreshStreamURL(ctx, video.ID, format.ItagNo)
+	})
+	tracker.resume(part.written())
+	err = d.fetchRanges(ctx, src, part, pending, tracker)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// Only give the file its final name once every byte is there
+		err = part.finish(outputFile, format.ContentLength)
+	}
+	if err != nil {
+		d.cleanupFailed(part)
+		return err
+	}
+	return nil
+}
+
+// findFormat returns the format of video with the given itag
+func findFormat(video *youtube.Video, itag int) (*youtube.Format, error) {
+	for i := range video.Formats {
+		if video.Formats[i].ItagNo == itag {
+			return &video.Formats[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: itag %d of video %s", ErrFormatUnavailable, itag, video.ID)
+}
+
+// streamComplete reports whether a finished stream of size bytes is already
+// on disk at path
+func streamComplete(path string, size int64) bool {
+	if _, err := os.Stat(path + partSuffix); err == nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && size > 0 && info.Size() == size
+}
+
+// connections returns the number of concurrent requests to use
+func (d *Downloader) connections() int {
+	if d.Connections < 1 {
+		return 1
+	}
+	return d.Connections
+}
+
+// cleanupFailed removes the partial file of a failed or cancelled download
+// unless partial downloads are being kept for resuming and this one can be
+// resumed
+func (d *Downloader) cleanupFailed(part *partFile) {
+	if !d.KeepPartial || !part.resumable() {
+		part.discard()
+	}
+}
+
+// fetchRanges downloads the pending ranges of part over up to
+// d.Connections concurrent requests. The first failure stops the others.
+func (d *Downloader) fetchRanges(ctx context.Context, src *streamSource, part *partFile, pending []int, tracker *progressTracker) error {
+	workers := d.connections()
+	if workers > len(pending) {
+		workers = len(pending)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ranges := make(chan int, len(pending))
+	for _, i := range pending {
+		ranges <- i
+	}
+	close(ranges)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ranges {
+				if err := d.fetchRange(ctx, src, part, i, tracker); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// fetchRange downloads what's left of range i of part. A stream that drops
+// with a transient error is reopened at the current offset, following
+// d.Retry. A throttled or expired stream URL is resolved again and the
+// range continues from the same offset.
+func (d *Downloader) fetchRange(ctx context.Context, src *streamSource, part *partFile, i int, tracker *progressTracker) error {
+	writer := part.rangeWriter(i)
+	throttleRefreshes, expiredRefreshes := 0, 0
+
+	for attempt := 1; ; attempt++ {
+		offset, end := part.next(i)
+		streamURL := src.get()
+		stream := d.client.rangeReader(ctx, streamURL, offset, end)
+		var reader io.Reader = stream
+		if d.ThrottleSpeed > 0 && throttleRefreshes < maxThrottleRefreshes {
+			reader = newThrottleWatch(reader, d.ThrottleSpeed, d.throttleWindow())
+		}
+		if attempt > 1 {
+			reader = &reconnectReader{Reader: reader, recovered: func() { tracker.retrying(writer, 0, 0) }}
+		}
+
+		err := d.downloadWithProgress(ctx, reader, writer, tracker)
+		stream.Close()
+		if err == nil && attempt > 1 {
+			tracker.retrying(writer, 0, 0)
+		}
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		// Only consecutive failures count towards the limits
+		if next, _ := part.next(i); next > offset {
+			attempt = 1
+			expiredRefreshes = 0
+		}
+
+		var throttled *throttleError
+		switch {
+		case errors.As(err, &throttled):
+			throttleRefreshes++
+			if err := d.refreshStream(ctx, src, streamURL, tracker, fmt.Sprintf("%v, refreshed the stream URL", err)); err != nil {
+				return err
+			}
+			attempt = 0
+			continue
+		case isExpired(err) && expiredRefreshes < maxExpiredRefreshes:
+			expiredRefreshes++
+			if err := d.refreshStream(ctx, src, streamURL, tracker, "stream URL expired, refreshed it"); err != nil {
+				return err
+			}
+			attempt = 0
+			continue
+		}
+
+		if !isRetryable(err) || d.Retry.MaxAttempts <= 1 {
+			return err
+		}
+		if attempt >= d.Retry.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		tracker.retrying(writer, attempt+1, d.Retry.MaxAttempts)
+		if err := d.Retry.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// refreshStream resolves the stream URL of src again and reports event
+// once the new URL is in place. Connections that find the URL already
+// refreshed by another one just pick it up.
+func (d *Downloader) refreshStream(ctx context.Context, src *streamSource, stale string, tracker *progressTracker, event string) error {
+	_, refreshed, err := src.refresh(ctx, stale)
+	if err != nil {
+		return err
+	}
+	if refreshed {
+		tracker.event(event)
+	}
+	return nil
+}
+
+// throttleWindow returns how long a slow stream is tolerated
+func (d *Downloader) throttleWindow() time.Duration {
+	if d.ThrottleWindow <= 0 {
+		return DefaultThrottleWindow
+	}
+	return d.ThrottleWindow
 }
 
 // downloadWithProgress downloads from a stream with progress tracking
-func (d *Downloader) downloadWithProgress(ctx context.Context, reader io.Reader, writer io.Writer, totalSize int64, callback ProgressCallback) error {
+func (d *Downloader) downloadWithProgress(ctx context.Context, reader io.Reader, writer io.Writer, tracker *progressTracker) error {
 	buffer := make([]byte, 32*1024) // 32KB buffer
-	var downloaded int64
-	startTime := time.Now()
-	lastUpdate := startTime
 
 	for {
 		select {
@@ -97,49 +616,17 @@ func (d *Downloader) downloadWithProgress(ctx context.Context, reader io.Reader,
 				return writeErr
 			}
 
-			downloaded += int64(n)
-
-			// Update progress every 100ms
-			now := time.Now()
-			if now.Sub(lastUpdate) >= 100*time.Millisecond || downloaded == totalSize {
-				elapsed := now.Sub(startTime).Seconds()
-				speed := float64(downloaded) / elapsed
-				percentage := float64(downloaded) / float64(totalSize) * 100
+			tracker.add(int64(n))
 
-				var eta int
-				if speed > 0 {
-					remaining := totalSize - downloaded
-					eta = int(float64(remaining) / speed)
-				}
-
-				if callback != nil {
-					callback(DownloadProgress{
-						BytesDownloaded: downloaded,
-						TotalBytes:      totalSize,
-						Percentage:      percentage,
-						Speed:           speed,
-						ETA:             eta,
-						StartTime:       startTime,
-					})
+			if d.Limiter != nil {
+				if err := d.Limiter.WaitN(ctx, n); err != nil {
+					return err
 				}
-
-				lastUpdate = now
 			}
 		}
 
 		if err != nil {
 			if err == io.EOF {
-				// Download complete
-				if callback != nil {
-					callback(DownloadProgress{
-						BytesDownloaded: downloaded,
-						TotalBytes:      totalSize,
-						Percentage:      100,
-						Speed:           0,
-						ETA:             0,
-						StartTime:       startTime,
-					})
-				}
 				return nil
 			}
 			return err
@@ -147,25 +634,204 @@ func (d *Downloader) downloadWithProgress(ctx context.Context, reader io.Reader,
 	}
 }
 
-// sanitizeFilename removes invalid characters from filename
-func sanitizeFilename(filename string) string {
-	// Replace invalid characters with underscore
-	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	result := filename
+// progressTracker combines the bytes downloaded by every connection into a
+// single DownloadProgress, reported at most every 100ms
+type progressTracker struct {
+	callback ProgressCallback
 
-	for _, char := range invalid {
-		result = filepath.Base(result)
-		for i := 0; i < len(result); i++ {
-			if string(result[i]) == char {
-				result = result[:i] + "_" + result[i+1:]
-			}
+	mu         sync.Mutex
+	offset     int64 // bytes already on disk before this attempt
+	downloaded int64 // bytes on disk, including offset
+	totalSize  int64
+	startTime  time.Time
+	lastUpdate time.Time
+	meter      speedMeter
+
+	// reconnecting holds the attempt under way for each connection that
+	// is reopening a dropped stream
+	reconnecting map[any]int
+	maxAttempts  int
+
+	lastEvent string
+}
+
+// newProgressTracker creates a tracker for a download that already has
+// offset of totalSize bytes on disk
+func newProgressTracker(offset, totalSize int64, callback ProgressCallback) *progressTracker {
+	now := time.Now()
+	t := &progressTracker{
+		callback:   callback,
+		offset:     offset,
+		downloaded: offset,
+		totalSize:  totalSize,
+		startTime:  now,
+		lastUpdate: now,
+	}
+	t.setMeter(newSpeedMeter(SpeedEWMA, DefaultSpeedWindow))
+	return t
+}
+
+// newProgressTracker creates a tracker for a new download of totalSize
+// bytes, measuring its speed the way d is configured to
+func (d *Downloader) newProgressTracker(totalSize int64, callback ProgressCallback) *progressTracker {
+	t := newProgressTracker(0, totalSize, callback)
+	t.setMeter(newSpeedMeter(d.SpeedEstimator, d.SpeedWindow))
+	return t
+}
+
+// setMeter measures the speed with meter from the start of the download
+func (t *progressTracker) setMeter(meter speedMeter) {
+	meter.sample(t.startTime, 0)
+	t.meter = meter
+}
+
+// resume records n bytes that were already on disk before this attempt
+func (t *progressTracker) resume(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.offset += n
+	t.downloaded += n
+}
+
+// add records n more bytes and reports progress if it's time to
+func (t *progressTracker) add(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.downloaded += n
+
+	// Update progress every 100ms
+	now := time.Now()
+	if now.Sub(t.lastUpdate) >= 100*time.Millisecond || t.downloaded == t.totalSize {
+		t.reportLocked(now)
+	}
+}
+
+// retrying records that the connection identified by key is reopening its
+// stream for the given attempt, or has recovered if attempt is 0, and
+// reports it right away
+func (t *progressTracker) retrying(key any, attempt, maxAttempts int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if attempt == 0 {
+		delete(t.reconnecting, key)
+	} else {
+		if t.reconnecting == nil {
+			t.reconnecting = make(map[any]int)
+		}
+		t.reconnecting[key] = attempt
+		t.maxAttempts = maxAttempts
+	}
+	t.reportLocked(time.Now())
+}
+
+// event records something notable that happened and reports it right away
+func (t *progressTracker) event(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastEvent = msg
+	t.reportLocked(time.Now())
+}
+
+// reportLocked calls the callback with the current progress; t.mu must be
+// held
+func (t *progressTracker) reportLocked(now time.Time) {
+	// Bytes that were already on disk don't count towards the speed
+	fetched := t.downloaded - t.offset
+	speed := t.meter.sample(now, fetched)
+	var average float64
+	if elapsed := now.Sub(t.startTime).Seconds(); elapsed > 0 {
+		average = float64(fetched) / elapsed
+	}
+
+	var percentage float64
+	if t.totalSize > 0 {
+		percentage = float64(t.downloaded) / float64(t.totalSize) * 100
+	}
+
+	var eta int
+	if speed > 0 {
+		remaining := t.totalSize - t.downloaded
+		eta = int(float64(remaining) / speed)
+	}
+
+	// With several connections, show the one furthest into its retries
+	var attempt, maxAttempts int
+	for _, a := range t.reconnecting {
+		if a > attempt {
+			attempt = a
 		}
 	}
+	if attempt > 0 {
+		maxAttempts = t.maxAttempts
+	}
+
+	if t.callback != nil {
+		t.callback(DownloadProgress{
+			BytesDownloaded: t.downloaded,
+			TotalBytes:      t.totalSize,
+			Percentage:      percentage,
+			Speed:           speed,
+			AverageSpeed:    average,
+			ETA:             eta,
+			StartTime:       t.startTime,
+			Attempt:         attempt,
+			MaxAttempts:     maxAttempts,
+			Event:           t.lastEvent,
+		})
+	}
+
+	t.lastUpdate = now
+}
 
-	// Limit length to 200 characters
-	if len(result) > 200 {
-		result = result[:200]
+// expect adds n bytes to the size of the download
+func (t *progressTracker) expect(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totalSize += n
+}
+
+// step reports that post-processing step number of steps, called name, has
+// started
+func (t *progressTracker) step(name string, number, steps int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.callback != nil {
+		p := t.completedLocked()
+		p.Step, p.StepNumber, p.Steps = name, number, steps
+		t.callback(p)
 	}
+}
 
-	return result
+// complete reports the finished download
+func (t *progressTracker) complete() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.callback != nil {
+		t.callback(t.completedLocked())
+	}
+}
+
+// completedLocked returns the progress of the finished download; t.mu must
+// be held
+func (t *progressTracker) completedLocked() DownloadProgress {
+	var average float64
+	if elapsed := time.Since(t.startTime).Seconds(); elapsed > 0 {
+		average = float64(t.downloaded-t.offset) / elapsed
+	}
+	return DownloadProgress{
+		BytesDownloaded: t.downloaded,
+		TotalBytes:      t.totalSize,
+		Percentage:      100,
+		Speed:           0,
+		AverageSpeed:    average,
+		ETA:             0,
+		StartTime:       t.startTime,
+		Event:           t.lastEvent,
+	}
 }
@@ -0,0 +1,371 @@
+package youtube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// newRangeServer serves data, honouring the googlevideo range query parameter
+func newRangeServer(t *testing.T, data []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, end := 0, len(data)-1
+		if rng := r.URL.Query().Get("range"); rng != "" {
+			parts := strings.SplitN(rng, "-", 2)
+			start, _ = strconv.Atoi(parts[0])
+			end, _ = strconv.Atoi(parts[1])
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.Write(data[start : end+1])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRangeReaderFromOffset(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	server := newRangeServer(t, data)
+
+	reader := newRangeReader(context.Background(), server.Client(), nil, server.URL, 5, int64(len(data)))
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data[5:]) {
+		t.Errorf("ReadAll() = %q, want %q", got, data[5:])
+	}
+}
+
+func TestRangeReaderShortResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("short"))
+	}))
+	defer server.Close()
+
+	reader := newRangeReader(context.Background(), server.Client(), nil, server.URL, 0, 100)
+	defer reader.Close()
+
+	if _, err := io.ReadAll(reader); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAll() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestRangeReaderIgnoredRange(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Always the whole stream, whatever was asked for
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		offset int64
+		end    int64
+		want   int // bytes read before the error
+	}{
+		{"Longer than the range", 0, 10, 10},
+		{"Range header ignored", 5, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newRangeReader(context.Background(), server.Client(), nil, server.URL, tt.offset, tt.end)
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if !errors.Is(err, errRangeIgnored) {
+				t.Errorf("ReadAll() error = %v, want %v", err, errRangeIgnored)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ReadAll() read %d bytes, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+// writePart opens the .part file for outputFile and writes data to it as a
+// single stream, as an interrupted first attempt would
+func writePart(t *testing.T, outputFile string, itag int, contentLength int64, data string) *partFile {
+	t.Helper()
+
+	part, err := openPart(outputFile, "abc", itag, contentLength)
+	if err != nil {
+		t.Fatalf("openPart() error = %v", err)
+	}
+	pending := part.plan(1)
+	if _, err := part.rangeWriter(pending[0]).Write([]byte(data)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := part.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return part
+}
+
+func TestOpenPartResume(t *testing.T) {
+	tests := []struct {
+		name          string
+		itag          int
+		contentLength int64
+		wantWritten   int64
+	}{
+		{
+			name:          "Same video and format",
+			itag:          18,
+			contentLength: 10,
+			wantWritten:   5,
+		},
+		{
+			name:          "Different format",
+			itag:          22,
+			contentLength: 10,
+			wantWritten:   0,
+		},
+		{
+			name:          "Different size",
+			itag:          18,
+			contentLength: 12,
+			wantWritten:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "video.mp4")
+			writePart(t, outputFile, 18, 10, "01234")
+
+			part, err := openPart(outputFile, "abc", tt.itag, tt.contentLength)
+			if err != nil {
+				t.Fatalf("openPart() error = %v", err)
+			}
+			defer part.Close()
+
+			if got := part.written(); got != tt.wantWritten {
+				t.Errorf("written() = %d, want %d", got, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestPartFileFinish(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "video.mp4")
+
+	part := writePart(t, outputFile, 18, 10, "01234")
+	if err := part.finish(outputFile, 10); err == nil {
+		t.Error("finish() should fail when the file is incomplete")
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("incomplete download should not be renamed to the final name")
+	}
+
+	part, err := openPart(outputFile, "abc", 18, 10)
+	if err != nil {
+		t.Fatalf("openPart() error = %v", err)
+	}
+	pending := part.plan(1)
+	if offset, _ := part.next(pending[0]); offset != 5 {
+		t.Fatalf("next() offset = %d, want 5", offset)
+	}
+	part.rangeWriter(pending[0]).Write([]byte("56789"))
+	part.Close()
+
+	if err := part.finish(outputFile, 10); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(outputFile)
+	if string(got) != "0123456789" {
+		t.Errorf("output = %q, want %q", got, "0123456789")
+	}
+	if _, err := os.Stat(outputFile + partSuffix + stateSuffix); !os.IsNotExist(err) {
+		t.Error("sidecar state should be removed after a successful download")
+	}
+}
+
+func TestCleanupFailed(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepPartial   bool
+		contentLength int64
+		wantKept      bool
+	}{
+		{name: "Resume enabled", keepPartial: true, contentLength: 10, wantKept: true},
+		{name: "Resume disabled", keepPartial: false, contentLength: 10, wantKept: false},
+		{name: "Unknown size", keepPartial: true, contentLength: 0, wantKept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "video.mp4")
+			part := writePart(t, outputFile, 18, tt.contentLength, "01234")
+
+			d := &Downloader{KeepPartial: tt.keepPartial}
+			d.cleanupFailed(part)
+
+			_, err := os.Stat(outputFile + partSuffix)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf(".part kept = %v, want %v", kept, tt.wantKept)
+			}
+			if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+				t.Error("failed download should never get the final name")
+			}
+		})
+	}
+}
+
+func TestPlanRanges(t *testing.T) {
+	const size = 10 * minRangeSize
+
+	part, err := openPart(filepath.Join(t.TempDir(), "video.mp4"), "abc", 18, size)
+	if err != nil {
+		t.Fatalf("openPart() error = %v", err)
+	}
+	defer part.Close()
+
+	pending := part.plan(4)
+	if len(pending) != 4 {
+		t.Fatalf("plan(4) returned %d ranges, want 4", len(pending))
+	}
+
+	// The ranges must cover the file exactly, in order
+	var next int64
+	for _, i := range pending {
+		r := part.state.Ranges[i]
+		if r.Start != next {
+			t.Errorf("range starts at %d, want %d", r.Start, next)
+		}
+		next = r.End + 1
+	}
+	if next != size {
+		t.Errorf("ranges end at %d, want %d", next, size)
+	}
+}
+
+func TestFetchRangesChunked(t *testing.T) {
+	data := make([]byte, 4*minRangeSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	server := newRangeServer(t, data)
+
+	outputFile := filepath.Join(t.TempDir(), "video.mp4")
+	part, err := openPart(outputFile, "abc", 18, int64(len(data)))
+	if err != nil {
+		t.Fatalf("openPart() error = %v", err)
+	}
+
+	d := NewDownloader(NewClient())
+	d.Connections = 4
+
+	var last DownloadProgress
+	tracker := newProgressTracker(0, int64(len(data)), func(p DownloadProgress) {
+		last = p
+	})
+
+	if err := d.fetchRanges(context.Background(), newStreamSource(server.URL, nil), part, part.plan(d.Connections), tracker); err != nil {
+		t.Fatalf("fetchRanges() error = %v", err)
+	}
+	part.Close()
+	tracker.complete()
+
+	if err := part.finish(outputFile, int64(len(data))); err != nil {
+		t.Fatalf("finish() error = %v", err)
+	}
+	got, _ := os.ReadFile(outputFile)
+	if !bytes.Equal(got, data) {
+		t.Error("chunked download does not match the source data")
+	}
+	if last.BytesDownloaded != int64(len(data)) || last.Percentage != 100 {
+		t.Errorf("final progress = %+v, want all %d bytes", last, len(data))
+	}
+}
+
+func TestResolveFormatRefetchesStaleVideo(t *testing.T) {
+	stale := &youtube.Video{ID: "dQw4w9WgXcQ", Formats: youtube.FormatList{
+		{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, ContentLength: 100},
+	}}
+	fresh := &youtube.Video{ID: "dQw4w9WgXcQ", Formats: youtube.FormatList{
+		{ItagNo: 18, MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, ContentLength: 100},
+		{ItagNo: 137, MimeType: `video/mp4; codecs="avc1.640028"`, ContentLength: 400},
+		{ItagNo: 140, MimeType: `audio/mp4; codecs="mp4a.40.2"`, ContentLength: 50},
+	}}
+
+	tests := []struct {
+		name        string
+		format      Format
+		wantItag    int
+		wantErr     error
+		wantFetches int
+	}{
+		{"Itag in the stored video", Format{ItagNo: 18}, 18, nil, 0},
+		{"Itag only in a fresh fetch", Format{ItagNo: 137, Audio: &Format{ItagNo: 140}}, 137, nil, 1},
+		{"Audio only in a fresh fetch", Format{ItagNo: 18, Audio: &Format{ItagNo: 140}}, 18, nil, 1},
+		{"Itag gone for good", Format{ItagNo: 22}, 0, ErrFormatUnavailable, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient()
+			client.Cache = NewInfoCache(t.TempDir(), time.Hour, 1<<20)
+			client.videos.put(stale)
+			fetches := 0
+			client.fetchVideo = func(string) (*youtube.Video, error) {
+				fetches++
+				return fresh, nil
+			}
+
+			_, stream, err := NewDownloader(client).resolveFormat(stale.ID, tt.format)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveFormat() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && stream.ItagNo != tt.wantItag {
+				t.Errorf("resolveFormat() itag = %d, want %d", stream.ItagNo, tt.wantItag)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("video fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+			if info, ok := client.Cache.Get(stale.ID); tt.wantFetches > 0 && (!ok || len(info.Formats) != 3) {
+				t.Error("the cached formats weren't refreshed from the new fetch")
+			}
+		})
+	}
+}
+
+func TestStreamComplete(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "video.f137.mp4")
+
+	if streamComplete(path, 4) {
+		t.Error("missing stream reported complete")
+	}
+
+	os.WriteFile(path, []byte("data"), 0644)
+	if !streamComplete(path, 4) {
+		t.Error("finished stream not reported complete")
+	}
+	if streamComplete(path, 8) {
+		t.Error("stream of the wrong size reported complete")
+	}
+
+	// A .part file means a newer attempt is still in progress
+	os.WriteFile(path+partSuffix, nil, 0644)
+	if streamComplete(path, 4) {
+		t.Error("stream with a .part file reported complete")
+	}
+}
@@ -0,0 +1,75 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/phetzy/yt-downloader/internal/media"
+)
+
+// WithAudioExtraction returns f set up to have its audio converted to
+// target after it's downloaded. A video-only format is replaced by its
+// paired audio stream, since the video would be thrown away anyway.
+func (f Format) WithAudioExtraction(target media.AudioFormat) Format {
+	if f.Audio != nil {
+		f = *f.Audio
+	}
+	f.ExtractAudio = target
+	f.Extension = target.Extension()
+	return f
+}
+
+// AudioExtractions returns the best audio-only stream of formats set up for
+// extraction to each of media.AudioFormats, or nil if there is none
+func AudioExtractions(formats []Format) []Format {
+	best, err := SelectFormat(formats, RuleAudio)
+	if err != nil {
+		return nil
+	}
+	extractions := make([]Format, len(media.AudioFormats))
+	for i, target := range media.AudioFormats {
+		extractions[i] = best.WithAudioExtraction(target)
+	}
+	return extractions
+}
+
+// audioCodec returns the codec of the audio in f, e.g. "mp4a.40.2"
+func audioCodec(f Format) string {
+	return formatText(f, "acodec")
+}
+
+// needsConversion reports whether the stream of a format with ExtractAudio
+// set has to go through ffmpeg. An audio-only stream already in the target
+// codec and container is saved as it is.
+func needsConversion(f Format) bool {
+	return !f.IsAudioOnly ||
+		!f.ExtractAudio.Passthrough(audioCodec(f)) ||
+		getExtensionFromMimeType(f.MimeType) != f.ExtractAudio.Extension()
+}
+
+// sourceFile returns the file the stream of an audio extraction is fetched
+// to: next to the output, named after its itag and original container
+func sourceFile(outputFile string, format Format) string {
+	base := strings.TrimSuffix(outputFile, "."+format.Extension)
+	return fmt.Sprintf("%s.f%d.%s", base, format.ItagNo, getExtensionFromMimeType(format.MimeType))
+}
+
+// downloadSource downloads the stream of format for the convert step and
+// returns its file
+func (d *Downloader) downloadSource(ctx context.Context, video *youtube.Video, stream *youtube.Format, format Format, outputFile string, tracker *progressTracker) ([]string, error) {
+	// Look for ffmpeg first, so a missing one doesn't waste a download
+	if media.FindFFmpeg(d.FFmpeg) == "" {
+		return nil, fmt.Errorf("%w to convert audio to %s", media.ErrFFmpegRequired, format.ExtractAudio.Label())
+	}
+
+	source := sourceFile(outputFile, format)
+	if streamComplete(source, stream.ContentLength) {
+		// Already fetched by an attempt that failed to convert
+		tracker.resume(stream.ContentLength)
+	} else if err := d.fetchStream(ctx, video, stream, source, tracker); err != nil {
+		return nil, err
+	}
+	return []string{source}, nil
+}
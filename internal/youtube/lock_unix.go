@@ -0,0 +1,24 @@
+//go:build unix
+
+package youtube
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an exclusive advisory lock on file without waiting,
+// returning errPartLocked if another open file holds it. The lock goes when
+// file is closed.
+func tryLockFile(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch err {
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return errPartLocked
+		}
+		return err
+	}
+}
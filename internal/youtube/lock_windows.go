@@ -0,0 +1,21 @@
+//go:build windows
+
+package youtube
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// tryLockFile takes an exclusive lock on file without waiting, returning
+// errPartLocked if another open file holds it. The lock goes when file is
+// closed.
+func tryLockFile(file *os.File) error {
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errPartLocked
+	}
+	return err
+}
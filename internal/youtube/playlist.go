@@ -0,0 +1,87 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// playlistIDPattern matches the characters allowed in a playlist ID
+var playlistIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{13,42}$`)
+
+// PlaylistInfo contains information about a YouTube playlist
+type PlaylistInfo struct {
+	ID      string
+	Title   string
+	Author  string
+	Entries []PlaylistEntry
+}
+
+// PlaylistEntry is a single video in a playlist
+type PlaylistEntry struct {
+	Index    int // 1-based position in the playlist
+	ID       string
+	Title    string
+	Author   string
+	Duration string
+}
+
+// URL returns the watch URL of the entry
+func (e PlaylistEntry) URL() string {
+	return "https://www.youtube.com/watch?v=" + e.ID
+}
+
+// ExtractPlaylistID extracts the playlist ID from the list= parameter of a
+// playlist or watch URL
+func ExtractPlaylistID(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", errors.New("invalid YouTube URL")
+	}
+
+	host := strings.ToLower(u.Host)
+	if !strings.Contains(host, "youtube.com") && !strings.Contains(host, "youtu.be") {
+		return "", errors.New("invalid YouTube URL")
+	}
+
+	list := u.Query().Get("list")
+	if list == "" {
+		return "", errors.New("URL has no playlist")
+	}
+	if !playlistIDPattern.MatchString(list) {
+		return "", fmt.Errorf("invalid playlist ID %q", list)
+	}
+	return list, nil
+}
+
+// GetPlaylistInfo fetches the title and entries of a playlist
+func (c *Client) GetPlaylistInfo(url string) (*PlaylistInfo, error) {
+	playlistID, err := ExtractPlaylistID(url)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist, err := c.client.GetPlaylist(playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w. Mixes and private playlists can't be downloaded", err)
+	}
+
+	info := &PlaylistInfo{
+		ID:     playlist.ID,
+		Title:  playlist.Title,
+		Author: playlist.Author,
+	}
+	for i, entry := range playlist.Videos {
+		info.Entries = append(info.Entries, PlaylistEntry{
+			Index:    i + 1,
+			ID:       entry.ID,
+			Title:    entry.Title,
+			Author:   entry.Author,
+			Duration: formatDuration(int(entry.Duration.Seconds())),
+		})
+	}
+
+	return info, nil
+}
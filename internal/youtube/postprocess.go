@@ -0,0 +1,157 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Post-processing steps, by the names used to configure them
+const (
+	StepMerge     = "merge"     // mux the video and audio streams of a merged download
+	StepConvert   = "convert"   // convert extracted audio
+	StepTag       = "tag"       // write title, artist and date tags
+	StepThumbnail = "thumbnail" // embed the video's thumbnail as cover art
+	StepMove      = "move"      // move the file to another directory
+	StepHook      = "hook"      // run a command on the file
+)
+
+// PostProcessor is a step run on every finished download
+type PostProcessor interface {
+	// Name identifies the step in progress reports and errors
+	Name() string
+
+	// Applies reports whether the step has anything to do for f. It's
+	// asked for every step before the first one runs.
+	Applies(f *PostFile) bool
+
+	// Process works on the file, updating f to match what it did
+	Process(ctx context.Context, f *PostFile) error
+}
+
+// DefaultPostProcessors are the steps a Downloader without PostProcessors
+// runs: the ones merged downloads and audio extraction need
+func DefaultPostProcessors() []PostProcessor {
+	return []PostProcessor{MergeStep{}, ConvertStep{}}
+}
+
+// PostFile is a finished download on its way through the post-processors
+type PostFile struct {
+	// Path is the file. Steps that write a new file or move it update it.
+	Path string
+
+	// Dir is the directory the video was downloaded to
+	Dir string
+
+	Video  *VideoInfo
+	Format Format
+
+	// Sources are the downloaded streams Path is made from, until a step
+	// writes it: the video and audio of a merged download, or the stream
+	// audio is extracted from
+	Sources []string
+
+	// Originals are the streams a step replaced with Path. They're deleted
+	// once every step has run, unless Downloader.KeepOriginal is set.
+	Originals []string
+
+	// FFmpeg is the ffmpeg binary steps use, "" if there is none
+	FFmpeg string
+}
+
+// rewrite has write produce a new version of the file next to it, then
+// moves it into place. Sources the new file was made from become originals.
+func (f *PostFile) rewrite(write func(tmp string) error) error {
+	tmp := tempFile(f.Path)
+	err := write(tmp)
+	if err == nil {
+		err = commitFile(tmp, f.Path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	f.Originals = append(f.Originals, f.Sources...)
+	f.Sources = nil
+	return nil
+}
+
+// StepError is a post-processing step that failed
+type StepError struct {
+	Step string
+	Err  error
+}
+
+// Error implements error
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+// Unwrap returns the step's error
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// PostProcessError is returned with the saved file when steps failed after
+// it was written. The download itself succeeded.
+type PostProcessError struct {
+	Steps []*StepError
+}
+
+// Error implements error
+func (e *PostProcessError) Error() string {
+	msgs := make([]string, len(e.Steps))
+	for i, step := range e.Steps {
+		msgs[i] = step.Error()
+	}
+	return "post-processing failed: " + strings.Join(msgs, "; ")
+}
+
+// postProcessors returns the steps d runs on finished downloads
+func (d *Downloader) postProcessors() []PostProcessor {
+	if d.PostProcessors == nil {
+		return DefaultPostProcessors()
+	}
+	return d.PostProcessors
+}
+
+// postProcess runs the steps that apply to f in order, reporting each on
+// tracker. A failing step stops the chain only while there's no finished
+// file yet; later failures are returned together as a *PostProcessError
+// once the remaining steps have run.
+func (d *Downloader) postProcess(ctx context.Context, f *PostFile, tracker *progressTracker) error {
+	var steps []PostProcessor
+	for _, step := range d.postProcessors() {
+		if step.Applies(f) {
+			steps = append(steps, step)
+		}
+	}
+
+	var failed []*StepError
+	for i, step := range steps {
+		tracker.step(step.Name(), i+1, len(steps))
+		if err := step.Process(ctx, f); err != nil {
+			stepErr := &StepError{Step: step.Name(), Err: err}
+			if len(f.Sources) > 0 {
+				d.cleanupStreams(f.Sources...)
+				return stepErr
+			}
+			failed = append(failed, stepErr)
+		}
+	}
+	if len(f.Sources) > 0 {
+		d.cleanupStreams(f.Sources...)
+		return fmt.Errorf("no post-processing step wrote %s from the downloaded streams", f.Path)
+	}
+
+	if !d.KeepOriginal {
+		for _, original := range f.Originals {
+			os.Remove(original)
+		}
+	}
+	if failed != nil {
+		return &PostProcessError{Steps: failed}
+	}
+	return nil
+}
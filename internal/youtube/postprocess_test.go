@@ -0,0 +1,213 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeStep is a post-processor recording the order steps run in
+type fakeStep struct {
+	name    string
+	skip    bool
+	produce bool // writes the file from its sources
+	err     error
+	ran     *[]string
+}
+
+func (s fakeStep) Name() string             { return s.name }
+func (s fakeStep) Applies(f *PostFile) bool { return !s.skip }
+
+func (s fakeStep) Process(ctx context.Context, f *PostFile) error {
+	*s.ran = append(*s.ran, s.name)
+	if s.err != nil {
+		return s.err
+	}
+	if s.produce {
+		return f.rewrite(func(tmp string) error {
+			return os.WriteFile(tmp, []byte("merged"), 0644)
+		})
+	}
+	return nil
+}
+
+func TestPostProcess(t *testing.T) {
+	failure := errors.New("boom")
+	tests := []struct {
+		name         string
+		steps        []fakeStep
+		keepOriginal bool
+		wantRan      []string
+		wantProgress []string
+		wantFatal    bool
+		wantFailed   []string
+		wantSources  bool // streams left on disk
+	}{
+		{
+			name:         "Steps run in order",
+			steps:        []fakeStep{{name: "merge", produce: true}, {name: "thumbnail", skip: true}, {name: "tag"}},
+			wantRan:      []string{"merge", "tag"},
+			wantProgress: []string{"merge 1/2", "tag 2/2"},
+		},
+		{
+			name:         "Originals kept",
+			steps:        []fakeStep{{name: "merge", produce: true}},
+			keepOriginal: true,
+			wantRan:      []string{"merge"},
+			wantProgress: []string{"merge 1/1"},
+			wantSources:  true,
+		},
+		{
+			name:         "Merge fails",
+			steps:        []fakeStep{{name: "merge", err: failure}, {name: "tag"}},
+			wantRan:      []string{"merge"},
+			wantProgress: []string{"merge 1/2"},
+			wantFatal:    true,
+		},
+		{
+			name:         "Later steps fail",
+			steps:        []fakeStep{{name: "merge", produce: true}, {name: "tag", err: failure}, {name: "hook", err: failure}},
+			wantRan:      []string{"merge", "tag", "hook"},
+			wantProgress: []string{"merge 1/3", "tag 2/3", "hook 3/3"},
+			wantFailed:   []string{"tag", "hook"},
+		},
+		{
+			name:         "Nothing merges",
+			steps:        []fakeStep{{name: "tag"}},
+			wantRan:      []string{"tag"},
+			wantProgress: []string{"tag 1/1"},
+			wantFatal:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sources := []string{filepath.Join(dir, "video.f137.mp4"), filepath.Join(dir, "video.f140.m4a")}
+			for _, source := range sources {
+				if err := os.WriteFile(source, []byte("stream"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var ran []string
+			d := &Downloader{KeepOriginal: tt.keepOriginal}
+			for _, step := range tt.steps {
+				step.ran = &ran
+				d.PostProcessors = append(d.PostProcessors, step)
+			}
+			var progress []string
+			tracker := newProgressTracker(0, 10, func(p DownloadProgress) {
+				progress = append(progress, fmt.Sprintf("%s %d/%d", p.Step, p.StepNumber, p.Steps))
+			})
+
+			file := &PostFile{Path: filepath.Join(dir, "video.mp4"), Dir: dir, Sources: sources}
+			err := d.postProcess(context.Background(), file, tracker)
+
+			if !slices.Equal(ran, tt.wantRan) {
+				t.Errorf("ran %v, want %v", ran, tt.wantRan)
+			}
+			if !slices.Equal(progress, tt.wantProgress) {
+				t.Errorf("progress %v, want %v", progress, tt.wantProgress)
+			}
+
+			var postErr *PostProcessError
+			switch {
+			case tt.wantFatal:
+				if err == nil || errors.As(err, &postErr) {
+					t.Fatalf("postProcess() error = %v, want the download to fail", err)
+				}
+				if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+					t.Error("a failed chain left a file under the final name")
+				}
+				return
+			case tt.wantFailed != nil:
+				if !errors.As(err, &postErr) {
+					t.Fatalf("postProcess() error = %v, want a *PostProcessError", err)
+				}
+				var failed []string
+				for _, step := range postErr.Steps {
+					failed = append(failed, step.Step)
+					if !errors.Is(step, failure) {
+						t.Errorf("step error %v doesn't wrap the failure", step)
+					}
+				}
+				if !slices.Equal(failed, tt.wantFailed) {
+					t.Errorf("failed steps %v, want %v", failed, tt.wantFailed)
+				}
+			case err != nil:
+				t.Fatalf("postProcess() error = %v", err)
+			}
+
+			if _, err := os.Stat(file.Path); err != nil {
+				t.Errorf("merged file missing: %v", err)
+			}
+			for _, source := range sources {
+				if _, err := os.Stat(source); (err == nil) != tt.wantSources {
+					t.Errorf("%s kept = %v, want %v", filepath.Base(source), err == nil, tt.wantSources)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveStep(t *testing.T) {
+	dir, dest := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "Channel", "video.mp4")
+	taken := filepath.Join(dest, "Channel", "video.mp4")
+	for _, p := range []string{path, taken} {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := &PostFile{Path: path, Dir: dir}
+	if err := (MoveStep{Dir: dest}).Process(context.Background(), file); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	// The template's subdirectory is kept and the existing file isn't replaced
+	want := filepath.Join(dest, "Channel", "video (1).mp4")
+	if file.Path != want {
+		t.Errorf("moved to %s, want %s", file.Path, want)
+	}
+	if data, err := os.ReadFile(want); err != nil || string(data) != path {
+		t.Errorf("moved file = %q, %v", data, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the file is still in the download directory")
+	}
+}
+
+func TestHookStep(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands use sh")
+	}
+	dir := t.TempDir()
+	file := &PostFile{
+		Path:  filepath.Join(dir, "video.mp4"),
+		Video: &VideoInfo{ID: "dQw4w9WgXcQ", Title: "Some Title"},
+	}
+
+	hook := HookStep{Command: `printf '%s|%s' "$YTDL_TITLE" "$(basename "$YTDL_FILE")" > hook.txt`}
+	if err := hook.Process(context.Background(), file); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "hook.txt")); err != nil || string(data) != "Some Title|video.mp4" {
+		t.Errorf("hook wrote %q, %v", data, err)
+	}
+
+	err := HookStep{Command: "echo no space left; exit 3"}.Process(context.Background(), file)
+	if err == nil || !strings.Contains(err.Error(), "no space left") {
+		t.Errorf("Process() error = %v, want the command's output", err)
+	}
+}
@@ -0,0 +1,263 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/phetzy/yt-downloader/internal/media"
+)
+
+// MergeStep muxes the video and audio streams of a merged download into
+// one file
+type MergeStep struct{}
+
+// Name implements PostProcessor
+func (MergeStep) Name() string { return StepMerge }
+
+// Applies implements PostProcessor
+func (MergeStep) Applies(f *PostFile) bool {
+	return f.Format.Audio != nil && len(f.Sources) == 2
+}
+
+// Process implements PostProcessor
+func (MergeStep) Process(ctx context.Context, f *PostFile) error {
+	return f.rewrite(func(tmp string) error {
+		return media.Merge(ctx, f.FFmpeg, f.Sources[0], f.Sources[1], tmp)
+	})
+}
+
+// ConvertStep converts the downloaded stream of an audio extraction
+type ConvertStep struct{}
+
+// Name implements PostProcessor
+func (ConvertStep) Name() string { return StepConvert }
+
+// Applies implements PostProcessor
+func (ConvertStep) Applies(f *PostFile) bool {
+	return f.Format.ExtractAudio != "" && len(f.Sources) == 1
+}
+
+// Process implements PostProcessor
+func (ConvertStep) Process(ctx context.Context, f *PostFile) error {
+	return f.rewrite(func(tmp string) error {
+		return media.ExtractAudio(ctx, f.FFmpeg, f.Sources[0], tmp, f.Format.ExtractAudio, audioCodec(f.Format))
+	})
+}
+
+// TagStep writes the title, channel, upload date and URL of the video into
+// the file's metadata
+type TagStep struct{}
+
+// Name implements PostProcessor
+func (TagStep) Name() string { return StepTag }
+
+// Applies implements PostProcessor
+func (TagStep) Applies(f *PostFile) bool { return f.Video != nil }
+
+// Process implements PostProcessor
+func (TagStep) Process(ctx context.Context, f *PostFile) error {
+	tags := map[string]string{
+		"title":   f.Video.Title,
+		"artist":  f.Video.Author,
+		"date":    f.Video.UploadDate,
+		"comment": "https://www.youtube.com/watch?v=" + f.Video.ID,
+	}
+	return f.rewrite(func(tmp string) error {
+		return media.Tag(ctx, f.FFmpeg, f.Path, tmp, tags)
+	})
+}
+
+// ThumbnailStep embeds the video's thumbnail as cover art. MP4, M4A, MP3
+// and FLAC files are supported.
+type ThumbnailStep struct {
+	// Client fetches the thumbnail; nil uses http.DefaultClient
+	Client *http.Client
+}
+
+// Name implements PostProcessor
+func (ThumbnailStep) Name() string { return StepThumbnail }
+
+// Applies implements PostProcessor
+func (ThumbnailStep) Applies(f *PostFile) bool { return f.Video != nil }
+
+// Process implements PostProcessor
+func (s ThumbnailStep) Process(ctx context.Context, f *PostFile) error {
+	base := strings.TrimSuffix(f.Path, filepath.Ext(f.Path))
+	image := tempFile(base + ".jpg")
+	defer os.Remove(image)
+	if err := s.fetch(ctx, f.Video.ID, image); err != nil {
+		return err
+	}
+
+	// Extracted audio has no video stream for the image to come after
+	videoStreams := 0
+	if f.Format.HasVideo && f.Format.ExtractAudio == "" {
+		videoStreams = 1
+	}
+	return f.rewrite(func(tmp string) error {
+		return media.EmbedThumbnail(ctx, f.FFmpeg, f.Path, image, tmp, videoStreams)
+	})
+}
+
+// thumbnailURLs are the JPEG thumbnails of a video from largest to smallest;
+// only some videos have the larger ones
+var thumbnailURLs = []string{
+	"https://i.ytimg.com/vi/%s/maxresdefault.jpg",
+	"https://i.ytimg.com/vi/%s/hqdefault.jpg",
+}
+
+// fetch saves the largest thumbnail of video id to path
+func (s ThumbnailStep) fetch(ctx context.Context, id, path string) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var lastErr error
+	for _, pattern := range thumbnailURLs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(pattern, id), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to fetch thumbnail: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = &StatusError{Code: resp.StatusCode, URL: req.URL.String()}
+			continue
+		}
+
+		out, err := os.Create(path)
+		if err == nil {
+			_, err = io.Copy(out, resp.Body)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to save thumbnail: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to fetch thumbnail: %w", lastErr)
+}
+
+// MoveStep moves the file into another directory, keeping the
+// subdirectories the output template put it in
+type MoveStep struct {
+	Dir string
+}
+
+// Name implements PostProcessor
+func (MoveStep) Name() string { return StepMove }
+
+// Applies implements PostProcessor
+func (s MoveStep) Applies(*PostFile) bool { return s.Dir != "" }
+
+// Process implements PostProcessor
+func (s MoveStep) Process(_ context.Context, f *PostFile) error {
+	rel, err := filepath.Rel(f.Dir, f.Path)
+	if err != nil || !filepath.IsLocal(rel) {
+		rel = filepath.Base(f.Path)
+	}
+	dest := filepath.Join(s.Dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if dest, err = resolveCollision(dest, 0, CollisionRename, nil); err != nil {
+		return err
+	}
+
+	if err := moveFile(f.Path, dest); err != nil {
+		return err
+	}
+	f.Path = dest
+	return nil
+}
+
+// moveFile moves src to dest, copying it when they're on different disks
+func moveFile(src, dest string) error {
+	err := os.Rename(src, dest)
+	var linkErr *os.LinkError
+	if err == nil || !errors.As(err, &linkErr) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := tempFile(dest)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = commitFile(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// HookStep runs a shell command on the file. The command gets the file and
+// the video's details in the environment: YTDL_FILE, YTDL_ID, YTDL_TITLE,
+// YTDL_AUTHOR and YTDL_URL.
+type HookStep struct {
+	Command string
+}
+
+// Name implements PostProcessor
+func (HookStep) Name() string { return StepHook }
+
+// Applies implements PostProcessor
+func (s HookStep) Applies(*PostFile) bool { return s.Command != "" }
+
+// Process implements PostProcessor
+func (s HookStep) Process(ctx context.Context, f *PostFile) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.Command)
+	}
+	cmd.Dir = filepath.Dir(f.Path)
+	cmd.Env = append(os.Environ(), "YTDL_FILE="+f.Path)
+	if f.Video != nil {
+		cmd.Env = append(cmd.Env,
+			"YTDL_ID="+f.Video.ID,
+			"YTDL_TITLE="+f.Video.Title,
+			"YTDL_AUTHOR="+f.Video.Author,
+			"YTDL_URL=https://www.youtube.com/watch?v="+f.Video.ID,
+		)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRate is returned for malformed rate limits and schedules
+var ErrInvalidRate = errors.New("invalid rate limit")
+
+// minBurst is the smallest bucket size. It must hold at least one read
+// buffer, or a single read could never be let through.
+const minBurst = 64 * 1024
+
+// RateRule limits the download speed during part of the day
+type RateRule struct {
+	From  time.Duration // time of day the rule starts, since midnight
+	To    time.Duration // time of day it ends; before From if it spans midnight
+	Limit int64         // bytes per second, 0 for unlimited
+}
+
+// ParseRateRule parses a rule from times of day like "09:00" and "18:00"
+// and a limit like "2MB"
+func ParseRateRule(from, to, limit string) (RateRule, error) {
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return RateRule{}, err
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return RateRule{}, err
+	}
+	rate, err := ParseRate(limit)
+	if err != nil {
+		return RateRule{}, err
+	}
+	return RateRule{From: start, To: end, Limit: rate}, nil
+}
+
+// active reports whether the rule applies at time of day t
+func (r RateRule) active(t time.Duration) bool {
+	if r.From <= r.To {
+		return t >= r.From && t < r.To
+	}
+	return t >= r.From || t < r.To
+}
+
+// String formats the rule's hours, e.g. "09:00–18:00"
+func (r RateRule) String() string {
+	return formatTimeOfDay(r.From) + "–" + formatTimeOfDay(r.To)
+}
+
+// ParseRate parses a speed like "2MB", "500K" or "1.5 MB/s" into bytes per
+// second, using binary multiples. "" and "0" mean unlimited.
+func ParseRate(s string) (int64, error) {
+	v := strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	v = strings.TrimSuffix(v, "/s")
+	if v == "" {
+		return 0, nil
+	}
+	n, ok := parseQuantity(v, true)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q, use a speed like \"2MB\" or \"500K\"", ErrInvalidRate, s)
+	}
+	return int64(n), nil
+}
+
+// parseTimeOfDay parses "HH:MM" into the time since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q, use HH:MM", ErrInvalidRate, s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// formatTimeOfDay formats the time since midnight as "HH:MM"
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// RateLimiter is a token bucket capping the combined speed of every download
+// that shares it. The limit follows a time-of-day schedule, and can be
+// overridden while the app is running.
+type RateLimiter struct {
+	mu       sync.Mutex
+	base     int64 // limit outside the schedule
+	schedule []RateRule
+	override *int64 // set at runtime; replaces base and schedule
+	now      func() time.Time
+
+	current int64 // limit the bucket was last filled at
+	tokens  float64
+	last    time.Time
+}
+
+// NewRateLimiter creates a limiter allowing limit bytes per second, or
+// the limit of the first active rule in schedule. A limit of 0 is unlimited.
+func NewRateLimiter(limit int64, schedule []RateRule) *RateLimiter {
+	return &RateLimiter{
+		base:     limit,
+		schedule: schedule,
+		now:      time.Now,
+	}
+}
+
+// Limit returns the limit in effect now, in bytes per second, and the rule
+// it comes from, if any
+func (l *RateLimiter) Limit() (int64, *RateRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limitLocked(l.now())
+}
+
+// limitLocked is Limit for callers holding l.mu
+func (l *RateLimiter) limitLocked(now time.Time) (int64, *RateRule) {
+	if l.override != nil {
+		return *l.override, nil
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	t := now.Sub(midnight)
+	for i := range l.schedule {
+		if l.schedule[i].active(t) {
+			return l.schedule[i].Limit, &l.schedule[i]
+		}
+	}
+	return l.base, nil
+}
+
+// SetLimit overrides the configured limit and schedule with limit bytes per
+// second until ClearLimit is called. 0 is unlimited.
+func (l *RateLimiter) SetLimit(limit int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.override = &limit
+}
+
+// ClearLimit goes back to the configured limit and schedule
+func (l *RateLimiter) ClearLimit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.override = nil
+}
+
+// Overridden reports whether the limit was changed at runtime
+func (l *RateLimiter) Overridden() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.override != nil
+}
+
+// WaitN blocks until n more bytes may be downloaded under the current limit
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes n tokens from the bucket, going into debt if there aren't
+// enough, and returns how long the caller has to wait for the debt to clear
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	limit, _ := l.limitLocked(now)
+	if limit <= 0 {
+		l.current = 0
+		return 0
+	}
+
+	// Start with an empty bucket whenever the limit changes, so neither
+	// a burst saved up at the old limit nor its debt carries over
+	if limit != l.current {
+		l.current = limit
+		l.tokens = 0
+		l.last = now
+	}
+
+	burst := float64(limit)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	l.tokens += now.Sub(l.last).Seconds() * float64(limit)
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(limit) * float64(time.Second))
+}
@@ -0,0 +1,97 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"2MB", 2 << 20, false},
+		{"500K", 500 << 10, false},
+		{"1.5 MB/s", 3 << 19, false},
+		{"100", 100, false},
+		{"fast", 0, true},
+		{"-1M", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterSchedule(t *testing.T) {
+	office, _ := ParseRateRule("09:00", "18:00", "2MB")
+	night, _ := ParseRateRule("22:00", "06:00", "0")
+	l := NewRateLimiter(5<<20, []RateRule{office, night})
+
+	tests := []struct {
+		clock string
+		want  int64
+	}{
+		{"08:59", 5 << 20},
+		{"09:00", 2 << 20},
+		{"17:59", 2 << 20},
+		{"18:00", 5 << 20},
+		{"23:30", 0},
+		{"05:00", 0},
+	}
+	for _, tt := range tests {
+		clock, _ := time.Parse("15:04", tt.clock)
+		l.now = func() time.Time { return clock }
+		if got, _ := l.Limit(); got != tt.want {
+			t.Errorf("Limit() at %s = %d, want %d", tt.clock, got, tt.want)
+		}
+	}
+
+	// A limit set at runtime wins over the schedule until cleared
+	l.SetLimit(1 << 20)
+	if got, rule := l.Limit(); got != 1<<20 || rule != nil {
+		t.Errorf("Limit() after SetLimit = %d, %v, want %d", got, rule, 1<<20)
+	}
+	l.ClearLimit()
+	if got, _ := l.Limit(); got != 0 {
+		t.Errorf("Limit() after ClearLimit = %d, want the scheduled 0", got)
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(1<<20, nil)
+	l.now = func() time.Time { return clock }
+
+	if d := l.reserve(512 << 10); d != 500*time.Millisecond {
+		t.Errorf("first reserve() = %v, want 500ms", d)
+	}
+	clock = clock.Add(500 * time.Millisecond)
+	if d := l.reserve(512 << 10); d != 500*time.Millisecond {
+		t.Errorf("second reserve() = %v, want 500ms", d)
+	}
+
+	// Tokens saved up while idle are capped at one second's worth
+	clock = clock.Add(time.Minute)
+	if d := l.reserve(1 << 20); d != 0 {
+		t.Errorf("reserve() after idling = %v, want 0", d)
+	}
+	if d := l.reserve(1 << 20); d != time.Second {
+		t.Errorf("reserve() past the burst = %v, want 1s", d)
+	}
+
+	l.SetLimit(0)
+	if d := l.reserve(100 << 20); d != 0 {
+		t.Errorf("unlimited reserve() = %v, want 0", d)
+	}
+}
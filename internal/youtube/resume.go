@@ -0,0 +1,389 @@
+package youtube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	// partSuffix is appended to the output path while a download is in progress
+	partSuffix = ".part"
+
+	// stateSuffix is appended to the .part path for the resume sidecar file
+	stateSuffix = ".state"
+
+	// checkpointInterval is how many bytes are written between sidecar updates
+	checkpointInterval = 1024 * 1024
+
+	// minRangeSize is the smallest piece a range is split into for another
+	// connection; smaller pieces aren't worth the extra request
+	minRangeSize = 1024 * 1024
+)
+
+// errPartLocked is returned when a .part file is held open by another
+// download, possibly in another process
+var errPartLocked = errors.New("being written by another download")
+
+// byteRange is a span of the file fetched by a single connection
+type byteRange struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"` // inclusive, -1 if the size is unknown
+	Written int64 `json:"written"`
+}
+
+// remaining returns the number of bytes still to fetch for the range
+func (r byteRange) remaining() int64 {
+	return r.End - r.Start + 1 - r.Written
+}
+
+// partState is the sidecar record that lets an interrupted download continue
+type partState struct {
+	VideoID       string      `json:"video_id"`
+	Itag          int         `json:"itag"`
+	BytesWritten  int64       `json:"bytes_written"`
+	ContentLength int64       `json:"content_length"`
+	Ranges        []byteRange `json:"ranges,omitempty"`
+}
+
+// loadPartState reads a sidecar state file
+func loadPartState(path string) (*partState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state partState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid resume state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// save writes the state next to the .part file. It writes and syncs a
+// temporary file first so a crash never leaves a truncated sidecar behind.
+func (s *partState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// matches reports whether the state belongs to the given video and format
+func (s *partState) matches(videoID string, itag int, contentLength int64) bool {
+	return s.VideoID == videoID && s.Itag == itag && s.ContentLength == contentLength
+}
+
+// extent returns the offset just past the last byte written to the file
+func (s *partState) extent() int64 {
+	if len(s.Ranges) == 0 {
+		return s.BytesWritten
+	}
+
+	var extent int64
+	for _, r := range s.Ranges {
+		if end := r.Start + r.Written; end > extent {
+			extent = end
+		}
+	}
+	return extent
+}
+
+// pendingBytes returns how much of format is still to be written to
+// outputFile, taking a finished or interrupted earlier attempt into account
+func pendingBytes(outputFile, videoID string, format *youtube.Format) int64 {
+	size := format.ContentLength
+	if streamComplete(outputFile, size) {
+		return 0
+	}
+	state, err := loadPartState(outputFile + partSuffix + stateSuffix)
+	if err == nil && state.matches(videoID, format.ItagNo, size) {
+		return size - state.BytesWritten
+	}
+	return size
+}
+
+// partLocked reports whether another download holds the lock on partPath
+func partLocked(partPath string) bool {
+	file, err := os.Open(partPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return tryLockFile(file) == errPartLocked
+}
+
+// partFile is the .part file of a download in progress together with its
+// sidecar state. Connections write their ranges into it concurrently and it
+// stays locked until it's closed, so no other process writes to it.
+type partFile struct {
+	file      *os.File
+	statePath string
+
+	mu        sync.Mutex
+	state     *partState
+	lastSaved int64
+}
+
+// openPart opens the .part file for outputFile, continuing from a previous
+// attempt when the sidecar state matches the requested video and format
+func openPart(outputFile, videoID string, itag int, contentLength int64) (*partFile, error) {
+	partPath := outputFile + partSuffix
+	statePath := partPath + stateSuffix
+
+	// Lock the file before reading its state, so a download still writing
+	// it is never truncated or resumed from under it
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", partPath, err)
+	}
+
+	var state *partState
+	if contentLength > 0 {
+		if saved, err := loadPartState(statePath); err == nil && saved.matches(videoID, itag, contentLength) {
+			if info, err := os.Stat(partPath); err == nil && info.Size() >= saved.extent() {
+				state = saved
+			}
+		}
+	}
+
+	if state == nil {
+		// Nothing to continue from; start over with an empty file
+		state = &partState{
+			VideoID:       videoID,
+			Itag:          itag,
+			ContentLength: contentLength,
+		}
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	// Allocate the whole file up front so ranges can be written anywhere
+	if contentLength > 0 {
+		if err := file.Truncate(contentLength); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	p := &partFile{
+		file:      file,
+		statePath: statePath,
+		state:     state,
+		lastSaved: state.BytesWritten,
+	}
+	if err := p.checkpoint(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// plan divides the rest of the download into ranges, splitting the largest
+// unfinished ones until there is one for each connection. It returns the
+// indexes of the ranges that still need fetching, in file order.
+func (p *partFile) plan(connections int) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.state
+	if s.ContentLength <= 0 {
+		// Without a size there is nothing to split
+		s.Ranges = []byteRange{{Start: 0, End: -1}}
+		return []int{0}
+	}
+
+	if len(s.Ranges) == 0 {
+		// Either a new download or one that was fetched as a single stream
+		s.Ranges = []byteRange{{Start: 0, End: s.ContentLength - 1, Written: s.BytesWritten}}
+	}
+
+	for p.pendingCount() < connections {
+		largest := 0
+		for i, r := range s.Ranges {
+			if r.remaining() > s.Ranges[largest].remaining() {
+				largest = i
+			}
+		}
+
+		r := s.Ranges[largest]
+		if r.remaining() < 2*minRangeSize {
+			break
+		}
+
+		// Give the second half of what's left to a new range
+		mid := r.Start + r.Written + r.remaining()/2
+		s.Ranges[largest].End = mid - 1
+		s.Ranges = append(s.Ranges, byteRange{Start: mid, End: r.End})
+	}
+
+	var pending []int
+	for i, r := range s.Ranges {
+		if r.remaining() > 0 {
+			pending = append(pending, i)
+		}
+	}
+	sort.Slice(pending, func(a, b int) bool {
+		return s.Ranges[pending[a]].Start < s.Ranges[pending[b]].Start
+	})
+	return pending
+}
+
+// pendingCount returns how many ranges still need fetching
+func (p *partFile) pendingCount() int {
+	count := 0
+	for _, r := range p.state.Ranges {
+		if r.remaining() > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// next returns the offset to continue range i from and the offset it ends
+// at (exclusive), which is 0 if the size is unknown
+func (p *partFile) next(i int) (int64, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := p.state.Ranges[i]
+	return r.Start + r.Written, r.End + 1
+}
+
+// written returns the number of bytes on disk
+func (p *partFile) written() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.BytesWritten
+}
+
+// rangeWriter returns a writer that appends to range i of the file
+func (p *partFile) rangeWriter(i int) *rangeWriter {
+	return &rangeWriter{part: p, index: i}
+}
+
+// rangeWriter writes one range of a partFile
+type rangeWriter struct {
+	part  *partFile
+	index int
+}
+
+// Write implements io.Writer
+func (w *rangeWriter) Write(b []byte) (int, error) {
+	p := w.part
+	offset, _ := p.next(w.index)
+
+	n, err := p.file.WriteAt(b, offset)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.Ranges[w.index].Written += int64(n)
+	p.state.BytesWritten += int64(n)
+
+	if p.state.BytesWritten-p.lastSaved >= checkpointInterval {
+		if cpErr := p.checkpointLocked(); cpErr != nil && err == nil {
+			err = cpErr
+		}
+	}
+	return n, err
+}
+
+// checkpoint records the bytes written so far in the sidecar file
+func (p *partFile) checkpoint() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkpointLocked()
+}
+
+// checkpointLocked is checkpoint for callers holding p.mu. The .part file
+// is flushed to disk first, so the checkpoint never claims bytes a crash
+// could still lose: every byte counted in the state has been written by the
+// time it's counted.
+func (p *partFile) checkpointLocked() error {
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush output file: %w", err)
+	}
+	if err := p.state.save(p.statePath); err != nil {
+		return fmt.Errorf("failed to save resume state: %w", err)
+	}
+	p.lastSaved = p.state.BytesWritten
+	return nil
+}
+
+// Close saves a final checkpoint, flushing the .part file to disk, and
+// closes it
+func (p *partFile) Close() error {
+	cpErr := p.checkpoint()
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	return cpErr
+}
+
+// finish renames the closed .part file to outputFile once it holds exactly
+// expectedSize bytes and removes the sidecar state. The rename is atomic, so
+// outputFile is either missing or complete.
+func (p *partFile) finish(outputFile string, expectedSize int64) error {
+	written := p.written()
+	if expectedSize > 0 && written != expectedSize {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", written, expectedSize)
+	}
+	info, err := os.Stat(p.file.Name())
+	if err != nil {
+		return fmt.Errorf("failed to check output file: %w", err)
+	}
+	if expectedSize > 0 && info.Size() != expectedSize {
+		return fmt.Errorf("incomplete download: file has %d of %d bytes", info.Size(), expectedSize)
+	}
+
+	if err := os.Rename(p.file.Name(), outputFile); err != nil {
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+	os.Remove(p.statePath)
+	return nil
+}
+
+// resumable reports whether a later attempt can continue the download; that
+// needs the total size to be known
+func (p *partFile) resumable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.ContentLength > 0
+}
+
+// discard removes the .part file and its sidecar state
+func (p *partFile) discard() {
+	os.Remove(p.file.Name())
+	os.Remove(p.statePath)
+}
@@ -0,0 +1,130 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides how often and how long to wait before a dropped
+// stream is reopened
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a range is requested before
+	// giving up, including the first. 0 or 1 disables retries. The count
+	// starts over whenever a reopened stream delivers data again.
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry; it doubles with each
+	// further attempt
+	BaseDelay time.Duration
+
+	// MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy retries a dropped stream up to four times, waiting
+// about 1s, 2s, 4s and 8s in between
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// delay returns how long to wait after attempt failed. Jitter spreads the
+// wait over its upper half so parallel connections don't reconnect in step.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// wait sleeps before the next attempt, returning early if ctx is cancelled
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(p.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// StatusError is returned when a stream request gets an unexpected HTTP
+// status
+type StatusError struct {
+	Code int
+	URL  string // without the signed query string
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.Code, e.URL)
+}
+
+// isRetryable reports whether err is a transient network failure that
+// reopening the stream may get past. Errors writing to disk, unreachable
+// hosts and cancellation are not.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code >= 500 ||
+			status.Code == http.StatusTooManyRequests ||
+			status.Code == http.StatusRequestTimeout
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// A lookup that timed out or hit a failing resolver may work next
+		// time; a host that doesn't exist won't
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	// Other network errors, like a refused connection, are permanent
+	// unless they timed out
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// reconnectReader calls recovered once a reopened stream delivers data
+// again
+type reconnectReader struct {
+	io.Reader
+	recovered func()
+}
+
+// Read implements io.Reader
+func (r *reconnectReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && r.recovered != nil {
+		r.recovered()
+		r.recovered = nil
+	}
+	return n, err
+}
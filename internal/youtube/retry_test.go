@@ -0,0 +1,151 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFetchRangeRetries(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	tests := []struct {
+		name         string
+		failures     []int // status of each failing request; 0 cuts the body short
+		wantErr      bool
+		wantRequests int
+		wantAttempt  int // highest reconnect attempt reported
+	}{
+		{name: "No failures", wantRequests: 1},
+		{name: "Server errors", failures: []int{503, 502}, wantRequests: 3, wantAttempt: 3},
+		{name: "Server error then cut short", failures: []int{503, 0}, wantRequests: 3, wantAttempt: 2},
+		{name: "Progress restarts the count", failures: []int{0, 0, 0, 0, 0, 0}, wantRequests: 7, wantAttempt: 2},
+		{name: "Gives up", failures: []int{503, 503, 503, 503, 503}, wantErr: true, wantRequests: 3, wantAttempt: 3},
+		{name: "Not retryable", failures: []int{404}, wantErr: true, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				start, end := 0, len(data)-1
+				if rng := r.URL.Query().Get("range"); rng != "" {
+					parts := strings.SplitN(rng, "-", 2)
+					start, _ = strconv.Atoi(parts[0])
+					end, _ = strconv.Atoi(parts[1])
+				}
+				requests++
+				if requests <= len(tt.failures) {
+					if status := tt.failures[requests-1]; status != 0 {
+						w.WriteHeader(status)
+						return
+					}
+					// Promise the whole range but send only a few bytes
+					w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+					w.Write(data[start : start+4])
+					return
+				}
+				w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+				w.Write(data[start : end+1])
+			}))
+			defer server.Close()
+
+			outputFile := filepath.Join(t.TempDir(), "video.mp4")
+			part, err := openPart(outputFile, "abc", 18, int64(len(data)))
+			if err != nil {
+				t.Fatalf("openPart() error = %v", err)
+			}
+			defer part.Close()
+
+			d := NewDownloader(NewClient())
+			d.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+			var attempt int
+			tracker := newProgressTracker(0, int64(len(data)), func(p DownloadProgress) {
+				if p.Attempt > attempt {
+					attempt = p.Attempt
+					if p.MaxAttempts != 3 {
+						t.Errorf("MaxAttempts = %d, want 3", p.MaxAttempts)
+					}
+				}
+			})
+
+			err = d.fetchRange(context.Background(), newStreamSource(server.URL, nil), part, part.plan(1)[0], tracker)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if attempt != tt.wantAttempt {
+				t.Errorf("reported attempt = %d, want %d", attempt, tt.wantAttempt)
+			}
+			if !tt.wantErr && part.written() != int64(len(data)) {
+				t.Errorf("written() = %d, want %d", part.written(), len(data))
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"Connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"Read timeout", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"DNS timeout", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "rr1.googlevideo.com", IsTimeout: true}}, true},
+		{"Connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, false},
+		{"Unknown host", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Name: "rr1.googlevideo.invalid", IsNotFound: true}}, false},
+		{"Server error", &StatusError{Code: 503}, true},
+		{"Too many requests", &StatusError{Code: 429}, true},
+		{"Not found", &StatusError{Code: 404}, false},
+		{"Forbidden", &StatusError{Code: 403}, false},
+		{"Cancelled", context.Canceled, false},
+		{"Disk full", &os.PathError{Op: "write", Path: "video.mp4", Err: syscall.ENOSPC}, false},
+		{"Wrapped", fmt.Errorf("range 0: %w", io.ErrUnexpectedEOF), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{9, 2500 * time.Millisecond, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format rules pick a format for a video before its formats are known, so
+// one choice can be applied to every video in a playlist. A rule is a format
+// selector (see Selector), a named rule, "<height>p" (e.g. "720p") for the
+// best video no taller than that, or a plain number for the format with that
+// itag.
+const (
+	RuleBest  = "best"  // highest quality video with audio
+	RuleAudio = "audio" // highest bitrate audio-only stream
+)
+
+// ErrNoMatchingFormat is returned when no format satisfies a rule
+var ErrNoMatchingFormat = errors.New("no format matches")
+
+// ErrFormatUnavailable is returned when a chosen format is no longer offered
+// for a video, e.g. because YouTube changed its streams since it was listed
+var ErrFormatUnavailable = errors.New("format is no longer available")
+
+// SelectFormat picks the format that best satisfies rule. Formats with audio,
+// including video-only formats paired with an audio stream, are preferred
+// over silent ones.
+func SelectFormat(formats []Format, rule string) (Format, error) {
+	sel, err := ParseRule(rule)
+	if err != nil {
+		return Format{}, err
+	}
+	return sel.Select(formats)
+}
+
+// ParseRule parses a format rule into a selector, so rules can be checked
+// before any video is fetched
+func ParseRule(rule string) (*Selector, error) {
+	s := strings.ToLower(strings.TrimSpace(rule))
+	switch height, err := strconv.Atoi(strings.TrimSuffix(s, "p")); {
+	case s == RuleAudio:
+		s = "bestaudio"
+	case err == nil && strings.HasSuffix(s, "p") && height > 0:
+		s = fmt.Sprintf("best[height<=?%d]", height)
+	}
+
+	sel, err := ParseSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	sel.raw = rule
+	return sel, nil
+}
+
+// FindFormat returns the format of formats matching chosen by itag, with its
+// paired audio stream looked up the same way, so a format picked from an
+// earlier listing resolves to exactly the same streams
+func FindFormat(formats []Format, chosen Format) (Format, error) {
+	format, ok := formatByItag(formats, chosen.ItagNo)
+	if !ok {
+		return Format{}, fmt.Errorf("%w: %s (itag %d)", ErrFormatUnavailable, describeChoice(chosen), chosen.ItagNo)
+	}
+
+	if chosen.Audio != nil {
+		audio, ok := formatByItag(formats, chosen.Audio.ItagNo)
+		if !ok {
+			return Format{}, fmt.Errorf("%w: audio for %s (itag %d)", ErrFormatUnavailable, describeChoice(chosen), chosen.Audio.ItagNo)
+		}
+		format.Audio = &audio
+		format.Extension = chosen.Extension
+	}
+	if chosen.ExtractAudio != "" {
+		format.ExtractAudio = chosen.ExtractAudio
+		format.Extension = chosen.Extension
+	}
+	return format, nil
+}
+
+// formatByItag returns the format with the given itag
+func formatByItag(formats []Format, itag int) (Format, bool) {
+	for _, f := range formats {
+		if f.ItagNo == itag {
+			f.Audio = nil
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// describeChoice names a format in errors
+func describeChoice(f Format) string {
+	if f.Quality == "" {
+		return f.Extension
+	}
+	return fmt.Sprintf("%s %s", f.Quality, f.Extension)
+}
+
+// betterVideo reports whether a is a better pick than b: streams with audio
+// (built in or paired) first, then taller, then higher bitrate
+func betterVideo(a, b Format) bool {
+	if hasSound(a) != hasSound(b) {
+		return hasSound(a)
+	}
+	if ha, hb := formatHeight(a), formatHeight(b); ha != hb {
+		return ha > hb
+	}
+	return a.Bitrate > b.Bitrate
+}
+
+// hasSound reports whether a format is downloaded with audio
+func hasSound(f Format) bool {
+	return f.HasAudio || f.Audio != nil
+}
+
+// formatHeight returns the height of a video format from its resolution
+func formatHeight(f Format) int {
+	_, height, ok := strings.Cut(f.Resolution, "x")
+	if !ok {
+		return 0
+	}
+	h, _ := strconv.Atoi(height)
+	return h
+}
+
+// ResolveFormat fetches a video and picks its format with rule
+func (c *Client) ResolveFormat(videoID, rule string) (Format, error) {
+	info, err := c.GetVideoInfo(videoID)
+	if err != nil {
+		return Format{}, err
+	}
+	return SelectFormat(info.Formats, rule)
+}
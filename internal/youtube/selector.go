@@ -0,0 +1,481 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSelector is returned for format selectors that can't be parsed
+var ErrInvalidSelector = errors.New("invalid format selector")
+
+// Selector picks a format from the formats of a video, so downloads can be
+// started without asking which format to use. A selector is a list of
+// alternatives separated by "/", tried in order until one matches:
+//
+//	bestvideo[height<=1080][ext=mp4]+bestaudio/best
+//
+// Each alternative names a format, or a video and an audio format joined by
+// "+" to be merged into one file. A format is a keyword or an itag number,
+// followed by any number of filters in brackets:
+//
+//	best, b          best format with video, preferring ones with sound
+//	worst, w         smallest format with video, preferring ones with sound
+//	bestvideo, bv    best video-only format
+//	worstvideo, wv   smallest video-only format
+//	bestaudio, ba    highest bitrate audio-only format
+//	worstaudio, wa   lowest bitrate audio-only format
+//
+// Filters compare a field with a value: height, width, bitrate and filesize
+// take =, !=, <, <=, > and >=, with a "?" after the operator to also accept
+// formats where the value isn't known; ext, codec, vcodec and acodec take =,
+// != and ^= (starts with), $= (ends with) and *= (contains); has_audio and
+// has_video are written as [has_audio] or [!has_audio]. Sizes accept K, M and
+// G suffixes and bitrates k and M.
+type Selector struct {
+	raw          string
+	alternatives []selectorAlternative
+}
+
+// selectorAlternative is one of the "/"-separated choices of a selector
+type selectorAlternative struct {
+	video selectorTerm
+	audio *selectorTerm // set for "video+audio" pairs
+}
+
+// selectorTerm selects one format
+type selectorTerm struct {
+	keyword string // one of the keywords, or "" for an itag
+	itag    int
+	filters []formatFilter
+}
+
+// formatFilter is a bracketed condition of a selector term
+type formatFilter struct {
+	field    string
+	op       string
+	optional bool // the condition holds when the value isn't known
+	text     string
+	number   float64
+}
+
+// selectorKeywords maps the keywords and their short forms to their names
+var selectorKeywords = map[string]string{
+	"best": "best", "b": "best",
+	"worst": "worst", "w": "worst",
+	"bestvideo": "bestvideo", "bv": "bestvideo",
+	"worstvideo": "worstvideo", "wv": "worstvideo",
+	"bestaudio": "bestaudio", "ba": "bestaudio",
+	"worstaudio": "worstaudio", "wa": "worstaudio",
+}
+
+// Filter fields by the kind of value they compare
+var (
+	numberFields = map[string]bool{"height": true, "width": true, "bitrate": true, "filesize": true}
+	textFields   = map[string]bool{"ext": true, "codec": true, "vcodec": true, "acodec": true}
+	boolFields   = map[string]bool{"has_audio": true, "has_video": true}
+)
+
+// ParseSelector parses a format selector
+func ParseSelector(s string) (*Selector, error) {
+	sel := &Selector{raw: s}
+	compact := strings.Join(strings.Fields(strings.ToLower(s)), "")
+	if compact == "" {
+		return nil, fmt.Errorf("%w: selector is empty", ErrInvalidSelector)
+	}
+
+	for _, alt := range strings.Split(compact, "/") {
+		parts := strings.Split(alt, "+")
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("%w %q: only one video and one audio format can be merged", ErrInvalidSelector, alt)
+		}
+
+		video, err := parseTerm(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		a := selectorAlternative{video: video}
+		if len(parts) == 2 {
+			audio, err := parseTerm(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			a.audio = &audio
+		}
+		sel.alternatives = append(sel.alternatives, a)
+	}
+	return sel, nil
+}
+
+// String returns the selector as it was written
+func (s *Selector) String() string {
+	return s.raw
+}
+
+// parseTerm parses a keyword or itag followed by filters
+func parseTerm(s string) (selectorTerm, error) {
+	var t selectorTerm
+
+	name, rest, _ := strings.Cut(s, "[")
+	if rest != "" || strings.HasSuffix(s, "[") {
+		rest = "[" + rest
+	}
+	if keyword, ok := selectorKeywords[name]; ok {
+		t.keyword = keyword
+	} else if itag, err := strconv.Atoi(name); err == nil && itag > 0 {
+		t.itag = itag
+	} else if name == "" {
+		return t, fmt.Errorf("%w %q: missing format", ErrInvalidSelector, s)
+	} else {
+		return t, fmt.Errorf("%w: unknown format %q", ErrInvalidSelector, name)
+	}
+
+	for rest != "" {
+		end := strings.IndexByte(rest, ']')
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			return t, fmt.Errorf("%w %q: expected [filter]", ErrInvalidSelector, s)
+		}
+		f, err := parseFilter(rest[1:end])
+		if err != nil {
+			return t, err
+		}
+		t.filters = append(t.filters, f)
+		rest = rest[end+1:]
+	}
+	return t, nil
+}
+
+// filterOps are the comparison operators, longest first so "<=" isn't
+// read as "<"
+var filterOps = []string{"<=", ">=", "!=", "^=", "$=", "*=", "=", "<", ">"}
+
+// parseFilter parses the inside of a [filter]
+func parseFilter(s string) (formatFilter, error) {
+	if boolFields[strings.TrimPrefix(s, "!")] {
+		f := formatFilter{field: strings.TrimPrefix(s, "!"), op: "=", number: 1}
+		if strings.HasPrefix(s, "!") {
+			f.number = 0
+		}
+		return f, nil
+	}
+
+	for _, op := range filterOps {
+		i := strings.Index(s, op)
+		if i <= 0 {
+			continue
+		}
+		f := formatFilter{field: s[:i], op: op}
+		value := s[i+len(op):]
+		if strings.HasPrefix(value, "?") {
+			f.optional = true
+			value = value[1:]
+		}
+		return f, f.parseValue(value)
+	}
+	return formatFilter{}, fmt.Errorf("%w: bad filter [%s]", ErrInvalidSelector, s)
+}
+
+// parseValue checks the operator against the field and parses the value
+func (f *formatFilter) parseValue(value string) error {
+	bad := func(want string) error {
+		return fmt.Errorf("%w: [%s%s%s] needs %s", ErrInvalidSelector, f.field, f.op, value, want)
+	}
+	if value == "" {
+		return bad("a value")
+	}
+
+	switch {
+	case numberFields[f.field]:
+		if strings.ContainsAny(f.op, "^$*") {
+			return bad("one of = != < <= > >=")
+		}
+		n, ok := parseQuantity(value, f.field == "filesize")
+		if !ok {
+			return bad("a number")
+		}
+		f.number = n
+
+	case textFields[f.field]:
+		if strings.ContainsAny(f.op, "<>") {
+			return bad("one of = != ^= $= *=")
+		}
+		f.text = value
+
+	case boolFields[f.field]:
+		if f.op != "=" && f.op != "!=" {
+			return bad("true or false")
+		}
+		switch value {
+		case "true", "yes", "1":
+			f.number = 1
+		case "false", "no", "0":
+			f.number = 0
+		default:
+			return bad("true or false")
+		}
+		if f.op == "!=" {
+			f.op, f.number = "=", 1-f.number
+		}
+
+	default:
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidSelector, f.field)
+	}
+	return nil
+}
+
+// parseQuantity parses a number with an optional K, M or G suffix. Sizes
+// use binary multiples and may end in "B" or "iB"; bitrates use decimal ones.
+func parseQuantity(s string, size bool) (float64, bool) {
+	if size {
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "b"), "i")
+	}
+
+	unit := 1000.0
+	if size {
+		unit = 1024
+	}
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier = unit
+	case strings.HasSuffix(s, "m"):
+		multiplier = unit * unit
+	case strings.HasSuffix(s, "g"):
+		multiplier = unit * unit * unit
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n * multiplier, true
+}
+
+// Select returns the format chosen by the first alternative that matches
+func (s *Selector) Select(formats []Format) (Format, error) {
+	for _, alt := range s.alternatives {
+		if f, ok := alt.selectFrom(formats); ok {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("%w %q", ErrNoMatchingFormat, s.raw)
+}
+
+// selectFrom picks the format of one alternative, merging a pair
+func (a selectorAlternative) selectFrom(formats []Format) (Format, bool) {
+	video, ok := a.video.selectFrom(formats)
+	if !ok || a.audio == nil {
+		return video, ok
+	}
+
+	audio, ok := a.audio.selectFrom(formats)
+	if !ok || !video.HasVideo || video.HasAudio || !audio.IsAudioOnly {
+		return Format{}, false
+	}
+	return mergedFormat(video, audio), true
+}
+
+// mergedFormat returns video with audio paired to it. Streams that don't
+// share a container are merged into Matroska, which holds any codec.
+func mergedFormat(video, audio Format) Format {
+	paired := audio
+	video.Audio = &paired
+
+	sameContainer := (video.Extension == "mp4" && audio.Extension == "m4a") ||
+		(video.Extension == "webm" && audio.Extension == "webm")
+	if !sameContainer {
+		video.Extension = "mkv"
+	}
+	return video
+}
+
+// selectFrom returns the best format for the term that passes its filters
+func (t selectorTerm) selectFrom(formats []Format) (Format, bool) {
+	var best *Format
+	for _, f := range formats {
+		candidate, ok := t.candidate(f)
+		if !ok || !t.matches(candidate) {
+			continue
+		}
+		if best == nil || t.better(candidate, *best) {
+			c := candidate
+			best = &c
+		}
+	}
+	if best == nil {
+		return Format{}, false
+	}
+	return *best, true
+}
+
+// candidate returns f in the form the term would use it, or false if the
+// term never picks f
+func (t selectorTerm) candidate(f Format) (Format, bool) {
+	switch t.keyword {
+	case "":
+		return f, f.ItagNo == t.itag
+	case "best", "worst":
+		return f, f.HasVideo
+	case "bestvideo", "worstvideo":
+		// Use the video stream on its own, without any paired audio
+		f.Audio = nil
+		return f, f.HasVideo && !f.HasAudio
+	default:
+		return f, f.IsAudioOnly
+	}
+}
+
+// better reports whether a ranks above b for the term
+func (t selectorTerm) better(a, b Format) bool {
+	switch t.keyword {
+	case "best":
+		return betterVideo(a, b)
+	case "worst":
+		if hasSound(a) != hasSound(b) {
+			return hasSound(a)
+		}
+		if ha, hb := formatHeight(a), formatHeight(b); ha != hb {
+			return ha < hb
+		}
+		return a.Bitrate < b.Bitrate
+	case "bestvideo":
+		if ha, hb := formatHeight(a), formatHeight(b); ha != hb {
+			return ha > hb
+		}
+		return a.Bitrate > b.Bitrate
+	case "worstvideo":
+		if ha, hb := formatHeight(a), formatHeight(b); ha != hb {
+			return ha < hb
+		}
+		return a.Bitrate < b.Bitrate
+	case "bestaudio":
+		return a.Bitrate > b.Bitrate
+	case "worstaudio":
+		return a.Bitrate < b.Bitrate
+	}
+	return false
+}
+
+// matches reports whether f passes every filter of the term
+func (t selectorTerm) matches(f Format) bool {
+	for _, filter := range t.filters {
+		if !filter.matches(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether f passes the filter
+func (f formatFilter) matches(format Format) bool {
+	if textFields[f.field] {
+		value := strings.ToLower(formatText(format, f.field))
+		switch f.op {
+		case "=":
+			return value == f.text
+		case "!=":
+			return value != f.text
+		case "^=":
+			return strings.HasPrefix(value, f.text)
+		case "$=":
+			return strings.HasSuffix(value, f.text)
+		default:
+			return strings.Contains(value, f.text)
+		}
+	}
+
+	value, known := formatNumber(format, f.field)
+	if !known {
+		return f.optional
+	}
+	switch f.op {
+	case "=":
+		return value == f.number
+	case "!=":
+		return value != f.number
+	case "<":
+		return value < f.number
+	case "<=":
+		return value <= f.number
+	case ">":
+		return value > f.number
+	default:
+		return value >= f.number
+	}
+}
+
+// formatText returns a text field of a format
+func formatText(f Format, field string) string {
+	switch field {
+	case "ext":
+		return f.Extension
+	case "codec":
+		return strings.Join(formatCodecs(f), ",")
+	case "vcodec":
+		if !f.HasVideo {
+			return ""
+		}
+		return formatCodecs(f)[0]
+	default:
+		codecs := formatCodecs(f)
+		switch {
+		case f.IsAudioOnly:
+			return codecs[0]
+		case f.HasAudio && len(codecs) > 1:
+			return codecs[1]
+		case f.Audio != nil:
+			return formatCodecs(*f.Audio)[0]
+		}
+		return ""
+	}
+}
+
+// formatCodecs returns the codecs listed in the MIME type of a format, e.g.
+// ["avc1.640028", "mp4a.40.2"]. The result has at least one element.
+func formatCodecs(f Format) []string {
+	_, params, _ := strings.Cut(f.MimeType, "codecs=")
+	params = strings.Trim(strings.TrimSpace(params), `"`)
+	if params == "" {
+		return []string{""}
+	}
+
+	codecs := strings.Split(params, ",")
+	for i := range codecs {
+		codecs[i] = strings.TrimSpace(codecs[i])
+	}
+	return codecs
+}
+
+// formatNumber returns a numeric field of a format and whether it's known
+func formatNumber(f Format, field string) (float64, bool) {
+	switch field {
+	case "height":
+		h := formatHeight(f)
+		return float64(h), h > 0
+	case "width":
+		w, _, _ := strings.Cut(f.Resolution, "x")
+		n, err := strconv.Atoi(w)
+		return float64(n), err == nil && n > 0
+	case "bitrate":
+		return float64(f.Bitrate), f.Bitrate > 0
+	case "filesize":
+		size := f.TotalSize()
+		return float64(size), f.FileSize > 0 && (f.Audio == nil || f.Audio.FileSize > 0)
+	case "has_audio":
+		return boolNumber(hasSound(f)), true
+	default:
+		return boolNumber(f.HasVideo), true
+	}
+}
+
+// boolNumber converts a boolean to the number filters compare it with
+func boolNumber(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
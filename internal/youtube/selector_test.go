@@ -0,0 +1,76 @@
+package youtube
+
+import "testing"
+
+func TestFormatSelector(t *testing.T) {
+	formats := []Format{
+		{ItagNo: 18, Extension: "mp4", MimeType: `video/mp4; codecs="avc1.42001E, mp4a.40.2"`, Resolution: "640x360", HasVideo: true, HasAudio: true, Bitrate: 500000, FileSize: 20 << 20},
+		{ItagNo: 136, Extension: "mp4", MimeType: `video/mp4; codecs="avc1.4d401f"`, Resolution: "1280x720", HasVideo: true, Bitrate: 2000000, FileSize: 80 << 20},
+		{ItagNo: 137, Extension: "mp4", MimeType: `video/mp4; codecs="avc1.640028"`, Resolution: "1920x1080", HasVideo: true, Bitrate: 4000000, FileSize: 160 << 20},
+		{ItagNo: 313, Extension: "webm", MimeType: `video/webm; codecs="vp9"`, Resolution: "3840x2160", HasVideo: true, Bitrate: 16000000},
+		{ItagNo: 140, Extension: "m4a", MimeType: `audio/mp4; codecs="mp4a.40.2"`, IsAudioOnly: true, HasAudio: true, Bitrate: 128000, FileSize: 4 << 20},
+		{ItagNo: 251, Extension: "webm", MimeType: `audio/webm; codecs="opus"`, IsAudioOnly: true, HasAudio: true, Bitrate: 160000, FileSize: 5 << 20},
+	}
+
+	tests := []struct {
+		name      string
+		selector  string
+		want      int
+		wantAudio int
+		wantExt   string
+		wantErr   bool
+	}{
+		{name: "Best", selector: "best", want: 18},
+		{name: "Best video", selector: "bestvideo", want: 313},
+		{name: "Worst video", selector: "wv", want: 136},
+		{name: "Best audio", selector: "bestaudio", want: 251},
+		{name: "Worst audio", selector: "worstaudio", want: 140},
+		{name: "Height filter", selector: "bestvideo[height<=1080]", want: 137},
+		{name: "Ext filter", selector: "ba[ext=m4a]", want: 140},
+		{name: "Codec prefix", selector: "bv[vcodec^=avc1][height<720]", wantErr: true},
+		{name: "Codec contains", selector: "bestaudio[acodec*=mp4a]", want: 140},
+		{name: "Bitrate", selector: "bv[bitrate<3M]", want: 136},
+		{name: "Filesize", selector: "bv[filesize<100M]", want: 136},
+		{name: "Unknown filesize excluded", selector: "bv[filesize>100M]", want: 137},
+		{name: "Unknown filesize allowed", selector: "bv[filesize>?100M]", want: 313},
+		{name: "No audio", selector: "best[!has_audio]", want: 313},
+		{name: "Has audio", selector: "best[has_audio=true]", want: 18},
+		{name: "Itag with filter", selector: "137[height=1080]", want: 137},
+		{name: "Merged pair", selector: "bestvideo[height<=1080][ext=mp4]+bestaudio[ext=m4a]", want: 137, wantAudio: 140, wantExt: "mp4"},
+		{name: "Mixed containers", selector: "bv[ext=mp4]+ba[ext=webm]", want: 137, wantAudio: 251, wantExt: "mkv"},
+		{name: "Fallback", selector: "bv[height>4320]+ba/best", want: 18},
+		{name: "Spaces", selector: " bestvideo [ height <= 720 ] ", want: 136},
+		{name: "Can't merge muxed", selector: "18+bestaudio", wantErr: true},
+		{name: "Nothing matches", selector: "bestaudio[ext=flac]", wantErr: true},
+		{name: "Unknown keyword", selector: "greatest", wantErr: true},
+		{name: "Unknown field", selector: "best[fps>30]", wantErr: true},
+		{name: "Bad operator", selector: "best[ext<mp4]", wantErr: true},
+		{name: "Bad number", selector: "best[height<=tall]", wantErr: true},
+		{name: "Unclosed filter", selector: "best[height<=720", wantErr: true},
+		{name: "Three streams", selector: "bv+ba+ba", wantErr: true},
+		{name: "Empty alternative", selector: "best/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SelectFormat(formats, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.ItagNo != tt.want {
+				t.Errorf("SelectFormat() itag = %d, want %d", got.ItagNo, tt.want)
+			}
+
+			audio := 0
+			if got.Audio != nil {
+				audio = got.Audio.ItagNo
+			}
+			if audio != tt.wantAudio {
+				t.Errorf("SelectFormat() audio itag = %d, want %d", audio, tt.wantAudio)
+			}
+			if tt.wantExt != "" && got.Extension != tt.wantExt {
+				t.Errorf("SelectFormat() extension = %q, want %q", got.Extension, tt.wantExt)
+			}
+		})
+	}
+}
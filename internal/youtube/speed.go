@@ -0,0 +1,119 @@
+package youtube
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// SpeedEstimator names a way of estimating the current download speed
+type SpeedEstimator string
+
+const (
+	// SpeedEWMA weighs recent samples exponentially more than old ones;
+	// SpeedWindow is its time constant
+	SpeedEWMA SpeedEstimator = "ewma"
+
+	// SpeedSliding averages over the last SpeedWindow only
+	SpeedSliding SpeedEstimator = "window"
+
+	// DefaultSpeedWindow is how far back the current speed looks
+	DefaultSpeedWindow = 5 * time.Second
+)
+
+// ParseSpeedEstimator validates a speed estimator name
+func ParseSpeedEstimator(s string) (SpeedEstimator, error) {
+	switch e := SpeedEstimator(s); e {
+	case SpeedEWMA, SpeedSliding:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown speed estimator %q, use %q or %q", s, SpeedEWMA, SpeedSliding)
+	}
+}
+
+// speedMeter estimates the current speed from the total bytes downloaded,
+// sampled over time
+type speedMeter interface {
+	// sample records that total bytes had been downloaded at now and
+	// returns the current speed in bytes per second
+	sample(now time.Time, total int64) float64
+}
+
+// newSpeedMeter creates a meter of the given kind looking back window
+func newSpeedMeter(kind SpeedEstimator, window time.Duration) speedMeter {
+	if window <= 0 {
+		window = DefaultSpeedWindow
+	}
+	if kind == SpeedSliding {
+		return &slidingMeter{window: window}
+	}
+	return &ewmaMeter{window: window}
+}
+
+// ewmaMeter is an exponentially weighted moving average of the speed
+// between samples. Weights depend on the time between samples, so uneven
+// sampling doesn't skew the average.
+type ewmaMeter struct {
+	window    time.Duration
+	rate      float64
+	lastTime  time.Time
+	lastTotal int64
+	started   bool
+	primed    bool // rate holds a measurement
+}
+
+// sample implements speedMeter
+func (m *ewmaMeter) sample(now time.Time, total int64) float64 {
+	if !m.started {
+		m.started = true
+		m.lastTime, m.lastTotal = now, total
+		return 0
+	}
+
+	dt := now.Sub(m.lastTime)
+	if dt <= 0 {
+		return m.rate
+	}
+	instant := float64(total-m.lastTotal) / dt.Seconds()
+	if !m.primed {
+		m.rate = instant
+		m.primed = true
+	} else {
+		alpha := 1 - math.Exp(-dt.Seconds()/m.window.Seconds())
+		m.rate += alpha * (instant - m.rate)
+	}
+	m.lastTime, m.lastTotal = now, total
+	return m.rate
+}
+
+// speedSample is the total downloaded at one point in time
+type speedSample struct {
+	time  time.Time
+	total int64
+}
+
+// slidingMeter is the average speed over the last window
+type slidingMeter struct {
+	window  time.Duration
+	samples []speedSample
+}
+
+// sample implements speedMeter
+func (m *slidingMeter) sample(now time.Time, total int64) float64 {
+	m.samples = append(m.samples, speedSample{now, total})
+
+	// Keep one sample at or before the start of the window to measure from
+	cutoff := now.Add(-m.window)
+	drop := 0
+	for drop+1 < len(m.samples) && !m.samples[drop+1].time.After(cutoff) {
+		drop++
+	}
+	m.samples = m.samples[drop:]
+
+	first := m.samples[0]
+	elapsed := now.Sub(first.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(total-first.total) / elapsed
+}
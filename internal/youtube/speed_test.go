@@ -0,0 +1,48 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpeedMeters(t *testing.T) {
+	tests := []struct {
+		kind SpeedEstimator
+		min  float64
+		max  float64
+	}{
+		{SpeedEWMA, 100 << 10, 250 << 10},
+		{SpeedSliding, 100 << 10, 100 << 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			meter := newSpeedMeter(tt.kind, 5*time.Second)
+			start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			meter.sample(start, 0)
+
+			// 1 MB/s for 20s, then throttled to 100 KB/s for 10s
+			var total int64
+			var speed float64
+			for i := 1; i <= 300; i++ {
+				if i <= 200 {
+					total += 100 << 10
+				} else {
+					total += 10 << 10
+				}
+				speed = meter.sample(start.Add(time.Duration(i)*100*time.Millisecond), total)
+			}
+
+			if speed < tt.min || speed > tt.max {
+				t.Errorf("speed after throttling = %.0f, want between %.0f and %.0f", speed, tt.min, tt.max)
+			}
+			if average := float64(total) / 30; speed >= average/2 {
+				t.Errorf("speed = %.0f should follow the throttling well below the %.0f average", speed, average)
+			}
+		})
+	}
+
+	if _, err := ParseSpeedEstimator("median"); err == nil {
+		t.Error("ParseSpeedEstimator() should reject unknown estimators")
+	}
+}
@@ -0,0 +1,90 @@
+package youtube
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// DefaultVideoTTL is how long a fetched video is reused. The stream URLs
+// YouTube signs for a video expire after about six hours; staying well below
+// that leaves time for long downloads to finish with the same URLs.
+const DefaultVideoTTL = time.Hour
+
+// storedVideo is a video with the time it was fetched
+type storedVideo struct {
+	video   *youtube.Video
+	fetched time.Time
+}
+
+// videoStore keeps fetched videos for the session, so listing formats,
+// choosing one and downloading it all see the same video and its format set
+// instead of fetching it again at every step
+type videoStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	now    func() time.Time
+	videos map[string]storedVideo
+}
+
+// newVideoStore creates a store that keeps videos for ttl
+func newVideoStore(ttl time.Duration) *videoStore {
+	return &videoStore{
+		ttl:    ttl,
+		now:    time.Now,
+		videos: make(map[string]storedVideo),
+	}
+}
+
+// get returns the stored video with the given ID if it hasn't expired
+func (s *videoStore) get(id string) (*youtube.Video, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.videos[id]
+	if !ok {
+		return nil, false
+	}
+	if s.now().Sub(stored.fetched) >= s.ttl {
+		delete(s.videos, id)
+		return nil, false
+	}
+	return stored.video, true
+}
+
+// put stores a freshly fetched video and drops expired ones
+func (s *videoStore) put(video *youtube.Video) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for id, stored := range s.videos {
+		if now.Sub(stored.fetched) >= s.ttl {
+			delete(s.videos, id)
+		}
+	}
+	s.videos[video.ID] = storedVideo{video: video, fetched: now}
+}
+
+// forget drops a video so the next request fetches it again
+func (s *videoStore) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.videos, id)
+}
+
+// video returns the video with the given ID, fetching it only if it isn't
+// in the session store
+func (c *Client) video(videoID string) (*youtube.Video, error) {
+	if video, ok := c.videos.get(videoID); ok {
+		return video, nil
+	}
+
+	video, err := c.fetchVideo(videoID)
+	if err != nil {
+		return nil, err
+	}
+	c.videos.put(video)
+	return video, nil
+}
@@ -0,0 +1,253 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// streamChunkSize is the size of each ranged request. YouTube throttles
+// long-running single requests, so streams are fetched in 10MB pieces.
+const streamChunkSize int64 = 10 * 1024 * 1024
+
+// errRangeIgnored is returned when a server answers a ranged request with
+// bytes from outside the range. Writing them would overwrite other parts of
+// the file.
+var errRangeIgnored = errors.New("server ignored the requested byte range")
+
+// headerTransport remembers the headers the YouTube library sends so our own
+// stream requests look the same as the ones the stream URL was signed for
+type headerTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	userAgent string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ua := req.Header.Get("User-Agent"); ua != "" {
+		t.mu.Lock()
+		t.userAgent = ua
+		t.mu.Unlock()
+	}
+	return t.base.RoundTrip(req)
+}
+
+// decorate applies the remembered headers to req
+func (t *headerTransport) decorate(req *http.Request) {
+	t.mu.Lock()
+	ua := t.userAgent
+	t.mu.Unlock()
+
+	if ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	req.Header.Set("Origin", "https://youtube.com")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+}
+
+// rangeReader reads a span of a stream URL using ranged requests
+type rangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	setup  func(*http.Request)
+	url    string
+
+	offset int64 // next byte to read
+	end    int64 // offset to stop at (exclusive), 0 to read to the end
+
+	body      io.ReadCloser
+	remaining int64 // bytes left in the current response, -1 if unknown
+}
+
+// newRangeReader creates a reader for the bytes of streamURL from offset up
+// to end. An end of 0 reads the whole stream in a single request.
+func newRangeReader(ctx context.Context, client *http.Client, setup func(*http.Request), streamURL string, offset, end int64) *rangeReader {
+	return &rangeReader{
+		ctx:    ctx,
+		client: client,
+		setup:  setup,
+		url:    streamURL,
+		offset: offset,
+		end:    end,
+	}
+}
+
+// Read implements io.Reader
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if r.end > 0 && r.offset >= r.end {
+				return 0, io.EOF
+			}
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+		}
+
+		if r.remaining == 0 {
+			// The whole range has arrived, so the body has to end here
+			if err := r.checkEnd(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if r.remaining > 0 && int64(len(p)) > r.remaining {
+			p = p[:r.remaining]
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if r.remaining > 0 {
+			r.remaining -= int64(n)
+		}
+
+		if err == io.EOF {
+			r.body.Close()
+			r.body = nil
+
+			if r.remaining > 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			if r.end <= 0 {
+				// Unknown length: the single response was the whole stream
+				return n, io.EOF
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+// checkEnd closes the body of a fully read range, failing if it holds more
+// than was asked for
+func (r *rangeReader) checkEnd() error {
+	_, err := io.ReadFull(r.body, make([]byte, 1))
+	r.body.Close()
+	r.body = nil
+
+	switch err {
+	case io.EOF:
+		return nil
+	case nil:
+		return errRangeIgnored
+	default:
+		return err
+	}
+}
+
+// next requests the next chunk of the stream
+func (r *rangeReader) next() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+
+	r.remaining = -1
+	if r.end > 0 {
+		end := r.offset + streamChunkSize - 1
+		if end > r.end-1 {
+			end = r.end - 1
+		}
+
+		// googlevideo takes the byte range as a query parameter
+		q := req.URL.Query()
+		q.Set("range", fmt.Sprintf("%d-%d", r.offset, end))
+		req.URL.RawQuery = q.Encode()
+		r.remaining = end - r.offset + 1
+	} else if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	}
+
+	if r.setup != nil {
+		r.setup(req)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return &StatusError{Code: resp.StatusCode, URL: redactURL(r.url)}
+	}
+	if req.Header.Get("Range") != "" && resp.StatusCode != http.StatusPartialContent {
+		// The whole stream from the start, not the rest of it
+		resp.Body.Close()
+		return errRangeIgnored
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+// Close implements io.Closer
+func (r *rangeReader) Close() error {
+	if r.body != nil {
+		err := r.body.Close()
+		r.body = nil
+		return err
+	}
+	return nil
+}
+
+// redactURL strips the signed query string from a stream URL for error messages
+func redactURL(streamURL string) string {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return "stream"
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// streamURL resolves the download URL for format
+func (c *Client) streamURL(ctx context.Context, video *youtube.Video, format *youtube.Format) (string, error) {
+	streamURL, err := c.client.GetStreamURLContext(ctx, video, format)
+	if err != nil {
+		return "", fmt.Errorf("failed to get stream URL: %w", err)
+	}
+	return streamURL, nil
+}
+
+// refreshStreamURL fetches the video again and resolves a fresh URL for
+// the format with the given itag. Stream URLs are signed per fetch, so the
+// stored video's URLs can't be reused.
+func (c *Client) refreshStreamURL(ctx context.Context, videoID string, itag int) (string, error) {
+	c.videos.forget(videoID)
+	video, err := c.video(videoID)
+	if err != nil {
+		return "", err
+	}
+	format, err := findFormat(video, itag)
+	if err != nil {
+		return "", err
+	}
+	return c.streamURL(ctx, video, format)
+}
+
+// rangeReader opens the bytes of streamURL from offset up to end
+func (c *Client) rangeReader(ctx context.Context, streamURL string, offset, end int64) *rangeReader {
+	client := c.client.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var setup func(*http.Request)
+	if c.transport != nil {
+		setup = c.transport.decorate
+	}
+
+	return newRangeReader(ctx, client, setup, streamURL, offset, end)
+}
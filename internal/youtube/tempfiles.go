@@ -0,0 +1,166 @@
+package youtube
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tempTag marks files being written before they get their final name.
+	// It goes before the extension so tools like ffmpeg still recognise
+	// the container.
+	tempTag = ".ytdl-tmp"
+
+	// StaleTempAge is how long a temporary file has to go untouched before
+	// SweepTempFiles treats it as left behind by a crash rather than a
+	// download still in progress
+	StaleTempAge = time.Hour
+
+	// sweepDepth is how many directories below the download directory are
+	// searched, enough for templates that sort files into subdirectories
+	sweepDepth = 4
+)
+
+// tempFile returns the temporary file outputFile is written to before it's
+// moved into place. It's in the same directory so the move is a rename.
+func tempFile(outputFile string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + tempTag + ext
+}
+
+// commitFile flushes tmp to disk and renames it to outputFile. Syncing first
+// keeps a crash from persisting the rename before the data.
+func commitFile(tmp, outputFile string) error {
+	f, err := os.Open(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() == 0 {
+		err = fmt.Errorf("output file is empty")
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	if err := os.Rename(tmp, outputFile); err != nil {
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+	return nil
+}
+
+// SweepTempFiles removes temporary files that crashed downloads left in dir
+// and its subdirectories: unfinished merges, stray sidecar files and, unless
+// keepResumable is set, .part files that could otherwise be resumed. Only
+// files untouched for StaleTempAge are removed, and never a .part file
+// that's locked, so downloads still running in another process are left
+// alone. It returns the number of files removed.
+func SweepTempFiles(dir string, keepResumable bool) (int, error) {
+	cutoff := time.Now().Add(-StaleTempAge)
+	removed := 0
+	remove := func(path string) {
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			if path != dir && (strings.HasPrefix(entry.Name(), ".") || strings.Count(rel, string(filepath.Separator)) >= sweepDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := entry.Name()
+		if !isTempFile(name) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		switch {
+		case strings.HasSuffix(name, stateSuffix):
+			// A sidecar is only useful together with its .part file
+			partPath := strings.TrimSuffix(path, stateSuffix)
+			partInfo, err := os.Stat(partPath)
+			if err == nil && (partInfo.ModTime().After(cutoff) || partLocked(partPath)) {
+				return nil
+			}
+			_, stateErr := loadPartState(path)
+			if err == nil && keepResumable && stateErr == nil {
+				return nil
+			}
+			if err == nil {
+				remove(partPath)
+			}
+			remove(path)
+		default:
+			remove(path)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// sweptDirs are the output directories swept since the program started
+type sweptDirs struct {
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+// swept is shared by every Downloader, so the TUI, which creates one per
+// download, sweeps each directory once rather than before every download
+var swept sweptDirs
+
+// sweepOnce runs SweepTempFiles on outputPath the first time a download
+// goes there. Downloads to the same directory wait for it to finish.
+func (d *Downloader) sweepOnce(outputPath string) {
+	if !d.SweepTemp {
+		return
+	}
+	dir := filepath.Clean(outputPath)
+
+	swept.mu.Lock()
+	defer swept.mu.Unlock()
+	if swept.dirs[dir] {
+		return
+	}
+	if swept.dirs == nil {
+		swept.dirs = make(map[string]bool)
+	}
+	swept.dirs[dir] = true
+
+	// A sweep that fails only leaves files behind for next time
+	_, _ = SweepTempFiles(dir, d.KeepPartial)
+}
+
+// isTempFile reports whether name is one of the temporary files downloads
+// write. Bare .part files aren't included: without a sidecar they can't be
+// told apart from other programs' partial downloads.
+func isTempFile(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(base, tempTag) ||
+		strings.HasSuffix(name, partSuffix+stateSuffix) ||
+		strings.HasSuffix(name, partSuffix+stateSuffix+".tmp")
+}
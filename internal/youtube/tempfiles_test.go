@@ -0,0 +1,135 @@
+package youtube
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommitFile(t *testing.T) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "video.mp4")
+	tmp := tempFile(outputFile)
+	if want := filepath.Join(dir, "video"+tempTag+".mp4"); tmp != want {
+		t.Fatalf("tempFile() = %q, want %q", tmp, want)
+	}
+
+	os.WriteFile(tmp, nil, 0644)
+	if err := commitFile(tmp, outputFile); err == nil {
+		t.Error("commitFile() should fail for an empty file")
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("empty file should not be renamed to the final name")
+	}
+
+	os.WriteFile(tmp, []byte("merged"), 0644)
+	if err := commitFile(tmp, outputFile); err != nil {
+		t.Fatalf("commitFile() error = %v", err)
+	}
+	if got, _ := os.ReadFile(outputFile); string(got) != "merged" {
+		t.Errorf("output = %q, want %q", got, "merged")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("temporary file should be gone after the rename")
+	}
+}
+
+func TestSweepTempFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepResumable bool
+		wantRemaining []string
+	}{
+		{
+			name:          "Keep resumable",
+			keepResumable: true,
+			wantRemaining: []string{"fresh.ytdl-tmp.mp4", "other.part", "resumable.mp4.part", "resumable.mp4.part.state", "song.mp3"},
+		},
+		{
+			name:          "Resume disabled",
+			keepResumable: false,
+			wantRemaining: []string{"fresh.ytdl-tmp.mp4", "other.part", "song.mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sub := filepath.Join(dir, "Author")
+			os.Mkdir(sub, 0755)
+
+			old := time.Now().Add(-2 * StaleTempAge)
+			write := func(path, data string, stale bool) {
+				os.WriteFile(path, []byte(data), 0644)
+				if stale {
+					os.Chtimes(path, old, old)
+				}
+			}
+			state := `{"video_id":"abc","itag":18,"content_length":10}`
+			write(filepath.Join(sub, "resumable.mp4.part"), "01234", true)
+			write(filepath.Join(sub, "resumable.mp4.part.state"), state, true)
+			write(filepath.Join(sub, "orphan.mp4.part.state"), state, true)
+			write(filepath.Join(sub, "broken.mp4.part"), "01234", true)
+			write(filepath.Join(sub, "broken.mp4.part.state"), "{", true)
+			write(filepath.Join(sub, "crashed.mp4.part.state.tmp"), state, true)
+			write(filepath.Join(sub, "crashed.ytdl-tmp.mp4"), "merged", true)
+			write(filepath.Join(sub, "fresh.ytdl-tmp.mp4"), "merging", false)
+			write(filepath.Join(sub, "other.part"), "not ours", true)
+			write(filepath.Join(sub, "song.mp3"), "done", true)
+
+			if _, err := SweepTempFiles(dir, tt.keepResumable); err != nil {
+				t.Fatalf("SweepTempFiles() error = %v", err)
+			}
+
+			entries, _ := os.ReadDir(sub)
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantRemaining, ",") {
+				t.Errorf("remaining = %v, want %v", got, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestSweepOnce(t *testing.T) {
+	old := time.Now().Add(-2 * StaleTempAge)
+	crash := func(dir string) string {
+		path := filepath.Join(dir, "crashed.ytdl-tmp.mp4")
+		os.WriteFile(path, []byte("merged"), 0644)
+		os.Chtimes(path, old, old)
+		return path
+	}
+
+	d := NewDownloader(NewClient())
+	first, second := t.TempDir(), t.TempDir()
+	stale := crash(first)
+
+	d.sweepOnce(first)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("%s survived the first download into its folder", stale)
+	}
+
+	// Each folder is swept before its first download only, even when the
+	// next one has a Downloader of its own
+	stale = crash(first)
+	NewDownloader(NewClient()).sweepOnce(first)
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("%s was swept again: %v", stale, err)
+	}
+	stale = crash(second)
+	d.sweepOnce(second)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("%s survived the first download into its folder", stale)
+	}
+
+	d = &Downloader{}
+	stale = crash(t.TempDir())
+	d.sweepOnce(filepath.Dir(stale))
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("%s was swept with SweepTemp off: %v", stale, err)
+	}
+}
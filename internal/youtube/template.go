@@ -0,0 +1,372 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultTemplate names files after the video title
+const DefaultTemplate = "{title}.{ext}"
+
+// maxComponentLength is the longest file or directory name, in bytes, that
+// a template produces. Most filesystems allow 255.
+const maxComponentLength = 200
+
+// defaultDateLayout formats dates that have no layout in the template
+const defaultDateLayout = "%Y-%m-%d"
+
+// ErrInvalidTemplate is returned for output templates that can't be parsed
+var ErrInvalidTemplate = errors.New("invalid output template")
+
+// TemplateData holds the values an output template can refer to
+type TemplateData struct {
+	ID            string
+	Title         string
+	Author        string
+	UploadDate    time.Time
+	Duration      time.Duration
+	Views         int
+	Format        Format
+	PlaylistIndex int // 1-based position in a playlist, 0 outside one
+}
+
+// fieldKind decides which modifier a template field accepts
+type fieldKind int
+
+const (
+	textField   fieldKind = iota // {title:.50} truncates to 50 characters
+	numberField                  // {playlist_index:03} pads to 3 digits
+	dateField                    // {upload_date:%Y%m%d} formats the date
+)
+
+// templateField is a value that can be used in an output template
+type templateField struct {
+	kind  fieldKind
+	value func(d TemplateData) any
+}
+
+// templateFields lists the names usable in braces in an output template
+var templateFields = map[string]templateField{
+	"id":             {textField, func(d TemplateData) any { return d.ID }},
+	"title":          {textField, func(d TemplateData) any { return d.Title }},
+	"author":         {textField, func(d TemplateData) any { return d.Author }},
+	"channel":        {textField, func(d TemplateData) any { return d.Author }},
+	"upload_date":    {dateField, func(d TemplateData) any { return d.UploadDate }},
+	"duration":       {numberField, func(d TemplateData) any { return int(d.Duration.Seconds()) }},
+	"views":          {numberField, func(d TemplateData) any { return d.Views }},
+	"ext":            {textField, func(d TemplateData) any { return d.Format.Extension }},
+	"quality":        {textField, func(d TemplateData) any { return d.Format.Quality }},
+	"resolution":     {textField, func(d TemplateData) any { return d.Format.Resolution }},
+	"itag":           {numberField, func(d TemplateData) any { return d.Format.ItagNo }},
+	"playlist_index": {numberField, func(d TemplateData) any { return d.PlaylistIndex }},
+}
+
+// segment is a piece of a parsed template: literal text or a field
+type segment struct {
+	text  string
+	field string
+	spec  string
+}
+
+// Template builds output file paths from video metadata. Fields are written
+// in braces, optionally followed by a modifier after a colon:
+//
+//	{author}/{upload_date:%Y} - {title:.80} [{id}].{ext}
+//	{playlist_index:03} - {title}.{ext}
+//
+// Text fields take ".N" to keep at most N characters, number fields take a
+// width with an optional leading 0 for zero padding, and dates take a layout
+// using %Y, %y, %m, %d, %H, %M, %S, %b and %B. "{{" and "}}" are literal
+// braces. Slashes in the template create subdirectories; slashes in field
+// values never do.
+type Template struct {
+	raw      string
+	segments []segment
+}
+
+// ParseTemplate parses an output template
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{raw: s}
+	var text strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"), c == '}' && strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte(c)
+			i++
+
+		case c == '}':
+			return nil, fmt.Errorf("%w: unmatched } at position %d", ErrInvalidTemplate, i+1)
+
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed { at position %d", ErrInvalidTemplate, i+1)
+			}
+			name, spec, _ := strings.Cut(s[i+1:i+end], ":")
+			field, ok := templateFields[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown field {%s}", ErrInvalidTemplate, name)
+			}
+			if err := checkSpec(field.kind, spec); err != nil {
+				return nil, fmt.Errorf("%w: {%s}: %v", ErrInvalidTemplate, name, err)
+			}
+
+			if text.Len() > 0 {
+				t.segments = append(t.segments, segment{text: text.String()})
+				text.Reset()
+			}
+			t.segments = append(t.segments, segment{field: name, spec: spec})
+			i += end
+
+		default:
+			text.WriteByte(c)
+		}
+	}
+	if text.Len() > 0 {
+		t.segments = append(t.segments, segment{text: text.String()})
+	}
+
+	if len(t.segments) == 0 {
+		return nil, fmt.Errorf("%w: template is empty", ErrInvalidTemplate)
+	}
+	return t, nil
+}
+
+// String returns the template as it was written
+func (t *Template) String() string {
+	return t.raw
+}
+
+// checkSpec validates the modifier of a field
+func checkSpec(kind fieldKind, spec string) error {
+	if spec == "" {
+		return nil
+	}
+
+	switch kind {
+	case textField:
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "."))
+		if err != nil || !strings.HasPrefix(spec, ".") || n <= 0 {
+			return fmt.Errorf("want a length like .50, got %q", spec)
+		}
+	case numberField:
+		if n, err := strconv.Atoi(spec); err != nil || n <= 0 || strings.HasPrefix(spec, "-") {
+			return fmt.Errorf("want a width like 03, got %q", spec)
+		}
+	case dateField:
+		if _, err := formatDate(time.Time{}, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Execute builds the relative path of a file from data. Each file and
+// directory name is sanitized separately, so the result never leaves the
+// download directory.
+func (t *Template) Execute(data TemplateData) (string, error) {
+	var components []string
+	var current strings.Builder
+	hasField := false
+
+	flush := func() {
+		name := current.String()
+		current.Reset()
+		if strings.TrimSpace(name) == "" && !hasField {
+			// Skip the empty names of "//" or a leading slash
+			return
+		}
+		components = append(components, name)
+		hasField = false
+	}
+
+	for _, seg := range t.segments {
+		if seg.field == "" {
+			parts := strings.FieldsFunc(seg.text, isSeparator)
+			if len(parts) == 0 {
+				flush()
+				continue
+			}
+			if isSeparator(rune(seg.text[0])) {
+				flush()
+			}
+			for i, part := range parts {
+				if i > 0 {
+					flush()
+				}
+				current.WriteString(part)
+			}
+			if isSeparator(rune(seg.text[len(seg.text)-1])) {
+				flush()
+			}
+			continue
+		}
+
+		value, err := renderField(seg, data)
+		if err != nil {
+			return "", err
+		}
+		current.WriteString(strings.Map(func(r rune) rune {
+			if isSeparator(r) {
+				return '_'
+			}
+			return r
+		}, value))
+		hasField = true
+	}
+	flush()
+
+	if len(components) == 0 {
+		return "", fmt.Errorf("%w: %q produces an empty file name", ErrInvalidTemplate, t.raw)
+	}
+
+	for i, name := range components {
+		last := i == len(components)-1
+		components[i] = sanitizeComponent(name, last)
+	}
+	return filepath.Join(components...), nil
+}
+
+// isSeparator reports whether r separates directories in a template. Both
+// slashes are accepted so templates work on every platform.
+func isSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// renderField formats the value of a field with its modifier
+func renderField(seg segment, data TemplateData) (string, error) {
+	field := templateFields[seg.field]
+	value := field.value(data)
+
+	switch field.kind {
+	case textField:
+		s := value.(string)
+		if seg.spec != "" {
+			n, _ := strconv.Atoi(seg.spec[1:])
+			s = truncateRunes(s, n)
+		}
+		return s, nil
+
+	case numberField:
+		if seg.spec == "" {
+			return strconv.Itoa(value.(int)), nil
+		}
+		width, _ := strconv.Atoi(seg.spec)
+		if strings.HasPrefix(seg.spec, "0") {
+			return fmt.Sprintf("%0*d", width, value.(int)), nil
+		}
+		return fmt.Sprintf("%*d", width, value.(int)), nil
+
+	default:
+		date := value.(time.Time)
+		if date.IsZero() {
+			return "", nil
+		}
+		layout := seg.spec
+		if layout == "" {
+			layout = defaultDateLayout
+		}
+		return formatDate(date, layout)
+	}
+}
+
+// formatDate formats t with a strftime-style layout
+func formatDate(t time.Time, layout string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		if i+1 == len(layout) {
+			return "", errors.New("date layout ends with %")
+		}
+		i++
+		switch layout[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'b':
+			b.WriteString(t.Month().String()[:3])
+		case 'B':
+			b.WriteString(t.Month().String())
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unknown date directive %%%c", layout[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n]))
+}
+
+// truncateBytes shortens s to at most n bytes without splitting a character
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// sanitizeFilename replaces characters that aren't allowed in file names
+func sanitizeFilename(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, filename)
+}
+
+// sanitizeComponent makes name safe to use as a single file or directory
+// name on every platform. The extension of the file name is kept when it
+// has to be shortened.
+func sanitizeComponent(name string, isFile bool) string {
+	name = sanitizeFilename(name)
+
+	// Windows drops trailing dots and spaces, which could merge names
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "_"
+	}
+
+	if len(name) > maxComponentLength {
+		ext := ""
+		if isFile {
+			ext = filepath.Ext(name)
+			if len(ext) > maxComponentLength/2 {
+				ext = ""
+			}
+		}
+		name = truncateBytes(strings.TrimSuffix(name, ext), maxComponentLength-len(ext)) + ext
+	}
+	return name
+}
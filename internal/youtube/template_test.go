@@ -0,0 +1,94 @@
+package youtube
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTemplateExecute(t *testing.T) {
+	data := TemplateData{
+		ID:            "dQw4w9WgXcQ",
+		Title:         "AC/DC: Live?",
+		Author:        "Rick Astley",
+		UploadDate:    time.Date(2009, time.October, 25, 6, 57, 33, 0, time.UTC),
+		Duration:      213 * time.Second,
+		Views:         1500,
+		Format:        Format{ItagNo: 22, Quality: "720p", Extension: "mp4"},
+		PlaylistIndex: 7,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"Default", DefaultTemplate, "AC_DC_ Live_.mp4"},
+		{"Subdirectories", "{author}/{upload_date} - {title} [{id}].{ext}", "Rick Astley/2009-10-25 - AC_DC_ Live_ [dQw4w9WgXcQ].mp4"},
+		{"Date layout", "{upload_date:%Y}/{upload_date:%d %b %y}.{ext}", "2009/25 Oct 09.mp4"},
+		{"Slash in date layout", "{upload_date:%Y/%m}.{ext}", "2009_10.mp4"},
+		{"Zero-padded index", "{playlist_index:03} - {id}.{ext}", "007 - dQw4w9WgXcQ.mp4"},
+		{"Truncated field", "{author:.4}.{ext}", "Rick.mp4"},
+		{"Format fields", "{id}.{quality}.{itag}.{ext}", "dQw4w9WgXcQ.720p.22.mp4"},
+		{"Escaped braces", "{{{id}}}.{ext}", "{dQw4w9WgXcQ}.mp4"},
+		{"Leading and doubled slashes", "/{author}//{id}.{ext}", "Rick Astley/dQw4w9WgXcQ.mp4"},
+		{"Parent directory", "../{id}.{ext}", "_/dQw4w9WgXcQ.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParseTemplate(%q) error = %v", tt.template, err)
+			}
+			got, err := tmpl.Execute(data)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if want := filepath.FromSlash(tt.want); got != want {
+				t.Errorf("Execute() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTemplateEmptyFields(t *testing.T) {
+	tmpl, _ := ParseTemplate("{author}/{title}.{ext}")
+	got, err := tmpl.Execute(TemplateData{Title: "..", Format: Format{Extension: "mp4"}})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if want := filepath.FromSlash("_/...mp4"); got != want {
+		t.Errorf("Execute() = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateTruncatesLongNames(t *testing.T) {
+	tmpl, _ := ParseTemplate(DefaultTemplate)
+	got, err := tmpl.Execute(TemplateData{Title: strings.Repeat("é", 300), Format: Format{Extension: "webm"}})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(got) > maxComponentLength || !strings.HasSuffix(got, ".webm") || !utf8.ValidString(got) {
+		t.Errorf("Execute() = %q (%d bytes), want at most %d bytes ending in .webm", got, len(got), maxComponentLength)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"{title",
+		"title}",
+		"{name}.{ext}",
+		"{title:03}",
+		"{playlist_index:.5}",
+		"{upload_date:%Q}",
+	} {
+		if _, err := ParseTemplate(template); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("ParseTemplate(%q) error = %v, want %v", template, err, ErrInvalidTemplate)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/phetzy/yt-downloader/internal/utils"
+)
+
+const (
+	// DefaultThrottleSpeed is the per-connection speed below which a
+	// stream is considered throttled. YouTube throttles to about 50 KB/s.
+	DefaultThrottleSpeed = 64 * 1024
+
+	// DefaultThrottleWindow is how long a connection has to stay below the
+	// throttle speed before its stream URL is refreshed
+	DefaultThrottleWindow = 15 * time.Second
+
+	// maxThrottleRefreshes is how often a connection refreshes a throttled
+	// stream before accepting the speed, e.g. on a slow network where a
+	// fresh URL doesn't help
+	maxThrottleRefreshes = 3
+
+	// maxExpiredRefreshes is how often an expired stream URL is refreshed
+	// without any data coming in before the download fails
+	maxExpiredRefreshes = 2
+)
+
+// throttleError is returned by a throttleWatch when its stream is too slow
+type throttleError struct {
+	speed float64 // bytes per second
+}
+
+// Error implements error
+func (e *throttleError) Error() string {
+	return fmt.Sprintf("stream throttled to %s", utils.FormatSpeed(e.speed))
+}
+
+// isExpired reports whether err means the stream URL is no longer valid
+func isExpired(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Code == http.StatusForbidden
+}
+
+// throttleWatch fails a stream that reads slower than minSpeed for a whole
+// window. Only time spent waiting for the network counts, so writing to
+// disk and waiting for the rate limiter don't make a stream look throttled.
+type throttleWatch struct {
+	r        io.Reader
+	minSpeed float64
+	window   time.Duration
+	now      func() time.Time
+
+	busy  time.Duration // time spent in Read during this window
+	bytes int64         // bytes read during this window
+}
+
+// newThrottleWatch watches r for a speed below minSpeed bytes per second
+func newThrottleWatch(r io.Reader, minSpeed int64, window time.Duration) *throttleWatch {
+	return &throttleWatch{r: r, minSpeed: float64(minSpeed), window: window, now: time.Now}
+}
+
+// Read implements io.Reader
+func (w *throttleWatch) Read(p []byte) (int, error) {
+	start := w.now()
+	n, err := w.r.Read(p)
+	w.busy += w.now().Sub(start)
+	w.bytes += int64(n)
+
+	if err == nil && w.busy >= w.window {
+		speed := float64(w.bytes) / w.busy.Seconds()
+		w.busy, w.bytes = 0, 0
+		if speed < w.minSpeed {
+			return n, &throttleError{speed: speed}
+		}
+	}
+	return n, err
+}
+
+// streamSource is the signed URL of a stream shared by every connection
+// fetching it. It's resolved again when YouTube throttles or expires it.
+type streamSource struct {
+	resolve func(ctx context.Context) (string, error)
+
+	mu  sync.Mutex
+	url string
+}
+
+// newStreamSource creates a source starting at url and refreshed with
+// resolve
+func newStreamSource(url string, resolve func(ctx context.Context) (string, error)) *streamSource {
+	return &streamSource{url: url, resolve: resolve}
+}
+
+// get returns the current URL
+func (s *streamSource) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.url
+}
+
+// refresh resolves the URL again unless another connection already
+// replaced stale. It reports whether this call fetched a new URL.
+func (s *streamSource) refresh(ctx context.Context, stale string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.url != stale {
+		return s.url, false, nil
+	}
+	url, err := s.resolve(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to refresh stream URL: %w", err)
+	}
+	s.url = url
+	return url, true, nil
+}
@@ -0,0 +1,152 @@
+package youtube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchRangeRefreshesStream(t *testing.T) {
+	// Large enough to take several reads
+	data := bytes.Repeat([]byte("0123456789abcdef"), 8<<10)
+
+	tests := []struct {
+		name          string
+		expired       func(sig string) bool // whether requests signed with sig get a 403
+		throttle      bool
+		wantErr       bool
+		wantResolves  int
+		wantEventPart string
+	}{
+		{
+			name:          "Expired URL",
+			expired:       func(sig string) bool { return sig == "0" },
+			wantResolves:  1,
+			wantEventPart: "expired",
+		},
+		{
+			name:         "Keeps expiring",
+			expired:      func(sig string) bool { return true },
+			wantErr:      true,
+			wantResolves: maxExpiredRefreshes,
+		},
+		{
+			name:          "Throttled",
+			expired:       func(sig string) bool { return false },
+			throttle:      true,
+			wantResolves:  maxThrottleRefreshes,
+			wantEventPart: "throttled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.expired(r.URL.Query().Get("sig")) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				parts := strings.SplitN(r.URL.Query().Get("range"), "-", 2)
+				start, _ := strconv.Atoi(parts[0])
+				end, _ := strconv.Atoi(parts[1])
+				w.Write(data[start : end+1])
+			}))
+			defer server.Close()
+
+			resolves := 0
+			src := newStreamSource(server.URL+"?sig=0", func(ctx context.Context) (string, error) {
+				resolves++
+				return fmt.Sprintf("%s?sig=%d", server.URL, resolves), nil
+			})
+
+			outputFile := filepath.Join(t.TempDir(), "video.mp4")
+			part, err := openPart(outputFile, "abc", 18, int64(len(data)))
+			if err != nil {
+				t.Fatalf("openPart() error = %v", err)
+			}
+			defer part.Close()
+
+			d := NewDownloader(NewClient())
+			d.Retry = RetryPolicy{}
+			if tt.throttle {
+				// Every read is too slow
+				d.ThrottleSpeed = 1 << 40
+				d.ThrottleWindow = time.Nanosecond
+			}
+
+			var event string
+			tracker := newProgressTracker(0, int64(len(data)), func(p DownloadProgress) {
+				event = p.Event
+			})
+
+			err = d.fetchRange(context.Background(), src, part, part.plan(1)[0], tracker)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if resolves != tt.wantResolves {
+				t.Errorf("stream URL resolved %d times, want %d", resolves, tt.wantResolves)
+			}
+			if !strings.Contains(event, tt.wantEventPart) {
+				t.Errorf("progress event = %q, want it to mention %q", event, tt.wantEventPart)
+			}
+			if !tt.wantErr && part.written() != int64(len(data)) {
+				t.Errorf("written() = %d, want %d", part.written(), len(data))
+			}
+		})
+	}
+}
+
+func TestThrottleWatch(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	slow := &fakeClockReader{clock: &clock, perRead: time.Second}
+
+	w := newThrottleWatch(slow, 64<<10, 10*time.Second)
+	w.now = func() time.Time { return clock }
+
+	buf := make([]byte, 32<<10)
+	var err error
+	reads := 0
+	for err == nil && reads < 20 {
+		_, err = w.Read(buf)
+		reads++
+	}
+	var throttled *throttleError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Read() error = %v, want a throttle error", err)
+	}
+	if reads != 10 {
+		t.Errorf("throttled after %d reads, want 10 (one window)", reads)
+	}
+
+	// Time spent outside Read, e.g. waiting for the rate limiter, doesn't
+	// count against the stream
+	fast := &fakeClockReader{clock: &clock, perRead: 100 * time.Millisecond}
+	w = newThrottleWatch(fast, 64<<10, time.Second)
+	w.now = func() time.Time { return clock }
+	for i := 0; i < 50; i++ {
+		if _, err := w.Read(buf); err != nil {
+			t.Fatalf("Read() error = %v, want none for a stream at 320 KB/s", err)
+		}
+		clock = clock.Add(time.Second)
+	}
+}
+
+// fakeClockReader fills reads instantly but advances clock by perRead each
+// time, as a stream of that speed would
+type fakeClockReader struct {
+	clock   *time.Time
+	perRead time.Duration
+}
+
+func (r *fakeClockReader) Read(p []byte) (int, error) {
+	*r.clock = r.clock.Add(r.perRead)
+	return len(p), nil
+}
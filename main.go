@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phetzy/yt-downloader/internal/cli"
+	"github.com/phetzy/yt-downloader/internal/config"
 	"github.com/phetzy/yt-downloader/internal/tui"
 )
 
@@ -15,8 +19,24 @@ var (
 )
 
 func main() {
+	// Load user settings
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	
+	// Subcommands run without the TUI
+	if len(os.Args) > 1 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		build := cli.BuildInfo{Version: version, Commit: commit, Date: date}
+		code := cli.New(cfg, build, os.Stdout, os.Stderr).Run(ctx, os.Args[1:])
+		stop()
+		os.Exit(code)
+	}
+	
 	// Initialize the TUI application
-	app := tui.NewApp()
+	app := tui.NewApp(cfg)
 	
 	// Create the Bubble Tea program
 	p := tea.NewProgram(
@@ -26,7 +46,14 @@ func main() {
 	)
 
 	// Run the program
-	if _, err := p.Run(); err != nil {
+	_, err = p.Run()
+	
+	// Stop queued downloads and save them for next time
+	if closeErr := app.Close(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "Error saving download queue: %v\n", closeErr)
+	}
+	
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error running application: %v\n", err)
 		os.Exit(1)
 	}